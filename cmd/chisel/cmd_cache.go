@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cmdCache struct{}
+
+var shortCacheHelp = "Manage the local cache"
+var longCacheHelp = `
+The cache command contains sub-commands to inspect and maintain the
+local cache of releases, archive indexes, and packages.
+
+The cache is located in $XDG_CACHE_HOME/chisel, or ~/.cache/chisel
+when XDG_CACHE_HOME is unset.
+`
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// parseSize parses a size in bytes with an optional K, M, G or T suffix
+// for binary multiples (e.g. 500M).
+func parseSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToUpper(s), "B")
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSuffix(str, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize returns the size in a human readable form.
+func formatSize(size int64) string {
+	for _, unit := range sizeUnits {
+		if size >= unit.size {
+			return fmt.Sprintf("%.1f%s", float64(size)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// parseAge parses a duration as accepted by time.ParseDuration, or a
+// number of days with the "d" suffix (e.g. 7d).
+func parseAge(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	return d, nil
+}
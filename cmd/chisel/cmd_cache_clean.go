@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var shortCacheCleanHelp = "Remove all data from the cache"
+var longCacheCleanHelp = `
+The clean command removes all releases, archive indexes, and packages
+from the cache. They are fetched again when next needed.
+`
+
+type cmdCacheClean struct{}
+
+func init() {
+	addCommandGroup("cache", "clean", shortCacheCleanHelp, longCacheCleanHelp, func() flags.Commander { return &cmdCacheClean{} }, nil, nil)
+}
+
+func (cmd *cmdCacheClean) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	dir := cache.DefaultDir("chisel")
+	err := (&cache.Cache{Dir: dir}).Clean()
+	if err != nil {
+		return err
+	}
+	_, err = setup.ExpireReleases(dir, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Removed all cached data from %s.\n", dir)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var shortCacheInfoHelp = "Show information about the cache"
+var longCacheInfoHelp = `
+The info command shows the location of the cache, the number and total
+size of the archive indexes and packages it holds, and the releases
+cached.
+`
+
+type cmdCacheInfo struct{}
+
+func init() {
+	addCommandGroup("cache", "info", shortCacheInfoHelp, longCacheInfoHelp, func() flags.Commander { return &cmdCacheInfo{} }, nil, nil)
+}
+
+func (cmd *cmdCacheInfo) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	dir := cache.DefaultDir("chisel")
+	entries, err := (&cache.Cache{Dir: dir}).Entries()
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	releases, err := setup.CachedReleases(dir)
+	if err != nil {
+		return err
+	}
+	releasesStr := "-"
+	if len(releases) > 0 {
+		releasesStr = strings.Join(releases, ", ")
+	}
+
+	w := tabWriter()
+	fmt.Fprintf(w, "Location:\t%s\n", dir)
+	fmt.Fprintf(w, "Entries:\t%d\n", len(entries))
+	fmt.Fprintf(w, "Size:\t%s\n", formatSize(size))
+	fmt.Fprintf(w, "Releases:\t%s\n", releasesStr)
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var shortCachePruneHelp = "Remove unused data from the cache"
+var longCachePruneHelp = `
+The prune command removes data from the cache.
+
+With --max-size, the least recently used archive indexes and packages
+are removed until the cache fits in the given size (e.g. 500M, 2G).
+
+With --older-than, the archive indexes, packages, and releases which
+were not used within the given duration (e.g. 72h, 30d) are removed,
+along with the leftovers of release fetches that did not complete.
+`
+
+var cachePruneDescs = map[string]string{
+	"max-size":   "Maximum size of the cache (e.g. 500M, 2G)",
+	"older-than": "Remove data unused for this long (e.g. 72h, 30d)",
+}
+
+type cmdCachePrune struct {
+	MaxSize   string `long:"max-size" value-name:"<size>"`
+	OlderThan string `long:"older-than" value-name:"<duration>"`
+}
+
+func init() {
+	addCommandGroup("cache", "prune", shortCachePruneHelp, longCachePruneHelp, func() flags.Commander { return &cmdCachePrune{} }, cachePruneDescs, nil)
+}
+
+func (cmd *cmdCachePrune) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if cmd.MaxSize == "" && cmd.OlderThan == "" {
+		return fmt.Errorf("either --max-size or --older-than must be provided")
+	}
+
+	dir := cache.DefaultDir("chisel")
+	c := &cache.Cache{Dir: dir}
+	var removed []*cache.Entry
+	var removedReleases []string
+	if cmd.OlderThan != "" {
+		age, err := parseAge(cmd.OlderThan)
+		if err != nil {
+			return err
+		}
+		removed, err = c.Expire(age)
+		if err != nil {
+			return err
+		}
+		removedReleases, err = setup.ExpireReleases(dir, age)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.MaxSize != "" {
+		maxSize, err := parseSize(cmd.MaxSize)
+		if err != nil {
+			return err
+		}
+		pruned, err := c.Prune(maxSize)
+		removed = append(removed, pruned...)
+		if err != nil {
+			return err
+		}
+	}
+
+	var size int64
+	for _, entry := range removed {
+		size += entry.Size
+	}
+	fmt.Fprintf(Stdout, "Removed %d entries (%s) and %d releases.\n", len(removed), formatSize(size), len(removedReleases))
+	return nil
+}
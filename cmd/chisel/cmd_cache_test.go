@@ -0,0 +1,174 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/cache"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+)
+
+const (
+	data1Digest = "5b41362bc82b7f3d56edc5a306db22105707d01ff4819e26faef9724a2d406c9"
+	data2Digest = "d98cf53e0c8b77c14a96358d5b69584225b4bb9026423cbc2f7b0161894c402c"
+)
+
+// setUpCache populates a fake cache with two entries, the first of which
+// was last used two days ago, and two releases, one of them incomplete.
+func (s *ChiselSuite) setUpCache(c *C) string {
+	cacheHome := c.MkDir()
+	oldCacheHome, isSet := os.LookupEnv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", cacheHome)
+	s.AddCleanup(func() {
+		if isSet {
+			os.Setenv("XDG_CACHE_HOME", oldCacheHome)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+	})
+
+	dir := filepath.Join(cacheHome, "chisel")
+	cc := &cache.Cache{Dir: dir}
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = cc.Write(data2Digest, []byte("data2"))
+	c.Assert(err, IsNil)
+	old := time.Now().Add(-48 * time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "sha256", data1Digest), old, old)
+	c.Assert(err, IsNil)
+
+	err = os.MkdirAll(filepath.Join(dir, "releases", "ubuntu-22.04"), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(dir, "releases", "ubuntu-22.04", "chisel.yaml"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = os.MkdirAll(filepath.Join(dir, "releases", "ubuntu-24.04"), 0755)
+	c.Assert(err, IsNil)
+	return dir
+}
+
+func (s *ChiselSuite) TestCacheInfo(c *C) {
+	dir := s.setUpCache(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"cache", "info"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Location:  "+dir+"\n"+
+		"Entries:   2\n"+
+		"Size:      10B\n"+
+		"Releases:  ubuntu-22.04\n")
+}
+
+var cachePruneTests = []struct {
+	summary  string
+	args     []string
+	stdout   string
+	digests  []string
+	releases []string
+	error    string
+}{{
+	summary:  "Prune by size",
+	args:     []string{"--max-size", "5"},
+	stdout:   "Removed 1 entries (5B) and 0 releases.\n",
+	digests:  []string{data2Digest},
+	releases: []string{"ubuntu-22.04", "ubuntu-24.04"},
+}, {
+	summary:  "Prune by size with unit",
+	args:     []string{"--max-size", "1K"},
+	stdout:   "Removed 0 entries (0B) and 0 releases.\n",
+	digests:  []string{data1Digest, data2Digest},
+	releases: []string{"ubuntu-22.04", "ubuntu-24.04"},
+}, {
+	summary:  "Prune by age",
+	args:     []string{"--older-than", "1d"},
+	stdout:   "Removed 1 entries (5B) and 1 releases.\n",
+	digests:  []string{data2Digest},
+	releases: []string{"ubuntu-22.04"},
+}, {
+	summary:  "Prune by age and size",
+	args:     []string{"--older-than", "72h", "--max-size", "0"},
+	stdout:   "Removed 2 entries (10B) and 1 releases.\n",
+	releases: []string{"ubuntu-22.04"},
+}, {
+	summary: "Missing options",
+	error:   "either --max-size or --older-than must be provided",
+}, {
+	summary: "Invalid size",
+	args:    []string{"--max-size", "5X"},
+	error:   `invalid size: "5X"`,
+}, {
+	summary: "Invalid duration",
+	args:    []string{"--older-than=-1h"},
+	error:   `invalid duration: "-1h"`,
+}}
+
+func (s *ChiselSuite) TestCachePrune(c *C) {
+	for _, test := range cachePruneTests {
+		c.Logf("Summary: %s", test.summary)
+		s.ResetStdStreams()
+		dir := s.setUpCache(c)
+
+		_, err := chisel.Parser().ParseArgs(append([]string{"cache", "prune"}, test.args...))
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(s.Stdout(), Equals, test.stdout)
+
+		entries, err := (&cache.Cache{Dir: dir}).Entries()
+		c.Assert(err, IsNil)
+		var digests []string
+		for _, entry := range entries {
+			digests = append(digests, entry.Digest)
+		}
+		c.Assert(digests, DeepEquals, test.digests)
+
+		dirEntries, err := os.ReadDir(filepath.Join(dir, "releases"))
+		c.Assert(err, IsNil)
+		var releases []string
+		for _, dirEntry := range dirEntries {
+			if dirEntry.IsDir() {
+				releases = append(releases, dirEntry.Name())
+			}
+		}
+		c.Assert(releases, DeepEquals, test.releases)
+	}
+}
+
+func (s *ChiselSuite) TestCacheClean(c *C) {
+	dir := s.setUpCache(c)
+
+	_, err := chisel.Parser().ParseArgs([]string{"cache", "clean"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, "Removed all cached data from "+dir+".\n")
+
+	entries, err := (&cache.Cache{Dir: dir}).Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+	dirEntries, err := os.ReadDir(filepath.Join(dir, "releases"))
+	c.Assert(err, IsNil)
+	for _, dirEntry := range dirEntries {
+		c.Assert(dirEntry.IsDir(), Equals, false)
+	}
+}
+
+func (s *ChiselSuite) TestCacheVerify(c *C) {
+	dir := s.setUpCache(c)
+	err := os.WriteFile(filepath.Join(dir, "sha256", data2Digest), []byte("corrupted"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = chisel.Parser().ParseArgs([]string{"cache", "verify"})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Quarantined corrupted entry "+data2Digest+"\n"+
+		"Verified 2 entries, 1 corrupted.\n")
+
+	entries, err := (&cache.Cache{Dir: dir}).Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].Digest, Equals, data1Digest)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/cache"
+)
+
+var shortCacheVerifyHelp = "Check the integrity of the cache"
+var longCacheVerifyHelp = `
+The verify command checks that the content of every archive index and
+package in the cache matches its digest. Corrupted entries are moved
+into quarantine, so that they are fetched again when next needed.
+`
+
+type cmdCacheVerify struct{}
+
+func init() {
+	addCommandGroup("cache", "verify", shortCacheVerifyHelp, longCacheVerifyHelp, func() flags.Commander { return &cmdCacheVerify{} }, nil, nil)
+}
+
+func (cmd *cmdCacheVerify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	c := &cache.Cache{Dir: cache.DefaultDir("chisel")}
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	quarantined, err := c.Verify()
+	for _, entry := range quarantined {
+		fmt.Fprintf(Stdout, "Quarantined corrupted entry %s\n", entry.Digest)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Verified %d entries, %d corrupted.\n", len(entries), len(quarantined))
+	return nil
+}
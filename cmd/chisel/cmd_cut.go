@@ -2,13 +2,17 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/lockfile"
 	"github.com/canonical/chisel/internal/setup"
 	"github.com/canonical/chisel/internal/slicer"
 )
@@ -20,20 +24,72 @@ to create a new filesystem tree in the root location.
 
 By default it fetches the slices for the same Ubuntu version as the
 current host, unless the --release flag is used.
+
+Packages are fetched from the network unless the archive defines a
+local directory, or the --archive-dir flag is used. The --mirror flag
+replaces the location of the archive while still verifying it with the
+release public keys.
+
+The --snapshot flag selects packages as they were available at the given
+time, so that repeated cuts produce the same result.
+
+A specific package version may be requested by appending it to the slice
+name (e.g. libc6_libs=2.35-0ubuntu3.8), or by listing package versions
+in a file provided with the --pins flag.
+
+The --lock-out flag writes a lock file recording the release revision,
+the selected slices, and the exact packages used for the cut. When a lock
+file is provided with the --locked flag, its package versions are used
+and the cut is refused if the resolution differs from it in any way.
+
+The --arch flag may be repeated to cut slices for several architectures
+into the same tree, such as for multiarch libraries. Unqualified slice
+names are selected for every architecture, while a slice name qualified
+with an architecture (e.g. libc6:i386_libs) is selected for that
+architecture only. The first architecture is the primary one, and slices
+of the others are recorded in the manifest with their qualified name.
+
+When the root already holds a manifest generated by a previous cut, only
+the slices not yet installed are added to it, and the manifest is updated
+to list both. The cut fails if an installed package would change version,
+or if new content conflicts with existing content, including files not
+created by chisel.
+
+The --offline flag performs the cut using only the release, archive
+indexes, and packages previously fetched into the cache, failing with
+the list of everything missing from it otherwise.
 `
 
 var cutDescs = map[string]string{
-	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
-	"root":    "Root for generated content",
-	"arch":    "Package architecture",
-	"ignore":  "Conditions to ignore (e.g. unmaintained, unstable)",
+	"release":     "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":        "Root for generated content",
+	"arch":        "Package architecture, may be repeated",
+	"ignore":      "Conditions to ignore (e.g. unmaintained, unstable)",
+	"archive-dir": "Use packages from local directory, for all or the named archive ([<archive>=]<dir>)",
+	"mirror":      "Use mirror URL, for all or the named archive ([<archive>=]<url>)",
+	"jobs":        "Number of concurrent downloads (default 1)",
+	"retries":     "Number of times failed downloads are retried (default 0)",
+	"snapshot":    "Use packages as of the snapshot timestamp (e.g. 20240301T120000Z)",
+	"pins":        "File with the package versions to use",
+	"lock-out":    "Write a lock file describing the cut",
+	"locked":      "Refuse to cut if resolution differs from the lock file",
+	"offline":     "Use only previously cached data, without network access",
 }
 
 type cmdCut struct {
-	Release string   `long:"release" value-name:"<dir>"`
-	RootDir string   `long:"root" value-name:"<dir>" required:"yes"`
-	Arch    string   `long:"arch" value-name:"<arch>"`
-	Ignore  []string `long:"ignore" choice:"unmaintained" choice:"unstable" value-name:"<cond>"`
+	Release     string   `long:"release" value-name:"<dir>"`
+	RootDir     string   `long:"root" value-name:"<dir>" required:"yes"`
+	Arch        []string `long:"arch" value-name:"<arch>"`
+	Ignore      []string `long:"ignore" choice:"unmaintained" choice:"unstable" value-name:"<cond>"`
+	ArchiveDirs []string `long:"archive-dir" value-name:"[<archive>=]<dir>"`
+	Mirrors     []string `long:"mirror" value-name:"[<archive>=]<url>"`
+	Jobs        int      `long:"jobs" value-name:"<n>"`
+	Retries     int      `long:"retries" value-name:"<n>"`
+	Snapshot    string   `long:"snapshot" value-name:"<timestamp>"`
+	Pins        string   `long:"pins" value-name:"<file>"`
+	LockOut     string   `long:"lock-out" value-name:"<file>"`
+	Locked      string   `long:"locked" value-name:"<file>"`
+	Offline     bool     `long:"offline"`
 
 	Positional struct {
 		SliceRefs []string `positional-arg-name:"<slice names>" required:"yes"`
@@ -48,17 +104,62 @@ func (cmd *cmdCut) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
+	if cmd.Jobs < 0 {
+		return fmt.Errorf("invalid number of jobs: %d", cmd.Jobs)
+	}
+	if cmd.Retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", cmd.Retries)
+	}
+	if cmd.Snapshot != "" {
+		if _, err := time.Parse(archive.SnapshotFormat, cmd.Snapshot); err != nil {
+			return fmt.Errorf("invalid snapshot timestamp: %q", cmd.Snapshot)
+		}
+	}
 
-	sliceKeys := make([]setup.SliceKey, len(cmd.Positional.SliceRefs))
-	for i, sliceRef := range cmd.Positional.SliceRefs {
-		sliceKey, err := setup.ParseSliceKey(sliceRef)
+	var archs []string
+	for _, arch := range cmd.Arch {
+		if !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+	}
+	if len(archs) == 0 {
+		arch, err := deb.InferArch()
+		if err != nil {
+			return err
+		}
+		archs = append(archs, arch)
+	}
+	archs, archKeys, refPins, err := parseArchSliceRefs(cmd.Positional.SliceRefs, archs)
+	if err != nil {
+		return err
+	}
+	// Architectures without any slices selected are not cut.
+	archs = slices.DeleteFunc(archs, func(arch string) bool {
+		return len(archKeys[arch]) == 0
+	})
+	pins := make(map[string]string)
+	var locked *lockfile.Lock
+	if cmd.Locked != "" {
+		locked, err = lockfile.Read(cmd.Locked)
+		if err != nil {
+			return err
+		}
+		pins, err = locked.Pins()
 		if err != nil {
 			return err
 		}
-		sliceKeys[i] = sliceKey
 	}
+	if cmd.Pins != "" {
+		filePins, err := readPins(cmd.Pins)
+		if err != nil {
+			return err
+		}
+		maps.Copy(pins, filePins)
+	}
+	// Versions in the slice references take precedence.
+	maps.Copy(pins, refPins)
 
-	release, err := obtainRelease(cmd.Release)
+	release, err := obtainRelease(cmd.Release, cmd.Offline)
 	if err != nil {
 		return err
 	}
@@ -73,40 +174,42 @@ func (cmd *cmdCut) Execute(args []string) error {
 		}
 	}
 
-	selection, err := setup.Select(release, sliceKeys, cmd.Arch)
+	selections := make([]*setup.Selection, len(archs))
+	for i, arch := range archs {
+		selections[i], err = setup.Select(release, archKeys[arch], arch)
+		if err != nil {
+			return err
+		}
+	}
+
+	archiveDirs, err := parseArchiveOverrides(release, cmd.ArchiveDirs)
+	if err != nil {
+		return err
+	}
+	mirrors, err := parseArchiveOverrides(release, cmd.Mirrors)
 	if err != nil {
 		return err
 	}
 
-	archives := make(map[string]archive.Archive)
-	for archiveName, archiveInfo := range release.Archives {
-		openArchive, err := archive.Open(&archive.Options{
-			Label:      archiveName,
-			Version:    archiveInfo.Version,
-			Arch:       cmd.Arch,
-			Suites:     archiveInfo.Suites,
-			Components: archiveInfo.Components,
-			Pro:        archiveInfo.Pro,
-			CacheDir:   cache.DefaultDir("chisel"),
-			PubKeys:    archiveInfo.PubKeys,
-			Maintained: archiveInfo.Maintained,
-			OldRelease: archiveInfo.OldRelease,
-		})
-		if err != nil {
-			if err == archive.ErrCredentialsNotFound {
-				logf("Archive %q ignored: credentials not found", archiveName)
-				continue
-			}
-			return err
-		}
-		archives[archiveName] = openArchive
+	archArchives, err := openArchives(release, archs, &openArchivesOptions{
+		ArchiveDirs: archiveDirs,
+		Mirrors:     mirrors,
+		Snapshot:    cmd.Snapshot,
+		Jobs:        cmd.Jobs,
+		Retries:     cmd.Retries,
+		Offline:     cmd.Offline,
+	})
+	if err != nil {
+		return err
 	}
 
 	hasMaintainedArchive := false
-	for _, archive := range archives {
-		if archive.Options().Maintained {
-			hasMaintainedArchive = true
-			break
+	for _, archives := range archArchives {
+		for _, archive := range archives {
+			if archive.Options().Maintained {
+				hasMaintainedArchive = true
+				break
+			}
 		}
 	}
 	if !hasMaintainedArchive {
@@ -121,10 +224,146 @@ func (cmd *cmdCut) Execute(args []string) error {
 		}
 	}
 
-	err = slicer.Run(&slicer.RunOptions{
-		Selection: selection,
-		Archives:  archives,
+	runOptions := &slicer.RunOptions{
+		Selection: selections[0],
+		Archives:  archArchives[archs[0]],
 		TargetDir: cmd.RootDir,
-	})
-	return err
+		Jobs:      cmd.Jobs,
+		Pins:      pins,
+	}
+	for i, arch := range archs[1:] {
+		runOptions.ForeignArchs = append(runOptions.ForeignArchs, &slicer.ArchOptions{
+			Selection: selections[i+1],
+			Archives:  archArchives[arch],
+		})
+	}
+
+	var lock *lockfile.Lock
+	if cmd.Locked != "" || cmd.LockOut != "" {
+		lock, err = resolveLock(release, runOptions)
+		if err != nil {
+			return err
+		}
+	}
+	if locked != nil {
+		if diffs := lockfile.Diff(locked, lock); len(diffs) > 0 {
+			return fmt.Errorf("resolution differs from lock file %s:\n- %s", cmd.Locked, strings.Join(diffs, "\n- "))
+		}
+	}
+
+	err = slicer.Run(runOptions)
+	if err != nil {
+		return err
+	}
+	if cmd.LockOut != "" {
+		return lockfile.Write(cmd.LockOut, lock)
+	}
+	return nil
+}
+
+// resolveLock returns the lock describing the cut for the given options.
+func resolveLock(release *setup.Release, options *slicer.RunOptions) (*lockfile.Lock, error) {
+	resolved, err := slicer.Resolve(options)
+	if err != nil {
+		return nil, err
+	}
+	lock := &lockfile.Lock{ReleaseETag: release.ETag}
+	for _, slice := range options.Selection.Slices {
+		lock.Slices = append(lock.Slices, slice.String())
+	}
+	for _, foreign := range options.ForeignArchs {
+		for _, slice := range foreign.Selection.Slices {
+			lock.Slices = append(lock.Slices, slice.Package+":"+foreign.Selection.Arch+"_"+slice.Name)
+		}
+	}
+	for _, pkg := range resolved {
+		lock.Packages = append(lock.Packages, &lockfile.Package{
+			Name:    pkg.Info.Name,
+			Version: pkg.Info.Version,
+			Arch:    pkg.Info.Arch,
+			Archive: pkg.Archive,
+			SHA256:  pkg.Info.SHA256,
+		})
+	}
+	return lock, nil
+}
+
+type openArchivesOptions struct {
+	// ArchiveDirs and Mirrors override the location of the named archives.
+	ArchiveDirs map[string]string
+	Mirrors     map[string]string
+	Snapshot    string
+	Jobs        int
+	Retries     int
+	Offline     bool
+}
+
+// openArchives opens the release archives for each of the architectures,
+// returning them indexed by architecture and then by archive name. Data
+// missing from the cache when working offline is reported for all the
+// archives together.
+func openArchives(release *setup.Release, archs []string, options *openArchivesOptions) (map[string]map[string]archive.Archive, error) {
+	archArchives := make(map[string]map[string]archive.Archive)
+	for _, arch := range archs {
+		archArchives[arch] = make(map[string]archive.Archive)
+	}
+	var missing []error
+	for _, archiveName := range slices.Sorted(maps.Keys(release.Archives)) {
+		archiveInfo := release.Archives[archiveName]
+		archiveDir := archiveInfo.Dir
+		if dir, ok := options.ArchiveDirs[archiveName]; ok {
+			archiveDir = dir
+		}
+		archiveURL, portsURL := archiveInfo.URL, archiveInfo.PortsURL
+		if mirror, ok := options.Mirrors[archiveName]; ok {
+			archiveURL, portsURL = mirror, ""
+		}
+		snapshot := archiveInfo.Snapshot
+		if options.Snapshot != "" {
+			if archiveInfo.Pro != "" || archiveDir != "" {
+				logf("Warning: Archive %q does not support snapshots, using its latest packages", archiveName)
+			} else {
+				snapshot = options.Snapshot
+			}
+		}
+		for _, arch := range archs {
+			openArchive, err := archiveOpen(&archive.Options{
+				Label:           archiveName,
+				Version:         archiveInfo.Version,
+				Arch:            arch,
+				Suites:          archiveInfo.Suites,
+				Components:      archiveInfo.Components,
+				Pro:             archiveInfo.Pro,
+				CacheDir:        cache.DefaultDir("chisel"),
+				PubKeys:         archiveInfo.PubKeys,
+				Maintained:      archiveInfo.Maintained,
+				OldRelease:      archiveInfo.OldRelease,
+				Dir:             archiveDir,
+				URL:             archiveURL,
+				PortsURL:        portsURL,
+				ReleaseLabel:    archiveInfo.ReleaseLabel,
+				SignaturePolicy: archiveInfo.SignaturePolicy,
+				Jobs:            options.Jobs,
+				Retries:         options.Retries,
+				Snapshot:        snapshot,
+				Offline:         options.Offline,
+			})
+			if err != nil {
+				if err == archive.ErrCredentialsNotFound {
+					logf("Archive %q ignored: credentials not found", archiveName)
+					break
+				}
+				if _, ok := err.(*archive.MissingError); ok {
+					missing = append(missing, err)
+					continue
+				}
+				return nil, err
+			}
+			archArchives[arch][archiveName] = openArchive
+		}
+	}
+	if err := archive.JoinMissing(missing); err != nil {
+		return nil, err
+	}
+	return archArchives, nil
 }
@@ -0,0 +1,48 @@
+package main_test
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+func (s *ChiselSuite) TestOpenArchivesMissing(c *C) {
+	release := &setup.Release{
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {Name: "ubuntu", Version: "22.04", Suites: []string{"jammy"}},
+			"other":  {Name: "other", Version: "22.04", Suites: []string{"jammy"}},
+		},
+	}
+	restore := chisel.FakeArchiveOpen(func(options *archive.Options) (archive.Archive, error) {
+		c.Assert(options.Offline, Equals, true)
+		return nil, &archive.MissingError{Missing: []string{
+			fmt.Sprintf("%s index for %s", options.Label, options.Arch),
+		}}
+	})
+	defer restore()
+
+	_, err := chisel.OpenArchives(release, []string{"amd64", "arm64"}, &chisel.OpenArchivesOptions{Offline: true})
+	c.Assert(err, FitsTypeOf, &archive.MissingError{})
+	c.Assert(err.(*archive.MissingError).Missing, DeepEquals, []string{
+		"other index for amd64",
+		"other index for arm64",
+		"ubuntu index for amd64",
+		"ubuntu index for arm64",
+	})
+
+	// Other errors are returned as they are found.
+	restore = chisel.FakeArchiveOpen(func(options *archive.Options) (archive.Archive, error) {
+		if options.Label == "ubuntu" {
+			return nil, fmt.Errorf("cannot talk to archive")
+		}
+		return nil, &archive.MissingError{Missing: []string{options.Label}}
+	})
+	defer restore()
+
+	_, err = chisel.OpenArchives(release, []string{"amd64"}, &chisel.OpenArchivesOptions{Offline: true})
+	c.Assert(err, ErrorMatches, "cannot talk to archive")
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"slices"
 	"strings"
 
@@ -30,6 +31,9 @@ same path. For example, for parent directories which are not listed explicitly
 in the SDFs, Chisel will try to preserve permissions by using the mode from the
 package's tarball. If several packages have different permissions for the same
 directory, that could lead to a conflict.
+
+The key and algorithms which verified the release file of each suite are
+reported on standard error.
 `
 
 var checkReleaseArchivesDescs = map[string]string{
@@ -43,7 +47,7 @@ type cmdDebugCheckReleaseArchives struct {
 }
 
 func init() {
-	addDebugCommand("check-release-archives", shortCheckReleaseArchivesHelp, longCheckReleaseArchivesHelp, func() flags.Commander { return &cmdDebugCheckReleaseArchives{} }, checkReleaseArchivesDescs, nil)
+	addCommandGroup("debug", "check-release-archives", shortCheckReleaseArchivesHelp, longCheckReleaseArchivesHelp, func() flags.Commander { return &cmdDebugCheckReleaseArchives{} }, checkReleaseArchivesDescs, nil)
 }
 
 var archiveOpen = archive.Open
@@ -57,7 +61,7 @@ type pathObservation struct {
 }
 
 func (cmd *cmdDebugCheckReleaseArchives) Execute(args []string) error {
-	release, err := obtainRelease(cmd.Release)
+	release, err := obtainRelease(cmd.Release, false)
 	if err != nil {
 		return err
 	}
@@ -65,16 +69,22 @@ func (cmd *cmdDebugCheckReleaseArchives) Execute(args []string) error {
 	archives := make(map[string]archive.Archive)
 	for archiveName, archiveInfo := range release.Archives {
 		openArchive, err := archiveOpen(&archive.Options{
-			Label:      archiveName,
-			Version:    archiveInfo.Version,
-			Arch:       cmd.Arch,
-			Suites:     archiveInfo.Suites,
-			Components: archiveInfo.Components,
-			Pro:        archiveInfo.Pro,
-			CacheDir:   cache.DefaultDir("chisel"),
-			PubKeys:    archiveInfo.PubKeys,
-			Maintained: archiveInfo.Maintained,
-			OldRelease: archiveInfo.OldRelease,
+			Label:           archiveName,
+			Version:         archiveInfo.Version,
+			Arch:            cmd.Arch,
+			Suites:          archiveInfo.Suites,
+			Components:      archiveInfo.Components,
+			Pro:             archiveInfo.Pro,
+			CacheDir:        cache.DefaultDir("chisel"),
+			PubKeys:         archiveInfo.PubKeys,
+			Maintained:      archiveInfo.Maintained,
+			OldRelease:      archiveInfo.OldRelease,
+			Dir:             archiveInfo.Dir,
+			URL:             archiveInfo.URL,
+			PortsURL:        archiveInfo.PortsURL,
+			ReleaseLabel:    archiveInfo.ReleaseLabel,
+			SignaturePolicy: archiveInfo.SignaturePolicy,
+			Snapshot:        archiveInfo.Snapshot,
 		})
 		if err == archive.ErrCredentialsNotFound {
 			logf("Archive %q ignored: credentials not found\n", archiveName)
@@ -84,6 +94,12 @@ func (cmd *cmdDebugCheckReleaseArchives) Execute(args []string) error {
 		}
 		archives[archiveName] = openArchive
 	}
+	for _, archiveName := range slices.Sorted(maps.Keys(archives)) {
+		for _, v := range archives[archiveName].Verifications() {
+			fmt.Fprintf(Stderr, "Archive %s: %s %s verified by key %s (%s) with %s\n",
+				archiveName, v.Suite, v.File, v.KeyID, v.KeyAlgorithm, v.Hash)
+		}
+	}
 
 	pathObs, err := computePathObservations(release, archives)
 	if err != nil {
@@ -145,7 +161,7 @@ func computePathObservations(release *setup.Release, archives map[string]archive
 			if !archive.Exists(pkgName) {
 				continue
 			}
-			pkgReader, _, err := archive.Fetch(pkgName)
+			pkgReader, _, err := archive.Fetch(pkgName, "")
 			if err != nil {
 				return nil, err
 			}
@@ -16,12 +16,14 @@ import (
 )
 
 type checkReleaseArchivesTest struct {
-	summary string
-	arch    string
-	release map[string]string
-	pkgs    []*testutil.TestPackage
-	stdout  string
-	err     string
+	summary       string
+	arch          string
+	release       map[string]string
+	pkgs          []*testutil.TestPackage
+	verifications map[string][]*archive.Verification
+	stdout        string
+	stderr        string
+	err           string
 }
 
 var checkReleaseArchivesTests = []checkReleaseArchivesTest{{
@@ -53,6 +55,50 @@ var checkReleaseArchivesTests = []checkReleaseArchivesTest{{
 		}),
 	}},
 	stdout: "",
+}, {
+	summary: "Release verification is reported",
+	release: map[string]string{
+		"chisel.yaml": makeChiselYaml([]string{"ubuntu", "other"}),
+		"slices/mydir/pkg-a.yaml": `
+			package: pkg-a
+			slices:
+				myslice:
+					contents:
+		`,
+	},
+	pkgs: []*testutil.TestPackage{{
+		Name: "pkg-a",
+		Data: testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./dir/"),
+		}),
+	}},
+	verifications: map[string][]*archive.Verification{
+		"ubuntu": {{
+			Suite:        "jammy",
+			File:         "InRelease",
+			KeyID:        "871920D1991BC93C",
+			KeyAlgorithm: "rsa 4096",
+			Hash:         "sha512",
+		}, {
+			Suite:        "jammy-updates",
+			File:         "Release",
+			KeyID:        "871920D1991BC93C",
+			KeyAlgorithm: "rsa 4096",
+			Hash:         "sha256",
+		}},
+		"other": {{
+			Suite:        "jammy",
+			File:         "InRelease",
+			KeyID:        "854BAF1AA9D76600",
+			KeyAlgorithm: "rsa 2048",
+			Hash:         "sha256",
+		}},
+	},
+	stderr: `
+		Archive other: jammy InRelease verified by key 854BAF1AA9D76600 (rsa 2048) with sha256
+		Archive ubuntu: jammy InRelease verified by key 871920D1991BC93C (rsa 4096) with sha512
+		Archive ubuntu: jammy-updates Release verified by key 871920D1991BC93C (rsa 4096) with sha256
+	`,
 }, {
 	summary: "All types of conflicts",
 	release: map[string]string{
@@ -503,6 +549,7 @@ func (s *ChiselSuite) TestRun(c *C) {
 					Arch:       test.arch,
 				},
 				Packages: pkgs,
+				Verified: test.verifications[name],
 			}
 			archives[name] = archive
 		}
@@ -536,6 +583,11 @@ func (s *ChiselSuite) TestRun(c *C) {
 			test.stdout = strings.TrimSpace(test.stdout) + "\n"
 		}
 		c.Assert(s.Stdout(), Equals, test.stdout)
+		if test.stderr != "" {
+			test.stderr = string(testutil.Reindent(test.stderr))
+			test.stderr = strings.TrimSpace(test.stderr) + "\n"
+		}
+		c.Assert(s.Stderr(), Equals, test.stderr)
 	}
 }
 
@@ -19,14 +19,19 @@ Globs (* and ?) are allowed in the query.
 
 By default it fetches the slices for the same Ubuntu version as the
 current host, unless the --release flag is used.
+
+The --offline flag uses the release previously fetched into the cache
+instead of consulting the release repository.
 `
 
 var findDescs = map[string]string{
 	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"offline": "Use only previously cached data, without network access",
 }
 
 type cmdFind struct {
 	Release string `long:"release" value-name:"<branch|dir>"`
+	Offline bool   `long:"offline"`
 
 	Positional struct {
 		Query []string `positional-arg-name:"<query>" required:"yes"`
@@ -42,7 +47,7 @@ func (cmd *cmdFind) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	release, err := obtainRelease(cmd.Release)
+	release, err := obtainRelease(cmd.Release, cmd.Offline)
 	if err != nil {
 		return err
 	}
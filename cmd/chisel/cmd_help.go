@@ -163,11 +163,11 @@ type helpCategory struct {
 var helpCategories = []helpCategory{{
 	Label:       "Basic",
 	Description: "general operations",
-	Commands:    []string{"find", "info", "help", "version"},
+	Commands:    []string{"find", "info", "cache", "manifest", "help", "version"},
 }, {
 	Label:       "Action",
 	Description: "make things happen",
-	Commands:    []string{"cut"},
+	Commands:    []string{"cut", "remove", "upgrade", "verify"},
 }}
 
 var (
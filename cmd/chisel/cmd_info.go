@@ -22,14 +22,19 @@ the output is a list of YAML documents separated by a "---" line.
 
 Slice definitions are shown verbatim according to their definition in
 the selected release. For example, globs are not expanded.
+
+The --offline flag uses the release previously fetched into the cache
+instead of consulting the release repository.
 `
 
 var infoDescs = map[string]string{
 	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"offline": "Use only previously cached data, without network access",
 }
 
 type infoCmd struct {
 	Release string `long:"release" value-name:"<branch|dir>"`
+	Offline bool   `long:"offline"`
 
 	Positional struct {
 		Queries []string `positional-arg-name:"<pkg|slice>" required:"yes"`
@@ -45,7 +50,7 @@ func (cmd *infoCmd) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	release, err := obtainRelease(cmd.Release)
+	release, err := obtainRelease(cmd.Release, cmd.Offline)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,10 @@
+package main
+
+type cmdManifest struct{}
+
+var shortManifestHelp = "Inspect manifests of chiselled trees"
+var longManifestHelp = `
+The manifest command contains sub-commands to inspect the manifests
+generated by the cut command, which record the packages, slices and
+paths installed into a tree.
+`
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/manifestutil"
+)
+
+var shortManifestDiffHelp = "Show the differences between two manifests"
+var longManifestDiffHelp = `
+The diff command compares two manifests, such as the ones generated by
+two builds of the same image, and reports the differences between them.
+
+Packages and slices are reported when added or removed, and packages
+also when their version changes. Paths are reported when added or
+removed, or when their content, mode or link target changes.
+
+The manifests are compared entry by entry as they are read. With
+--validate, each manifest is first checked for consistency as a whole,
+which requires loading it entirely into memory.
+
+The differences are printed as a table by default, or in JSON with
+--format=json.
+`
+
+var manifestDiffDescs = map[string]string{
+	"format":   "Output format (text or json)",
+	"validate": "Validate both manifests before comparing them",
+}
+
+type cmdManifestDiff struct {
+	Format   string `long:"format" choice:"text" choice:"json" default:"text" value-name:"<format>"`
+	Validate bool   `long:"validate"`
+
+	Positional struct {
+		OldManifest string `positional-arg-name:"<old manifest>" required:"yes"`
+		NewManifest string `positional-arg-name:"<new manifest>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommandGroup("manifest", "diff", shortManifestDiffHelp, longManifestDiffHelp, func() flags.Commander { return &cmdManifestDiff{} }, manifestDiffDescs, nil)
+}
+
+type manifestDiffEntry struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+func (cmd *cmdManifestDiff) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	readFile := manifestutil.ReadFileUnchecked
+	if cmd.Validate {
+		readFile = manifestutil.ReadFile
+	}
+	oldMfest, err := readFile(cmd.Positional.OldManifest)
+	if err != nil {
+		return fmt.Errorf("cannot read manifest %s: %w", cmd.Positional.OldManifest, err)
+	}
+	newMfest, err := readFile(cmd.Positional.NewManifest)
+	if err != nil {
+		return fmt.Errorf("cannot read manifest %s: %w", cmd.Positional.NewManifest, err)
+	}
+	entries, err := manifestutil.Diff(oldMfest, newMfest)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Format == "json" {
+		output := make([]manifestDiffEntry, len(entries))
+		for i, entry := range entries {
+			output[i] = manifestDiffEntry(*entry)
+		}
+		encoder := json.NewEncoder(Stdout)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(output)
+		if err != nil {
+			return fmt.Errorf("internal error: cannot marshal differences: %s", err)
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	w := tabWriter()
+	fmt.Fprintf(w, "Kind\tName\tChange\tOld\tNew\n")
+	for _, entry := range entries {
+		oldValue, newValue := entry.Old, entry.New
+		if oldValue == "" {
+			oldValue = "-"
+		}
+		if newValue == "" {
+			newValue = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Kind, entry.Name, entry.Change, oldValue, newValue)
+	}
+	w.Flush()
+	return nil
+}
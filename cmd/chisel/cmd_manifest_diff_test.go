@@ -0,0 +1,55 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+)
+
+// writeManifest writes the zstd-compressed jsonwall lines as a manifest
+// and returns its path.
+func writeManifest(c *C, lines ...string) string {
+	manifestPath := filepath.Join(c.MkDir(), "manifest.wall")
+	f, err := os.Create(manifestPath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	w, err := zstd.NewWriter(f)
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	c.Assert(err, IsNil)
+	err = w.Close()
+	c.Assert(err, IsNil)
+	return manifestPath
+}
+
+func (s *ChiselSuite) TestManifestDiff(c *C) {
+	oldManifest := writeManifest(c,
+		`{"jsonwall":"1.0","schema":"1.0","count":2}`,
+		`{"kind":"package","name":"pkg1","version":"v1","sha256":"hash1","arch":"amd64"}`,
+		`{"kind":"slice","name":"pkg1_myslice"}`,
+	)
+	// The added slice refers to a package missing from the manifest.
+	newManifest := writeManifest(c,
+		`{"jsonwall":"1.0","schema":"1.0","count":3}`,
+		`{"kind":"package","name":"pkg1","version":"v2","sha256":"hash2","arch":"amd64"}`,
+		`{"kind":"slice","name":"pkg1_myslice"}`,
+		`{"kind":"slice","name":"pkg2_myslice"}`,
+	)
+
+	_, err := chisel.Parser().ParseArgs([]string{"manifest", "diff", oldManifest, newManifest})
+	c.Assert(err, IsNil)
+	c.Assert(s.Stdout(), Equals, ""+
+		"Kind     Name          Change   Old  New\n"+
+		"package  pkg1:amd64    version  v1   v2\n"+
+		"slice    pkg2_myslice  added    -    -\n")
+	s.ResetStdStreams()
+
+	_, err = chisel.Parser().ParseArgs([]string{"manifest", "diff", "--validate", oldManifest, newManifest})
+	c.Assert(err, ErrorMatches, `cannot read manifest .*/manifest.wall: invalid manifest: slice pkg2_myslice refers to missing package "pkg2"`)
+	c.Assert(s.Stdout(), Equals, "")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/cmd"
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/internal/sbom"
+)
+
+var shortManifestExportHelp = "Export a manifest as a software bill of materials"
+var longManifestExportHelp = `
+The export command converts a manifest into a software bill of materials
+(SBOM), so that scanners which otherwise rely on the dpkg database can
+learn about the content of a chiselled tree.
+
+Packages are listed with their Debian package URL (purl) and checksum,
+along with their slices and the files installed by them.
+
+The --format flag selects an SPDX 2.3 or CycloneDX 1.5 document in JSON.
+The document is named after the --name flag, or the manifest path.
+
+The manifest does not record the release the packages come from, so the
+--distro flag should name it, as in "ubuntu-22.04", for scanners to match
+the packages against the security advisories of that release.
+`
+
+var manifestExportDescs = map[string]string{
+	"format": "SBOM format (spdx-json or cyclonedx-json)",
+	"name":   "Name of the tree described",
+	"distro": "Release of the packages, as in ubuntu-22.04",
+}
+
+type cmdManifestExport struct {
+	Format string `long:"format" choice:"spdx-json" choice:"cyclonedx-json" required:"yes" value-name:"<format>"`
+	Name   string `long:"name" value-name:"<name>"`
+	Distro string `long:"distro" value-name:"<distro>"`
+
+	Positional struct {
+		Manifest string `positional-arg-name:"<manifest>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommandGroup("manifest", "export", shortManifestExportHelp, longManifestExportHelp, func() flags.Commander { return &cmdManifestExport{} }, manifestExportDescs, nil)
+}
+
+func (cmd *cmdManifestExport) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	mfest, err := manifestutil.ReadFile(cmd.Positional.Manifest)
+	if err != nil {
+		return fmt.Errorf("cannot read manifest %s: %w", cmd.Positional.Manifest, err)
+	}
+	name := cmd.Name
+	if name == "" {
+		name = cmd.Positional.Manifest
+	}
+	options, err := sbomOptions(name)
+	if err != nil {
+		return err
+	}
+	options.Distro = cmd.Distro
+	if cmd.Format == "cyclonedx-json" {
+		return sbom.WriteCycloneDX(Stdout, mfest, options)
+	}
+	return sbom.WriteSPDX(Stdout, mfest, options)
+}
+
+// sbomOptions returns the options for a new document describing the named
+// tree, identified by a random UUID as defined in RFC 4122.
+func sbomOptions(name string) (*sbom.Options, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate UUID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return &sbom.Options{
+		Name:        name,
+		UUID:        fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]),
+		Created:     time.Now(),
+		ToolVersion: cmd.Version,
+	}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/slicer"
+)
+
+var shortRemoveHelp = "Remove slices from a tree"
+var longRemoveHelp = `
+The remove command removes slices from a tree previously created by the
+cut command, using the manifest generated in the root location.
+
+Paths are deleted only when no remaining slice lists them, and are left
+in place if they were modified since the cut. Directories left empty are
+removed as well, and the manifest is updated to list only the remaining
+slices. Slices which are still required by others cannot be removed.
+
+By default it uses the slices for the same Ubuntu version as the current
+host to find the manifest, unless the --release flag is used.
+`
+
+var removeDescs = map[string]string{
+	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":    "Root of the tree to remove slices from",
+}
+
+type cmdRemove struct {
+	Release string `long:"release" value-name:"<dir>"`
+	RootDir string `long:"root" value-name:"<dir>" required:"yes"`
+
+	Positional struct {
+		SliceNames []string `positional-arg-name:"<slice names>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} }, removeDescs, nil)
+}
+
+func (cmd *cmdRemove) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	release, err := obtainRelease(cmd.Release, false)
+	if err != nil {
+		return err
+	}
+
+	return slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		TargetDir: cmd.RootDir,
+		Slices:    cmd.Positional.SliceNames,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+)
+
+var shortUpgradeHelp = "Upgrade the packages of a tree"
+var longUpgradeHelp = `
+The upgrade command brings a tree previously created by the cut command
+up to date with the newest package versions available for the slices
+listed in its manifest.
+
+The slices of every package that changed are cut again, including
+running their mutation scripts, while all other content is left
+untouched. The packages upgraded are listed once done.
+
+By default it uses the slices for the same Ubuntu version as the current
+host, unless the --release flag is used. The --archive-dir, --mirror,
+--snapshot, --pins and --offline flags work as for the cut command.
+`
+
+var upgradeDescs = map[string]string{
+	"release":     "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":        "Root of the tree to upgrade",
+	"archive-dir": "Use packages from local directory, for all or the named archive ([<archive>=]<dir>)",
+	"mirror":      "Use mirror URL, for all or the named archive ([<archive>=]<url>)",
+	"jobs":        "Number of concurrent downloads (default 1)",
+	"retries":     "Number of times failed downloads are retried (default 0)",
+	"snapshot":    "Use packages as of the snapshot timestamp (e.g. 20240301T120000Z)",
+	"pins":        "File with the package versions to use",
+	"offline":     "Use only previously cached data, without network access",
+}
+
+type cmdUpgrade struct {
+	Release     string   `long:"release" value-name:"<dir>"`
+	RootDir     string   `long:"root" value-name:"<dir>" required:"yes"`
+	ArchiveDirs []string `long:"archive-dir" value-name:"[<archive>=]<dir>"`
+	Mirrors     []string `long:"mirror" value-name:"[<archive>=]<url>"`
+	Jobs        int      `long:"jobs" value-name:"<n>"`
+	Retries     int      `long:"retries" value-name:"<n>"`
+	Snapshot    string   `long:"snapshot" value-name:"<timestamp>"`
+	Pins        string   `long:"pins" value-name:"<file>"`
+	Offline     bool     `long:"offline"`
+}
+
+func init() {
+	addCommand("upgrade", shortUpgradeHelp, longUpgradeHelp, func() flags.Commander { return &cmdUpgrade{} }, upgradeDescs, nil)
+}
+
+func (cmd *cmdUpgrade) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if cmd.Jobs < 0 {
+		return fmt.Errorf("invalid number of jobs: %d", cmd.Jobs)
+	}
+	if cmd.Retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", cmd.Retries)
+	}
+	if cmd.Snapshot != "" {
+		if _, err := time.Parse(archive.SnapshotFormat, cmd.Snapshot); err != nil {
+			return fmt.Errorf("invalid snapshot timestamp: %q", cmd.Snapshot)
+		}
+	}
+	pins := make(map[string]string)
+	if cmd.Pins != "" {
+		filePins, err := readPins(cmd.Pins)
+		if err != nil {
+			return err
+		}
+		maps.Copy(pins, filePins)
+	}
+
+	release, err := obtainRelease(cmd.Release, cmd.Offline)
+	if err != nil {
+		return err
+	}
+
+	archs, archKeys, err := slicer.InstalledSlices(cmd.RootDir, release)
+	if err != nil {
+		return err
+	}
+	if archs[0] == "" {
+		arch, err := deb.InferArch()
+		if err != nil {
+			return err
+		}
+		archKeys[arch] = archKeys[""]
+		delete(archKeys, "")
+		archs[0] = arch
+	}
+	archs = slices.DeleteFunc(archs, func(arch string) bool {
+		return len(archKeys[arch]) == 0
+	})
+	selections := make([]*setup.Selection, len(archs))
+	for i, arch := range archs {
+		selections[i], err = setup.Select(release, archKeys[arch], arch)
+		if err != nil {
+			return err
+		}
+	}
+
+	archiveDirs, err := parseArchiveOverrides(release, cmd.ArchiveDirs)
+	if err != nil {
+		return err
+	}
+	mirrors, err := parseArchiveOverrides(release, cmd.Mirrors)
+	if err != nil {
+		return err
+	}
+	archArchives, err := openArchives(release, archs, &openArchivesOptions{
+		ArchiveDirs: archiveDirs,
+		Mirrors:     mirrors,
+		Snapshot:    cmd.Snapshot,
+		Jobs:        cmd.Jobs,
+		Retries:     cmd.Retries,
+		Offline:     cmd.Offline,
+	})
+	if err != nil {
+		return err
+	}
+
+	runOptions := &slicer.RunOptions{
+		Selection: selections[0],
+		Archives:  archArchives[archs[0]],
+		TargetDir: cmd.RootDir,
+		Jobs:      cmd.Jobs,
+		Pins:      pins,
+	}
+	for i, arch := range archs[1:] {
+		runOptions.ForeignArchs = append(runOptions.ForeignArchs, &slicer.ArchOptions{
+			Selection: selections[i+1],
+			Archives:  archArchives[arch],
+		})
+	}
+	upgrades, err := slicer.Upgrade(runOptions)
+	if err != nil {
+		return err
+	}
+	if len(upgrades) == 0 {
+		fmt.Fprintf(Stdout, "All packages are up to date.\n")
+		return nil
+	}
+	w := tabWriter()
+	fmt.Fprintf(w, "Package\tArch\tOld version\tNew version\n")
+	for _, upgrade := range upgrades {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", upgrade.Name, upgrade.Arch, upgrade.OldVersion, upgrade.NewVersion)
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/internal/slicer"
+)
+
+var shortVerifyHelp = "Verify a tree against its manifest"
+var longVerifyHelp = `
+The verify command checks that the content of a tree previously created
+by the cut command matches the manifest generated in the root location.
+
+Every issue found is listed, and the command fails if there is any.
+
+Types of issues:
+- "missing". A path listed in the manifest does not exist.
+- "extra". A path exists but is not listed in the manifest. Directories
+holding listed paths are not reported, as they are created implicitly.
+- "modified". The content or the type of a path differs from the manifest.
+- "mode". The permissions of a path differ from the manifest.
+- "link". A symlink points somewhere else, or a hard link is broken.
+
+The issues are printed in YAML by default, or in JSON with --format=json.
+
+By default it uses the slices for the same Ubuntu version as the current
+host to find the manifest, unless the --release flag is used.
+`
+
+var verifyDescs = map[string]string{
+	"release": "Chisel release name or directory (e.g. ubuntu-22.04)",
+	"root":    "Root of the tree to verify",
+	"format":  "Output format (yaml or json)",
+}
+
+type cmdVerify struct {
+	Release string `long:"release" value-name:"<dir>"`
+	RootDir string `long:"root" value-name:"<dir>" required:"yes"`
+	Format  string `long:"format" choice:"yaml" choice:"json" default:"yaml" value-name:"<format>"`
+}
+
+func init() {
+	addCommand("verify", shortVerifyHelp, longVerifyHelp, func() flags.Commander { return &cmdVerify{} }, verifyDescs, nil)
+}
+
+type verifyIssue struct {
+	Issue    string `yaml:"issue" json:"issue"`
+	Path     string `yaml:"path" json:"path"`
+	Expected string `yaml:"expected,omitempty" json:"expected,omitempty"`
+	Found    string `yaml:"found,omitempty" json:"found,omitempty"`
+}
+
+func (cmd *cmdVerify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	release, err := obtainRelease(cmd.Release, false)
+	if err != nil {
+		return err
+	}
+
+	mfest, _, err := slicer.FindManifest(cmd.RootDir, release)
+	if err != nil {
+		return err
+	}
+	if mfest == nil {
+		return fmt.Errorf("cannot find manifest in %s", cmd.RootDir)
+	}
+	issues, err := manifestutil.Verify(mfest, cmd.RootDir)
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+
+	output := make([]verifyIssue, len(issues))
+	for i, issue := range issues {
+		output[i] = verifyIssue{
+			Issue:    issue.Kind,
+			Path:     issue.Path,
+			Expected: issue.Expected,
+			Found:    issue.Found,
+		}
+	}
+	if cmd.Format == "json" {
+		encoder := json.NewEncoder(Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(output)
+	} else {
+		err = yaml.NewEncoder(Stdout).Encode(output)
+	}
+	if err != nil {
+		return fmt.Errorf("internal error: cannot marshal issue list: %s", err)
+	}
+	return fmt.Errorf("%d issues found in %s", len(issues), cmd.RootDir)
+}
@@ -29,3 +29,12 @@ func FakeArchiveOpen(f func(_ *archive.Options) (archive.Archive, error)) (resto
 		archiveOpen = oldArchiveOpen
 	}
 }
+
+var ParseArchiveOverrides = parseArchiveOverrides
+var ParseSliceRefs = parseSliceRefs
+var ParseArchSliceRefs = parseArchSliceRefs
+var ReadPins = readPins
+
+type OpenArchivesOptions = openArchivesOptions
+
+var OpenArchives = openArchives
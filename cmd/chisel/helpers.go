@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/chisel/internal/deb"
 	"github.com/canonical/chisel/internal/setup"
 )
 
@@ -46,7 +52,10 @@ func readReleaseInfo() (label, version string, err error) {
 // * "<name>-<version>",
 // * the path to a directory containing a previously fetched release,
 // * "" and Chisel will attempt to read the release label from the host.
-func obtainRelease(releaseStr string) (release *setup.Release, err error) {
+//
+// When offline is set, a release that must be fetched is only obtained
+// from the cache.
+func obtainRelease(releaseStr string, offline bool) (release *setup.Release, err error) {
 	if strings.Contains(releaseStr, "/") {
 		release, err = setup.ReadRelease(releaseStr)
 	} else {
@@ -62,6 +71,7 @@ func obtainRelease(releaseStr string) (release *setup.Release, err error) {
 		release, err = setup.FetchRelease(&setup.FetchOptions{
 			Label:   label,
 			Version: version,
+			Offline: offline,
 		})
 	}
 	if err != nil {
@@ -69,3 +79,149 @@ func obtainRelease(releaseStr string) (release *setup.Release, err error) {
 	}
 	return release, nil
 }
+
+// parseArchiveOverrides parses values in the form "[<archive>=]<value>" and
+// returns the value to use for each archive in the release. Values without
+// an archive name apply to all archives that are not explicitly named. A
+// value naming an existing directory is never split, even if it holds "=".
+func parseArchiveOverrides(release *setup.Release, values []string) (map[string]string, error) {
+	var fallback string
+	named := make(map[string]string)
+	for _, value := range values {
+		name, rest, found := strings.Cut(value, "=")
+		if !found || strings.ContainsAny(name, "/:") || isDir(value) {
+			fallback = value
+			continue
+		}
+		if _, ok := release.Archives[name]; !ok {
+			return nil, fmt.Errorf("invalid archive override %q: release has no archive %q", value, name)
+		}
+		named[name] = rest
+	}
+	overrides := make(map[string]string)
+	for name := range release.Archives {
+		if value, ok := named[name]; ok {
+			overrides[name] = value
+		} else if fallback != "" {
+			overrides[name] = fallback
+		}
+	}
+	return overrides, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// parseSliceRefs parses slice references in the form "<pkg>_<slice>", with
+// an optional "=<version>" suffix pinning the package version. It returns
+// the slice keys and the pinned version of each package.
+func parseSliceRefs(sliceRefs []string) ([]setup.SliceKey, map[string]string, error) {
+	sliceKeys := make([]setup.SliceKey, len(sliceRefs))
+	pins := make(map[string]string)
+	for i, sliceRef := range sliceRefs {
+		sliceRef, version, hasVersion := strings.Cut(sliceRef, "=")
+		sliceKey, err := setup.ParseSliceKey(sliceRef)
+		if err != nil {
+			return nil, nil, err
+		}
+		sliceKeys[i] = sliceKey
+		if !hasVersion {
+			continue
+		}
+		if !validVersion(version) {
+			return nil, nil, fmt.Errorf("invalid version for package %q: %q", sliceKey.Package, version)
+		}
+		if old, ok := pins[sliceKey.Package]; ok && old != version {
+			return nil, nil, fmt.Errorf("package %q pinned to different versions: %s and %s", sliceKey.Package, old, version)
+		}
+		pins[sliceKey.Package] = version
+	}
+	return sliceKeys, pins, nil
+}
+
+// parseArchSliceRefs parses slice references as parseSliceRefs does, also
+// accepting a package qualified with an architecture, as in
+// "libc6:i386_libs". Unqualified references are selected for all the given
+// architectures, while architectures only named in qualified references are
+// appended to them and get just those slices. It returns the architectures,
+// the slice keys selected for each of them, and the pinned version of each
+// package.
+func parseArchSliceRefs(sliceRefs []string, archs []string) ([]string, map[string][]setup.SliceKey, map[string]string, error) {
+	defaultArchs := archs
+	archs = slices.Clone(archs)
+	plainRefs := make([]string, len(sliceRefs))
+	refArchs := make([]string, len(sliceRefs))
+	for i, sliceRef := range sliceRefs {
+		plainRefs[i] = sliceRef
+		pkgRef, sliceName, ok := strings.Cut(sliceRef, "_")
+		if !ok {
+			continue
+		}
+		pkgName, arch, ok := strings.Cut(pkgRef, ":")
+		if !ok {
+			continue
+		}
+		err := deb.ValidateArch(arch)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid slice reference %q: %v", sliceRef, err)
+		}
+		plainRefs[i] = pkgName + "_" + sliceName
+		refArchs[i] = arch
+		if !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+	}
+	sliceKeys, pins, err := parseSliceRefs(plainRefs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	archKeys := make(map[string][]setup.SliceKey)
+	for i, sliceKey := range sliceKeys {
+		if refArchs[i] != "" {
+			archKeys[refArchs[i]] = append(archKeys[refArchs[i]], sliceKey)
+			continue
+		}
+		for _, arch := range defaultArchs {
+			archKeys[arch] = append(archKeys[arch], sliceKey)
+		}
+	}
+	return archs, archKeys, pins, nil
+}
+
+type yamlPins struct {
+	Packages map[string]string `yaml:"packages"`
+}
+
+// readPins reads the package versions pinned in the file at path, which
+// has the following format:
+//
+//	packages:
+//	  <pkg>: <version>
+func readPins(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pins file: %w", err)
+	}
+	var pins yamlPins
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&pins)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("cannot parse pins file %s: %w", path, err)
+	}
+	for pkg, version := range pins.Packages {
+		if !validVersion(version) {
+			return nil, fmt.Errorf("pins file %s has invalid version for package %q: %q", path, pkg, version)
+		}
+	}
+	if pins.Packages == nil {
+		pins.Packages = make(map[string]string)
+	}
+	return pins.Packages, nil
+}
+
+func validVersion(version string) bool {
+	return version != "" && !strings.ContainsAny(version, " \t\n")
+}
@@ -0,0 +1,212 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	chisel "github.com/canonical/chisel/cmd/chisel"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+var archiveOverridesTests = []struct {
+	summary   string
+	dirs      []string
+	values    []string
+	overrides map[string]string
+	err       string
+}{{
+	summary:   "No values",
+	overrides: map[string]string{},
+}, {
+	summary:   "Value for all archives",
+	values:    []string{"/srv/debs"},
+	overrides: map[string]string{"ubuntu": "/srv/debs", "other": "/srv/debs"},
+}, {
+	summary:   "Value for a named archive",
+	values:    []string{"other=/srv/debs"},
+	overrides: map[string]string{"other": "/srv/debs"},
+}, {
+	summary:   "Named archive takes precedence",
+	values:    []string{"other=/srv/other", "/srv/debs"},
+	overrides: map[string]string{"ubuntu": "/srv/debs", "other": "/srv/other"},
+}, {
+	summary:   "Equals sign in the value",
+	values:    []string{"/srv/a=b"},
+	overrides: map[string]string{"ubuntu": "/srv/a=b", "other": "/srv/a=b"},
+}, {
+	summary:   "Existing relative directory with equals sign",
+	dirs:      []string{"other=debs"},
+	values:    []string{"other=debs"},
+	overrides: map[string]string{"ubuntu": "other=debs", "other": "other=debs"},
+}, {
+	summary: "Unknown archive",
+	values:  []string{"foo=/srv/debs"},
+	err:     `invalid archive override "foo=/srv/debs": release has no archive "foo"`,
+}}
+
+func (s *ChiselSuite) TestParseArchiveOverrides(c *C) {
+	release := &setup.Release{
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {Name: "ubuntu"},
+			"other":  {Name: "other"},
+		},
+	}
+	oldDir, err := os.Getwd()
+	c.Assert(err, IsNil)
+	defer os.Chdir(oldDir)
+	for _, test := range archiveOverridesTests {
+		c.Logf("Summary: %s", test.summary)
+		err := os.Chdir(c.MkDir())
+		c.Assert(err, IsNil)
+		for _, dir := range test.dirs {
+			c.Assert(os.Mkdir(dir, 0755), IsNil)
+		}
+		overrides, err := chisel.ParseArchiveOverrides(release, test.values)
+		if test.err != "" {
+			c.Assert(err, ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(overrides, DeepEquals, test.overrides)
+	}
+}
+
+var sliceRefsTests = []struct {
+	summary   string
+	refs      []string
+	sliceKeys []setup.SliceKey
+	pins      map[string]string
+	err       string
+}{{
+	summary:   "Slices without versions",
+	refs:      []string{"mypkg_myslice", "otherpkg_otherslice"},
+	sliceKeys: []setup.SliceKey{{"mypkg", "myslice"}, {"otherpkg", "otherslice"}},
+	pins:      map[string]string{},
+}, {
+	summary:   "Slices with versions",
+	refs:      []string{"mypkg_myslice=1:2.35-0ubuntu3.8", "mypkg_other=1:2.35-0ubuntu3.8", "otherpkg_otherslice"},
+	sliceKeys: []setup.SliceKey{{"mypkg", "myslice"}, {"mypkg", "other"}, {"otherpkg", "otherslice"}},
+	pins:      map[string]string{"mypkg": "1:2.35-0ubuntu3.8"},
+}, {
+	summary: "Conflicting versions",
+	refs:    []string{"mypkg_myslice=1.0", "mypkg_other=2.0"},
+	err:     `package "mypkg" pinned to different versions: 1.0 and 2.0`,
+}, {
+	summary: "Empty version",
+	refs:    []string{"mypkg_myslice="},
+	err:     `invalid version for package "mypkg": ""`,
+}, {
+	summary: "Invalid slice name",
+	refs:    []string{"mypkg=1.0"},
+	err:     `invalid slice reference: "mypkg"`,
+}}
+
+func (s *ChiselSuite) TestParseSliceRefs(c *C) {
+	for _, test := range sliceRefsTests {
+		c.Logf("Summary: %s", test.summary)
+		sliceKeys, pins, err := chisel.ParseSliceRefs(test.refs)
+		if test.err != "" {
+			c.Assert(err, ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(sliceKeys, DeepEquals, test.sliceKeys)
+		c.Assert(pins, DeepEquals, test.pins)
+	}
+}
+
+var archSliceRefsTests = []struct {
+	summary   string
+	refs      []string
+	archs     []string
+	outArchs  []string
+	sliceKeys map[string][]setup.SliceKey
+	pins      map[string]string
+	err       string
+}{{
+	summary:  "Unqualified slices",
+	refs:     []string{"mypkg_myslice", "otherpkg_otherslice"},
+	archs:    []string{"amd64", "i386"},
+	outArchs: []string{"amd64", "i386"},
+	sliceKeys: map[string][]setup.SliceKey{
+		"amd64": {{"mypkg", "myslice"}, {"otherpkg", "otherslice"}},
+		"i386":  {{"mypkg", "myslice"}, {"otherpkg", "otherslice"}},
+	},
+	pins: map[string]string{},
+}, {
+	summary:  "Qualified slices",
+	refs:     []string{"mypkg:i386_myslice=1:2.0", "otherpkg_otherslice", "mypkg:amd64_other"},
+	archs:    []string{"amd64"},
+	outArchs: []string{"amd64", "i386"},
+	sliceKeys: map[string][]setup.SliceKey{
+		"amd64": {{"otherpkg", "otherslice"}, {"mypkg", "other"}},
+		"i386":  {{"mypkg", "myslice"}},
+	},
+	pins: map[string]string{"mypkg": "1:2.0"},
+}, {
+	summary: "Invalid architecture",
+	refs:    []string{"mypkg:foo_myslice"},
+	archs:   []string{"amd64"},
+	err:     `invalid slice reference "mypkg:foo_myslice": invalid package architecture: foo`,
+}, {
+	summary: "Invalid slice name",
+	refs:    []string{"mypkg:i386"},
+	archs:   []string{"amd64"},
+	err:     `invalid slice reference: "mypkg:i386"`,
+}}
+
+func (s *ChiselSuite) TestParseArchSliceRefs(c *C) {
+	for _, test := range archSliceRefsTests {
+		c.Logf("Summary: %s", test.summary)
+		archs, sliceKeys, pins, err := chisel.ParseArchSliceRefs(test.refs, test.archs)
+		if test.err != "" {
+			c.Assert(err, ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(archs, DeepEquals, test.outArchs)
+		c.Assert(sliceKeys, DeepEquals, test.sliceKeys)
+		c.Assert(pins, DeepEquals, test.pins)
+	}
+}
+
+var readPinsTests = []struct {
+	summary string
+	content string
+	pins    map[string]string
+	err     string
+}{{
+	summary: "Pinned packages",
+	content: "packages:\n  mypkg: 1.0\n  otherpkg: 1:2.0-1ubuntu1\n",
+	pins:    map[string]string{"mypkg": "1.0", "otherpkg": "1:2.0-1ubuntu1"},
+}, {
+	summary: "Empty file",
+	content: "",
+	pins:    map[string]string{},
+}, {
+	summary: "Unknown field",
+	content: "foo: bar\n",
+	err:     `cannot parse pins file .*: yaml: unmarshal errors:\n  line 1: field foo not found in type main.yamlPins`,
+}, {
+	summary: "Invalid version",
+	content: "packages:\n  mypkg: ''\n",
+	err:     `pins file .* has invalid version for package "mypkg": ""`,
+}}
+
+func (s *ChiselSuite) TestReadPins(c *C) {
+	for _, test := range readPinsTests {
+		c.Logf("Summary: %s", test.summary)
+		path := filepath.Join(c.MkDir(), "pins.yaml")
+		err := os.WriteFile(path, []byte(test.content), 0644)
+		c.Assert(err, IsNil)
+		pins, err := chisel.ReadPins(path)
+		if test.err != "" {
+			c.Assert(err, ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(pins, DeepEquals, test.pins)
+	}
+}
@@ -58,8 +58,9 @@ type cmdInfo struct {
 // commands holds information about all non-debug commands.
 var commands []*cmdInfo
 
-// debugCommands holds information about all debug commands.
-var debugCommands []*cmdInfo
+// commandGroups holds information about the sub-commands of the commands
+// grouping them, such as "debug", indexed by the name of the parent command.
+var commandGroups = make(map[string][]*cmdInfo)
 
 // addCommand replaces parser.addCommand() in a way that is compatible with
 // re-constructing a pristine parser.
@@ -76,10 +77,10 @@ func addCommand(name, shortHelp, longHelp string, builder func() flags.Commander
 	return info
 }
 
-// addDebugCommand replaces parser.addCommand() in a way that is
+// addCommandGroup replaces parser.addCommand() in a way that is
 // compatible with re-constructing a pristine parser. It is meant for
-// adding debug commands.
-func addDebugCommand(name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
+// adding sub-commands to the parent command grouping them, such as "debug".
+func addCommandGroup(parent, name, shortHelp, longHelp string, builder func() flags.Commander, optDescs map[string]string, argDescs []argDesc) *cmdInfo {
 	info := &cmdInfo{
 		name:      name,
 		shortHelp: shortHelp,
@@ -88,7 +89,7 @@ func addDebugCommand(name, shortHelp, longHelp string, builder func() flags.Comm
 		optDescs:  optDescs,
 		argDescs:  argDescs,
 	}
-	debugCommands = append(debugCommands, info)
+	commandGroups[parent] = append(commandGroups[parent], info)
 	return info
 }
 
@@ -234,6 +235,18 @@ func Parser() *flags.Parser {
 			c.extra(cmd)
 		}
 	}
+	// Add the cache command
+	cacheCommand, err := parser.AddCommand("cache", shortCacheHelp, strings.TrimSpace(longCacheHelp), &cmdCache{})
+	if err != nil {
+		panicf("cannot add command %q: %v", "cache", err)
+	}
+	addSubCommands(cacheCommand, commandGroups["cache"])
+	// Add the manifest command
+	manifestCommand, err := parser.AddCommand("manifest", shortManifestHelp, strings.TrimSpace(longManifestHelp), &cmdManifest{})
+	if err != nil {
+		panicf("cannot add command %q: %v", "manifest", err)
+	}
+	addSubCommands(manifestCommand, commandGroups["manifest"])
 	// Add the debug command
 	debugCommand, err := parser.AddCommand("debug", shortDebugHelp, longDebugHelp, &cmdDebug{})
 	debugCommand.Hidden = true
@@ -241,14 +254,20 @@ func Parser() *flags.Parser {
 		panicf("cannot add command %q: %v", "debug", err)
 	}
 	// Add all the sub-commands of the debug command
-	for _, c := range debugCommands {
+	addSubCommands(debugCommand, commandGroups["debug"])
+	return parser
+}
+
+// addSubCommands adds the given commands as sub-commands of parent.
+func addSubCommands(parent *flags.Command, infos []*cmdInfo) {
+	for _, c := range infos {
 		obj := c.builder()
 		//if x, ok := obj.(clientSetter); ok {
 		//	x.setClient(cli)
 		//}
-		cmd, err := debugCommand.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), obj)
+		cmd, err := parent.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), obj)
 		if err != nil {
-			panicf("cannot add debug command %q: %v", c.name, err)
+			panicf("cannot add %s command %q: %v", parent.Name, c.name, err)
 		}
 		cmd.Hidden = c.hidden
 		opts := cmd.Options()
@@ -286,7 +305,6 @@ func Parser() *flags.Parser {
 			arg.Description = desc
 		}
 	}
-	return parser
 }
 
 var (
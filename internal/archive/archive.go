@@ -2,27 +2,56 @@ package archive
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/crypto/openpgp/packet"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 
 	"github.com/canonical/chisel/internal/cache"
 	"github.com/canonical/chisel/internal/control"
 	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/httputil"
 	"github.com/canonical/chisel/internal/pgputil"
 )
 
+// Archive provides access to the packages of an archive. The version
+// passed to Fetch and Info selects a specific package version, while an
+// empty version selects the newest one available.
 type Archive interface {
 	Options() *Options
-	Fetch(pkg string) (io.ReadSeekCloser, *PackageInfo, error)
+	Fetch(pkg, version string) (io.ReadSeekCloser, *PackageInfo, error)
 	Exists(pkg string) bool
-	Info(pkg string) (*PackageInfo, error)
+	Info(pkg, version string) (*PackageInfo, error)
+	// Verifications returns how the release file of each suite was
+	// verified when the archive was opened.
+	Verifications() []*Verification
+}
+
+// Verification describes the signature which verified the release file of
+// a suite.
+type Verification struct {
+	Suite string
+	// File is either "InRelease" or "Release".
+	File  string
+	KeyID string
+	// KeyAlgorithm holds the public key algorithm and the key size in
+	// bits, as in "rsa 4096".
+	KeyAlgorithm string
+	Hash         string
 }
 
 type PackageInfo struct {
@@ -30,6 +59,13 @@ type PackageInfo struct {
 	Version string
 	Arch    string
 	SHA256  string
+
+	// The following fields are read from the control data of the package
+	// once fetched, and may be unset otherwise.
+	Source        string
+	InstalledSize uint64
+	Depends       string
+	Homepage      string
 }
 
 type Options struct {
@@ -40,12 +76,71 @@ type Options struct {
 	Components []string
 	Pro        string
 	CacheDir   string
-	PubKeys    []*packet.PublicKey
+	PubKeys    []*pgputil.PublicKey
 	// Maintained is set when the archive is still being updated.
 	Maintained bool
 	// OldRelease is set for Ubuntu releases which are moved from the regular
 	// archive which happens after the release's end of life date.
 	OldRelease bool
+	// Dir is set for archives served from a local directory. The directory
+	// holds either a mirror tree with dists/ and pool/, or a flat collection
+	// of .deb files.
+	Dir string
+	// URL and PortsURL replace the default archive location. PortsURL is
+	// used for architectures other than amd64 and i386 when set.
+	URL      string
+	PortsURL string
+	// ReleaseLabel is the Label expected in the InRelease file. It defaults
+	// to "Ubuntu", or to the label of the Pro archive.
+	ReleaseLabel string
+	// Jobs is the maximum number of indexes fetched concurrently. Indexes
+	// are fetched one at a time if unset.
+	Jobs int
+	// Retries is the number of times a failed download is retried, waiting
+	// exponentially longer between attempts. Interrupted downloads resume
+	// from where they stopped when the server supports it.
+	Retries int
+	// Snapshot is the timestamp, in SnapshotFormat, of the point in time
+	// from which packages are obtained. The latest packages are used if
+	// unset.
+	Snapshot string
+	// Offline is set to use exclusively the data available in the cache,
+	// starting from the InRelease file last verified for each suite.
+	Offline bool
+	// SignaturePolicy restricts the algorithms accepted when verifying the
+	// archive signatures. pgputil.DefaultPolicy is used if nil.
+	SignaturePolicy *pgputil.Policy
+}
+
+// MissingError is returned when working offline and some of the data
+// required is not available in the cache.
+type MissingError struct {
+	Missing []string
+}
+
+func (e *MissingError) Error() string {
+	return "cannot work offline, missing from cache:\n- " + strings.Join(e.Missing, "\n- ")
+}
+
+// JoinMissing returns the first error in errs that is not a *MissingError,
+// if any, or otherwise a single *MissingError listing everything reported
+// as missing by all of them. It returns nil if all errors are nil.
+func JoinMissing(errs []error) error {
+	var missing []string
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		missingErr, ok := err.(*MissingError)
+		if !ok {
+			return err
+		}
+		missing = append(missing, missingErr.Missing...)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &MissingError{Missing: missing}
 }
 
 func Open(options *Options) (Archive, error) {
@@ -58,35 +153,63 @@ func Open(options *Options) (Archive, error) {
 	if err != nil {
 		return nil, err
 	}
+	if options.Dir != "" && options.Snapshot != "" {
+		return nil, fmt.Errorf("snapshots are not supported for local archives")
+	}
+	if options.Dir != "" && !isMirrorDir(options.Dir) {
+		return openLocal(options)
+	}
 	return openUbuntu(options)
 }
 
 type fetchFlags uint
 
 const (
-	fetchBulk    fetchFlags = 1 << iota
+	fetchBulk fetchFlags = 1 << iota
+	// fetchVerify checks the content of cached data against its digest,
+	// fetching it again if it does not match.
+	fetchVerify
 	fetchDefault fetchFlags = 0
 )
 
-var httpClient = &http.Client{
-	Timeout: 30 * time.Second,
-}
+var (
+	clientsOnce sync.Once
+	clientsErr  error
+	httpClient  *http.Client
+	bulkClient  *http.Client
+)
 
-var httpDo = httpClient.Do
+// setupClients creates the HTTP clients on first use, so that errors in the
+// configuration from the environment are reported when opening the archive.
+func setupClients() error {
+	clientsOnce.Do(func() {
+		httpClient, clientsErr = httputil.NewClient(30 * time.Second)
+		if clientsErr == nil {
+			bulkClient, clientsErr = httputil.NewClient(5 * time.Minute)
+		}
+	})
+	return clientsErr
+}
 
-var bulkClient = &http.Client{
-	Timeout: 5 * time.Minute,
+var httpDo = func(req *http.Request) (*http.Response, error) {
+	return httpClient.Do(req)
 }
 
-var bulkDo = bulkClient.Do
+var bulkDo = func(req *http.Request) (*http.Response, error) {
+	return bulkClient.Do(req)
+}
 
 type ubuntuArchive struct {
 	options Options
 	indexes []*ubuntuIndex
 	cache   *cache.Cache
-	pubKeys []*packet.PublicKey
+	pubKeys []*pgputil.PublicKey
 	baseURL string
 	creds   *credentials
+	// offline is set when data must not be fetched from the network.
+	offline bool
+
+	verifications []*Verification
 }
 
 type ubuntuIndex struct {
@@ -104,40 +227,50 @@ func (a *ubuntuArchive) Options() *Options {
 	return &a.options
 }
 
+func (a *ubuntuArchive) Verifications() []*Verification {
+	return a.verifications
+}
+
 func (a *ubuntuArchive) Exists(pkg string) bool {
-	_, _, err := a.selectPackage(pkg)
+	_, _, err := a.selectPackage(pkg, "")
 	return err == nil
 }
 
-func (a *ubuntuArchive) selectPackage(pkg string) (control.Section, *ubuntuIndex, error) {
+func (a *ubuntuArchive) selectPackage(pkg, version string) (control.Section, *ubuntuIndex, error) {
 	var selectedVersion string
 	var selectedSection control.Section
 	var selectedIndex *ubuntuIndex
 	for _, index := range a.indexes {
 		section := index.packages.Section(pkg)
 		if section != nil && section.Get("Filename") != "" {
-			version := section.Get("Version")
-			if selectedVersion == "" || deb.CompareVersions(selectedVersion, version) < 0 {
-				selectedVersion = version
+			sectionVersion := section.Get("Version")
+			if version != "" && sectionVersion != version {
+				continue
+			}
+			if selectedVersion == "" || deb.CompareVersions(selectedVersion, sectionVersion) < 0 {
+				selectedVersion = sectionVersion
 				selectedSection = section
 				selectedIndex = index
 			}
 		}
 	}
 	if selectedVersion == "" {
+		if version != "" {
+			return nil, nil, fmt.Errorf("cannot find package %q version %s in archive", pkg, version)
+		}
 		return nil, nil, fmt.Errorf("cannot find package %q in archive", pkg)
 	}
 	return selectedSection, selectedIndex, nil
 }
 
-func (a *ubuntuArchive) Fetch(pkg string) (io.ReadSeekCloser, *PackageInfo, error) {
-	section, index, err := a.selectPackage(pkg)
+func (a *ubuntuArchive) Fetch(pkg, version string) (io.ReadSeekCloser, *PackageInfo, error) {
+	section, index, err := a.selectPackage(pkg, version)
 	if err != nil {
 		return nil, nil, err
 	}
 	path := section.Get("Filename")
 	logf("Fetching %s...", path)
-	reader, err := index.fetch(path, section.Get("SHA256"), fetchBulk)
+	reader, err := index.fetch(path, section.Get("SHA256"), "", fetchBulk|fetchVerify)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -145,8 +278,8 @@ func (a *ubuntuArchive) Fetch(pkg string) (io.ReadSeekCloser, *PackageInfo, erro
 	return reader, info, nil
 }
 
-func (a *ubuntuArchive) Info(pkg string) (*PackageInfo, error) {
-	section, _, err := a.selectPackage(pkg)
+func (a *ubuntuArchive) Info(pkg, version string) (*PackageInfo, error) {
+	section, _, err := a.selectPackage(pkg, version)
 	if err != nil {
 		return nil, err
 	}
@@ -186,13 +319,84 @@ var proArchiveInfo = map[string]struct {
 	},
 }
 
-func archiveURL(pro, arch string, oldRelease bool) (string, *credentials, error) {
+// SnapshotFormat is the layout of the timestamps identifying archive
+// snapshots, as used by snapshot.ubuntu.com.
+const SnapshotFormat = "20060102T150405Z"
+
+const ubuntuSnapshotURL = "https://snapshot.ubuntu.com/ubuntu/"
+const ubuntuPortsSnapshotURL = "https://snapshot.ubuntu.com/ubuntu-ports/"
+
+// snapshotURL returns the URL of the archive as it was at the point in time
+// set in the Snapshot option.
+func snapshotURL(options *Options) (string, *credentials, error) {
+	if _, err := time.Parse(SnapshotFormat, options.Snapshot); err != nil {
+		return "", nil, fmt.Errorf("invalid snapshot timestamp: %q", options.Snapshot)
+	}
+	if options.Pro != "" {
+		return "", nil, fmt.Errorf("snapshots are not supported for pro archives")
+	}
+
+	var baseURL string
+	var creds *credentials
+	if options.URL != "" {
+		latest := *options
+		latest.Snapshot = ""
+		var err error
+		baseURL, creds, err = archiveURL(&latest)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if options.Arch == "amd64" || options.Arch == "i386" {
+		baseURL = ubuntuSnapshotURL
+	} else {
+		baseURL = ubuntuPortsSnapshotURL
+	}
+	url, err := url.JoinPath(baseURL, options.Snapshot)
+	if err != nil {
+		return "", nil, fmt.Errorf("internal error: cannot construct URL: %v", err)
+	}
+	return url + "/", creds, nil
+}
+
+func archiveURL(options *Options) (string, *credentials, error) {
+	if options.Snapshot != "" {
+		return snapshotURL(options)
+	}
+
+	if options.Dir != "" {
+		dir, err := filepath.Abs(options.Dir)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot obtain archive directory: %w", err)
+		}
+		url := &url.URL{Scheme: "file", Path: dir + "/"}
+		return url.String(), nil, nil
+	}
+
+	pro, arch, oldRelease := options.Pro, options.Arch, options.OldRelease
 	if pro != "" {
-		archiveInfo, ok := proArchiveInfo[pro]
-		if !ok {
+		if _, ok := proArchiveInfo[pro]; !ok {
 			return "", nil, fmt.Errorf("invalid pro value: %q", pro)
 		}
-		url := archiveInfo.BaseURL
+	}
+
+	if options.URL != "" {
+		url := options.URL
+		if options.PortsURL != "" && arch != "amd64" && arch != "i386" {
+			url = options.PortsURL
+		}
+		// Mirrors and proxies might not require credentials even for
+		// Pro archives, so they are only used when available.
+		creds, err := findCredentials(url)
+		if err == ErrCredentialsNotFound {
+			creds = nil
+		} else if err != nil {
+			return "", nil, err
+		}
+		return url, creds, nil
+	}
+
+	if pro != "" {
+		url := proArchiveInfo[pro].BaseURL
 		creds, err := findCredentials(url)
 		if err != nil {
 			return "", nil, err
@@ -221,10 +425,17 @@ func openUbuntu(options *Options) (Archive, error) {
 		return nil, fmt.Errorf("archive options missing version")
 	}
 
-	baseURL, creds, err := archiveURL(options.Pro, options.Arch, options.OldRelease)
+	baseURL, creds, err := archiveURL(options)
 	if err != nil {
 		return nil, err
 	}
+	offline := options.Offline && !strings.HasPrefix(baseURL, "file:")
+	if !strings.HasPrefix(baseURL, "file:") && !offline {
+		err = setupClients()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	archive := &ubuntuArchive{
 		options: *options,
@@ -234,8 +445,10 @@ func openUbuntu(options *Options) (Archive, error) {
 		pubKeys: options.PubKeys,
 		baseURL: baseURL,
 		creds:   creds,
+		offline: offline,
 	}
 
+	var missing []error
 	for _, suite := range options.Suites {
 		var release control.Section
 		for _, component := range options.Components {
@@ -250,7 +463,11 @@ func openUbuntu(options *Options) (Archive, error) {
 			}
 			if release == nil {
 				err := index.fetchRelease()
-				if err != nil {
+				if _, ok := err.(*MissingError); ok {
+					// Report everything else missing as well.
+					missing = append(missing, err)
+					break
+				} else if err != nil {
 					return nil, err
 				}
 				release = index.release
@@ -264,28 +481,131 @@ func openUbuntu(options *Options) (Archive, error) {
 					return nil, err
 				}
 			}
-			err := index.fetchIndex()
-			if err != nil {
-				return nil, err
-			}
 			archive.indexes = append(archive.indexes, index)
 		}
 	}
 
+	err = fetchIndexes(archive.indexes, options.Jobs)
+	err = JoinMissing(append(missing, err))
+	if err != nil {
+		return nil, err
+	}
+
 	return archive, nil
 }
 
+// fetchIndexes fetches the package indexes, running up to jobs fetches
+// concurrently. If any fetch fails, the first error in the order of indexes
+// is returned, except that indexes missing from the cache when working
+// offline are all reported together.
+func fetchIndexes(indexes []*ubuntuIndex, jobs int) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	errs := make([]error, len(indexes))
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	sem := make(chan struct{}, jobs)
+	for i, index := range indexes {
+		sem <- struct{}{}
+		if failed.Load() {
+			// Do not start new fetches once one has failed.
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = index.fetchIndex()
+			if _, ok := errs[i].(*MissingError); errs[i] != nil && !ok {
+				failed.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return JoinMissing(errs)
+}
+
 func (index *ubuntuIndex) fetchRelease() error {
 	logf("Fetching %s %s %s suite details...", index.displayName(), index.version, index.suite)
-	reader, err := index.fetch(index.distPath("InRelease"), "", fetchDefault)
-	if err != nil {
+	// Some archives do not publish the InRelease file, but only the Release
+	// file along with its detached signature in the Release.gpg file.
+	fileName := "InRelease"
+	fetched := make(map[string][]byte)
+	body, verified, err := index.fetchInRelease(fetched)
+	var notFound *notFoundError
+	if err == cache.ErrMiss || errors.As(err, &notFound) {
+		fileName = "Release"
+		body, verified, err = index.fetchDetachedRelease(fetched)
+	}
+	if err == cache.ErrMiss {
+		// Both the InRelease file and the detached signature were tried.
+		return &MissingError{Missing: []string{fmt.Sprintf("verified InRelease, or Release and Release.gpg, for %s %s %s suite",
+			index.displayName(), index.version, index.suite)}}
+	} else if err != nil {
 		return err
 	}
-	defer reader.Close()
 
-	data, err := io.ReadAll(reader)
+	ctrl, err := control.ParseString("Label", body)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot parse %s file: %v", fileName, err)
+	}
+	// Parse the appropriate section for the type of archive.
+	label := index.archive.options.ReleaseLabel
+	if label == "" {
+		label = "Ubuntu"
+		if index.archive.options.Pro != "" {
+			label = proArchiveInfo[index.archive.options.Pro].Label
+		}
+	}
+	section := ctrl.Section(label)
+	if section == nil {
+		return fmt.Errorf("corrupted archive %s file: no %s section", fileName, label)
+	}
+	logf("Release date: %s", section.Get("Date"))
+
+	// Snapshots are expected to be old, and so is the data available
+	// when offline.
+	if index.archive.options.Snapshot == "" && !index.archive.offline {
+		err = checkValidUntil(fileName, section)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !index.archive.offline {
+		for name, data := range fetched {
+			sum := sha256.Sum256(data)
+			err = index.archive.cache.SetRef(index.refName(name), hex.EncodeToString(sum[:]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	index.release = section
+	index.archive.verifications = append(index.archive.verifications, &Verification{
+		Suite:        index.suite,
+		File:         fileName,
+		KeyID:        verified.Key.KeyIdString(),
+		KeyAlgorithm: verified.KeyAlgorithm(),
+		Hash:         verified.Hash(),
+	})
+	return nil
+}
+
+// fetchInRelease fetches the InRelease file and verifies its signatures,
+// returning the signed body and the signature which verified it. The
+// fetched file is recorded in fetched.
+func (index *ubuntuIndex) fetchInRelease(fetched map[string][]byte) (string, *pgputil.Verified, error) {
+	data, err := index.fetchRef("InRelease")
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Decode the signature(s) and verify the InRelease file. The InRelease
@@ -296,35 +616,105 @@ func (index *ubuntuIndex) fetchRelease() error {
 	// https://salsa.debian.org/apt-team/apt/-/blob/4e344a4/methods/gpgv.cc#L553-557
 	sigs, canonicalBody, err := pgputil.DecodeClearSigned(data)
 	if err != nil {
-		return fmt.Errorf("cannot decode clearsigned InRelease file: %v", err)
+		return "", nil, fmt.Errorf("cannot decode clearsigned InRelease file: %v", err)
 	}
-	err = pgputil.VerifyAnySignature(index.archive.pubKeys, sigs, canonicalBody)
+	verified, err := index.signaturePolicy().VerifyAnySignature(index.archive.pubKeys, sigs, canonicalBody)
 	if err != nil {
-		return fmt.Errorf("cannot verify signature of the InRelease file")
+		return "", nil, fmt.Errorf("cannot verify signature of the InRelease file: %v", err)
 	}
+	logf("InRelease file verified by %s", verified)
+	fetched["InRelease"] = data
 
 	// canonicalBody has <CR><LF> line endings, reverting that to match the
 	// expected control file format.
-	body := strings.ReplaceAll(string(canonicalBody), "\r", "")
-	ctrl, err := control.ParseString("Label", body)
+	return strings.ReplaceAll(string(canonicalBody), "\r", ""), verified, nil
+}
+
+// fetchDetachedRelease fetches the Release file and verifies it against the
+// signatures in the Release.gpg file, returning the signed body and the
+// signature which verified it. The fetched files are recorded in fetched.
+func (index *ubuntuIndex) fetchDetachedRelease(fetched map[string][]byte) (string, *pgputil.Verified, error) {
+	data, err := index.fetchRef("Release")
 	if err != nil {
-		return fmt.Errorf("cannot parse InRelease file: %v", err)
+		return "", nil, err
 	}
-	// Parse the appropriate section for the type of archive.
-	label := "Ubuntu"
-	if index.archive.options.Pro != "" {
-		label = proArchiveInfo[index.archive.options.Pro].Label
+	sigData, err := index.fetchRef("Release.gpg")
+	if err != nil {
+		return "", nil, err
 	}
-	section := ctrl.Section(label)
-	if section == nil {
-		return fmt.Errorf("corrupted archive InRelease file: no %s section", label)
+
+	// As with the InRelease file, a single valid signature is enough.
+	sigs, err := pgputil.DecodeSignatures(sigData)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot decode Release.gpg file: %v", err)
 	}
-	logf("Release date: %s", section.Get("Date"))
+	verified, err := index.signaturePolicy().VerifyAnySignature(index.archive.pubKeys, sigs, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot verify signature of the Release file: %v", err)
+	}
+	logf("Release file verified by %s", verified)
+	fetched["Release"] = data
+	fetched["Release.gpg"] = sigData
+	return string(data), verified, nil
+}
 
-	index.release = section
+// fetchRef fetches the named file of the suite, which cannot be known by
+// its digest in advance. When offline, the digest recorded the last time
+// the file was verified is used instead, and cache.ErrMiss is returned if
+// there is none.
+func (index *ubuntuIndex) fetchRef(name string) ([]byte, error) {
+	var digest string
+	if index.archive.offline {
+		var err error
+		digest, err = index.archive.cache.Ref(index.refName(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	reader, err := index.fetch(index.distPath(name), digest, "", fetchDefault)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (index *ubuntuIndex) signaturePolicy() *pgputil.Policy {
+	if index.archive.options.SignaturePolicy != nil {
+		return index.archive.options.SignaturePolicy
+	}
+	return pgputil.DefaultPolicy
+}
+
+func (index *ubuntuIndex) refName(name string) string {
+	return index.archive.baseURL + index.distPath(name)
+}
+
+// checkValidUntil returns an error if the Valid-Until date of the release
+// has passed, which protects against attacks replaying old releases or
+// preventing updates from being seen.
+func checkValidUntil(fileName string, section control.Section) error {
+	value := section.Get("Valid-Until")
+	if value == "" {
+		return nil
+	}
+	validUntil, err := time.Parse(time.RFC1123, value)
+	if err != nil {
+		validUntil, err = time.Parse(time.RFC1123Z, value)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse Valid-Until field of %s file: %q", fileName, value)
+	}
+	if time.Now().After(validUntil) {
+		return fmt.Errorf("%s file expired on %s", fileName, value)
+	}
 	return nil
 }
 
+// indexFormats lists the compression formats supported for package
+// indexes, in order of preference.
+var indexFormats = []string{".gz", ".xz", ".zst"}
+
 func (index *ubuntuIndex) fetchIndex() error {
 	digests := index.release.Get("SHA256")
 	packagesPath := fmt.Sprintf("%s/binary-%s/Packages", index.component, index.arch)
@@ -333,8 +723,24 @@ func (index *ubuntuIndex) fetchIndex() error {
 		return fmt.Errorf("%s is missing from %s %s component digests", packagesPath, index.suite, index.component)
 	}
 
+	var format, formatDigest string
+	for _, format = range indexFormats {
+		formatDigest, _, _ = control.ParsePathInfo(digests, packagesPath+format)
+		if formatDigest != "" {
+			break
+		}
+	}
+	if formatDigest == "" {
+		return fmt.Errorf("%s is missing from %s %s component digests in a supported format", packagesPath, index.suite, index.component)
+	}
+	fetchPath := packagesPath + format
+	if index.release.Get("Acquire-By-Hash") == "yes" {
+		// Fetching by digest avoids races with archive updates.
+		fetchPath = path.Join(path.Dir(packagesPath), "by-hash", "SHA256", formatDigest)
+	}
+
 	logf("Fetching index for %s %s %s %s component...", index.displayName(), index.version, index.suite, index.component)
-	reader, err := index.fetch(index.distPath(packagesPath+".gz"), digest, fetchBulk)
+	reader, err := index.fetch(index.distPath(fetchPath), digest, format, fetchBulk)
 	if err != nil {
 		return err
 	}
@@ -373,51 +779,45 @@ func (index *ubuntuIndex) distPath(suffix string) string {
 	return "dists/" + index.suite + "/" + suffix
 }
 
-func (index *ubuntuIndex) fetch(path, digest string, flags fetchFlags) (io.ReadSeekCloser, error) {
-	reader, err := index.archive.cache.Open(digest)
+// fetch returns the data at path, decompressed according to format, which
+// is either empty or one of indexFormats.
+func (index *ubuntuIndex) fetch(path, digest, format string, flags fetchFlags) (io.ReadSeekCloser, error) {
+	open := index.archive.cache.Open
+	if flags&fetchVerify != 0 {
+		open = index.archive.cache.OpenVerified
+	}
+	reader, err := open(digest)
 	if err == nil {
 		return reader, nil
 	} else if err != cache.ErrMiss {
 		return nil, err
 	}
-
-	cleanURL, err := url.JoinPath(index.archive.baseURL, path)
-	if err != nil {
-		return nil, fmt.Errorf("internal error: cannot construct URL: %v", err)
+	if index.archive.offline {
+		return nil, &MissingError{Missing: []string{fmt.Sprintf("sha256:%s (%s)", digest, path)}}
 	}
-	req, err := http.NewRequest("GET", cleanURL, nil)
+
+	// Other processes sharing the cache may be fetching the same data, so
+	// wait for them and use their result when possible.
+	unlock, err := index.archive.cache.Lock(digest)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create HTTP request: %v", err)
-	}
-	creds := index.archive.creds
-	if creds != nil && !creds.Empty() {
-		req.SetBasicAuth(creds.Username, creds.Password)
-	}
-	var resp *http.Response
-	if flags&fetchBulk != 0 {
-		resp, err = bulkDo(req)
-	} else {
-		resp, err = httpDo(req)
+		return nil, err
 	}
-	if err != nil {
-		return nil, fmt.Errorf("cannot talk to archive: %v", err)
+	defer unlock()
+	reader, err = open(digest)
+	if err == nil {
+		return reader, nil
+	} else if err != cache.ErrMiss {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	switch resp.StatusCode {
-	case 200:
-		// ok
-	case 401:
-		return nil, fmt.Errorf("cannot fetch from %q: unauthorized", index.label)
-	case 404:
-		return nil, fmt.Errorf("cannot find archive data")
-	default:
-		return nil, fmt.Errorf("error from archive: %v", resp.Status)
+	body, err := index.open(path, flags)
+	if err != nil {
+		return nil, err
 	}
+	defer body.Close()
 
-	body := resp.Body
-	if strings.HasSuffix(path, ".gz") {
-		reader, err := gzip.NewReader(body)
+	if format != "" {
+		reader, err := decompress(body, format)
 		if err != nil {
 			return nil, fmt.Errorf("cannot decompress data: %v", err)
 		}
@@ -436,7 +836,52 @@ func (index *ubuntuIndex) fetch(path, digest string, flags fetchFlags) (io.ReadS
 		return nil, fmt.Errorf("cannot fetch from archive: %v", err)
 	}
 
-	return index.archive.cache.Open(writer.Digest())
+	return writer.Open()
+}
+
+func decompress(reader io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case ".gz":
+		return gzip.NewReader(reader)
+	case ".xz":
+		xzReader, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case ".zst":
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("internal error: unknown compression format %q", format)
+}
+
+// open returns the content of the file at path relative to the archive base
+// URL, either by reading it from disk for local archives or by issuing the
+// HTTP request.
+func (index *ubuntuIndex) open(path string, flags fetchFlags) (io.ReadCloser, error) {
+	cleanURL, err := url.JoinPath(index.archive.baseURL, path)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot construct URL: %v", err)
+	}
+	if strings.HasPrefix(cleanURL, "file:") {
+		fileURL, err := url.Parse(cleanURL)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: cannot parse URL: %v", err)
+		}
+		file, err := os.Open(fileURL.Path)
+		if os.IsNotExist(err) {
+			return nil, &notFoundError{cleanURL}
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read archive data: %v", err)
+		}
+		return file, nil
+	}
+
+	return openHTTP(index, cleanURL, flags)
 }
 
 func sectionPackageInfo(section control.Section) *PackageInfo {
@@ -4,21 +4,29 @@ import (
 	"golang.org/x/crypto/openpgp/packet"
 	. "gopkg.in/check.v1"
 
+	"crypto/sha256"
 	"debug/elf"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/archive/testarchive"
+	"github.com/canonical/chisel/internal/cache"
 	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/pgputil"
 	"github.com/canonical/chisel/internal/testutil"
 )
 
@@ -34,7 +42,7 @@ type httpSuite struct {
 	status    int
 	restore   func()
 	privKey   *packet.PrivateKey
-	pubKey    *packet.PublicKey
+	pubKey    *pgputil.PublicKey
 }
 
 var _ = Suite(&httpSuite{})
@@ -108,7 +116,7 @@ func (s *httpSuite) TestDoError(c *C) {
 	}
 
 	_, err := archive.Open(&options)
-	c.Check(err, ErrorMatches, "cannot talk to archive: BAM")
+	c.Check(err, ErrorMatches, "cannot talk to archive at http://archive.ubuntu.com/ubuntu/dists/jammy/InRelease: BAM")
 }
 
 func (s *httpSuite) prepareArchive(suite, version, arch string, components []string) *testarchive.Release {
@@ -223,14 +231,21 @@ func (s *httpSuite) TestFetchPackage(c *C) {
 		Suites:     []string{"jammy"},
 		Components: []string{"main", "universe"},
 		CacheDir:   c.MkDir(),
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 	}
 
 	testArchive, err := archive.Open(&options)
 	c.Assert(err, IsNil)
+	c.Assert(testArchive.Verifications(), DeepEquals, []*archive.Verification{{
+		Suite:        "jammy",
+		File:         "InRelease",
+		KeyID:        key1.ID,
+		KeyAlgorithm: "rsa 2048",
+		Hash:         "sha256",
+	}})
 
 	// First on component main.
-	pkg, info, err := testArchive.Fetch("mypkg1")
+	pkg, info, err := testArchive.Fetch("mypkg1", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg1",
@@ -241,7 +256,7 @@ func (s *httpSuite) TestFetchPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
 
 	// Last on component universe.
-	pkg, info, err = testArchive.Fetch("mypkg4")
+	pkg, info, err = testArchive.Fetch("mypkg4", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg4",
@@ -265,14 +280,14 @@ func (s *httpSuite) TestFetchPortsPackage(c *C) {
 		Suites:     []string{"jammy"},
 		Components: []string{"main", "universe"},
 		CacheDir:   c.MkDir(),
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 	}
 
 	testArchive, err := archive.Open(&options)
 	c.Assert(err, IsNil)
 
 	// First on component main.
-	pkg, info, err := testArchive.Fetch("mypkg1")
+	pkg, info, err := testArchive.Fetch("mypkg1", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg1",
@@ -283,7 +298,7 @@ func (s *httpSuite) TestFetchPortsPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
 
 	// Last on component universe.
-	pkg, info, err = testArchive.Fetch("mypkg4")
+	pkg, info, err = testArchive.Fetch("mypkg4", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg4",
@@ -315,13 +330,13 @@ func (s *httpSuite) TestFetchSecurityPackage(c *C) {
 		Arch:       "amd64",
 		Suites:     []string{"jammy", "jammy-security", "jammy-updates"},
 		Components: []string{"main", "universe"},
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 	}
 
 	testArchive, err := archive.Open(&options)
 	c.Assert(err, IsNil)
 
-	pkg, info, err := testArchive.Fetch("mypkg1")
+	pkg, info, err := testArchive.Fetch("mypkg1", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg1",
@@ -331,7 +346,7 @@ func (s *httpSuite) TestFetchSecurityPackage(c *C) {
 	})
 	c.Assert(read(pkg), Equals, "package from jammy-security")
 
-	pkg, info, err = testArchive.Fetch("mypkg2")
+	pkg, info, err = testArchive.Fetch("mypkg2", "")
 	c.Assert(err, IsNil)
 	c.Assert(info, DeepEquals, &archive.PackageInfo{
 		Name:    "mypkg2",
@@ -342,6 +357,501 @@ func (s *httpSuite) TestFetchSecurityPackage(c *C) {
 	c.Assert(read(pkg), Equals, "mypkg2 1.2 data")
 }
 
+func (s *httpSuite) TestFetchPinnedVersion(c *C) {
+	for i, suite := range []string{"jammy", "jammy-updates", "jammy-security"} {
+		release := s.prepareArchive(suite, "22.04", "amd64", []string{"main", "universe"})
+		release.Walk(func(item testarchive.Item) error {
+			if p, ok := item.(*testarchive.Package); ok && p.Name == "mypkg1" {
+				p.Version = fmt.Sprintf("%s.%d", p.Version, i)
+				p.Data = []byte("package from " + suite)
+			}
+			return nil
+		})
+		release.Render("/ubuntu", s.responses)
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		CacheDir:   c.MkDir(),
+		Arch:       "amd64",
+		Suites:     []string{"jammy", "jammy-security", "jammy-updates"},
+		Components: []string{"main", "universe"},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+	}
+
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, info, err := testArchive.Fetch("mypkg1", "1.1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(info.Version, Equals, "1.1.0.0")
+	c.Assert(read(pkg), Equals, "package from jammy")
+
+	info, err = testArchive.Info("mypkg1", "1.1.1.1")
+	c.Assert(err, IsNil)
+	c.Assert(info.Version, Equals, "1.1.1.1")
+
+	_, _, err = testArchive.Fetch("mypkg1", "1.0")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg1" version 1.0 in archive`)
+	_, err = testArchive.Info("mypkg1", "1.0")
+	c.Assert(err, ErrorMatches, `cannot find package "mypkg1" version 1.0 in archive`)
+}
+
+func (s *httpSuite) TestFetchIndexesConcurrently(c *C) {
+	var mu sync.Mutex
+	do := func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return s.Do(req)
+	}
+	restore := archive.FakeDo(do)
+	defer restore()
+
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe", "restricted"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe", "restricted"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+		Jobs:       3,
+	}
+
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	for i := 1; i <= 6; i++ {
+		pkgName := fmt.Sprintf("mypkg%d", i)
+		pkg, _, err := testArchive.Fetch(pkgName, "")
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, fmt.Sprintf("%s 1.%d data", pkgName, i))
+	}
+}
+
+// flakyServer serves the archive responses, failing the first requests
+// of each path as configured.
+type flakyServer struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+	// failures is the number of times requests for a path fail with 503.
+	failures map[string]int
+	// truncations is the number of times responses for a path are cut
+	// half-way through.
+	truncations map[string]int
+	noRanges    bool
+	// badRanges makes the server answer range requests with the whole
+	// file as if it were the requested range.
+	badRanges bool
+	ranges    []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqPath := path.Clean(req.URL.Path)
+	data, ok := s.responses[reqPath]
+	if !ok {
+		w.WriteHeader(404)
+		return
+	}
+	if s.failures[reqPath] > 0 {
+		s.failures[reqPath]--
+		w.WriteHeader(503)
+		return
+	}
+	status := 200
+	if r := req.Header.Get("Range"); r != "" && !s.noRanges {
+		s.ranges = append(s.ranges, reqPath+" "+r)
+		var offset int
+		_, err := fmt.Sscanf(r, "bytes=%d-", &offset)
+		if err != nil || offset > len(data) {
+			w.WriteHeader(416)
+			return
+		}
+		if s.badRanges {
+			offset = 0
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(data)-1, len(data)))
+		data = data[offset:]
+		status = 206
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if s.truncations[reqPath] > 0 {
+		s.truncations[reqPath]--
+		// Writing less than Content-Length makes the server close the
+		// connection, so the client gets an unexpected EOF.
+		data = data[:len(data)/2]
+	}
+	w.Write(data)
+}
+
+var retryTests = []struct {
+	summary     string
+	retries     int
+	failures    map[string]int
+	truncations map[string]int
+	noRanges    bool
+	badRanges   bool
+	ranges      []string
+	error       string
+}{{
+	summary: "No failures",
+}, {
+	summary:  "Retry after server errors",
+	retries:  2,
+	failures: map[string]int{"/ubuntu/dists/jammy/InRelease": 2},
+}, {
+	summary:  "Server errors exhaust the retries",
+	retries:  1,
+	failures: map[string]int{"/ubuntu/dists/jammy/InRelease": 2},
+	error:    `error from archive at http://.*/ubuntu/dists/jammy/InRelease: 503 Service Unavailable`,
+}, {
+	summary:  "Server errors without retries",
+	failures: map[string]int{"/ubuntu/dists/jammy/InRelease": 1},
+	error:    `error from archive at http://.*/ubuntu/dists/jammy/InRelease: 503 Service Unavailable`,
+}, {
+	summary: "Resume truncated downloads",
+	retries: 1,
+	truncations: map[string]int{
+		"/ubuntu/dists/jammy/main/binary-amd64/Packages.gz":      1,
+		"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb": 1,
+	},
+	ranges: []string{
+		"/ubuntu/dists/jammy/main/binary-amd64/Packages.gz bytes=",
+		"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb bytes=",
+	},
+}, {
+	summary:     "Resume when the server does not support ranges",
+	retries:     1,
+	truncations: map[string]int{"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb": 1},
+	noRanges:    true,
+}, {
+	summary:     "Restart when the server ignores the range offset",
+	retries:     1,
+	truncations: map[string]int{"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb": 1},
+	badRanges:   true,
+	ranges:      []string{"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb bytes="},
+}, {
+	summary:     "Truncated download without retries",
+	truncations: map[string]int{"/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb": 1},
+	error:       `cannot fetch from archive: cannot read from http://.*/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb: unexpected EOF`,
+}}
+
+func (s *httpSuite) TestFetchRetries(c *C) {
+	restoreDelay := archive.FakeRetryDelay(time.Millisecond)
+	defer restoreDelay()
+
+	for _, test := range retryTests {
+		c.Logf("Summary: %s", test.summary)
+
+		server := &flakyServer{
+			responses:   make(map[string][]byte),
+			failures:    make(map[string]int),
+			truncations: make(map[string]int),
+			noRanges:    test.noRanges,
+			badRanges:   test.badRanges,
+		}
+		maps.Copy(server.failures, test.failures)
+		maps.Copy(server.truncations, test.truncations)
+		httpServer := httptest.NewServer(server)
+		restoreDo := archive.FakeDo(httpServer.Client().Do)
+
+		s.base = httpServer.URL + "/ubuntu/"
+		s.responses = server.responses
+		s.prepareArchive("jammy", "22.04", "amd64", []string{"main"})
+
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       "amd64",
+			Suites:     []string{"jammy"},
+			Components: []string{"main"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
+			URL:        s.base,
+			Retries:    test.retries,
+		}
+
+		var pkg io.ReadSeekCloser
+		testArchive, err := archive.Open(&options)
+		if err == nil {
+			pkg, _, err = testArchive.Fetch("mypkg1", "")
+		}
+		restoreDo()
+		httpServer.Close()
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+		c.Assert(server.ranges, HasLen, len(test.ranges))
+		for i, r := range server.ranges {
+			c.Assert(strings.HasPrefix(r, test.ranges[i]), Equals, true)
+		}
+	}
+}
+
+func (s *httpSuite) TestFetchCorruptedCache(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	cacheDir := c.MkDir()
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   cacheDir,
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+	}
+
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	pkg, info, err := testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+	// Truncate the cached package.
+	cachePath := filepath.Join(cacheDir, "sha256", info.SHA256)
+	err = os.WriteFile(cachePath, []byte("mypkg1"), 0644)
+	c.Assert(err, IsNil)
+
+	s.requests = nil
+	pkg, _, err = testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	c.Assert(s.requests, HasLen, 1)
+	c.Assert(s.requests[0].URL.Path, Equals, "/ubuntu/pool/main/m/mypkg1/mypkg1_1.1ubuntu1_amd64.deb")
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, "quarantine", info.SHA256))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "mypkg1")
+
+	// Intact cached packages are used as usual.
+	s.requests = nil
+	pkg, _, err = testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	c.Assert(s.requests, HasLen, 0)
+}
+
+func (s *httpSuite) TestFetchSharedDownload(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	cacheDir := c.MkDir()
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   cacheDir,
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+	}
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	info, err := testArchive.Info("mypkg1", "")
+	c.Assert(err, IsNil)
+
+	// Pretend another process is downloading the package.
+	sharedCache := &cache.Cache{Dir: cacheDir}
+	unlock, err := sharedCache.Lock(info.SHA256)
+	c.Assert(err, IsNil)
+
+	s.requests = nil
+	type result struct {
+		data string
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		pkg, _, err := testArchive.Fetch("mypkg1", "")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{data: read(pkg)}
+	}()
+
+	select {
+	case <-done:
+		c.Fatalf("fetch did not wait for the download in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	err = sharedCache.Write(info.SHA256, []byte("mypkg1 1.1 data"))
+	c.Assert(err, IsNil)
+	unlock()
+
+	res := <-done
+	c.Assert(res.err, IsNil)
+	c.Assert(res.data, Equals, "mypkg1 1.1 data")
+	c.Assert(s.requests, HasLen, 0)
+}
+
+var indexFormatTests = []struct {
+	summary string
+	formats []func(testarchive.Item) testarchive.Item
+	request string
+	error   string
+}{{
+	summary: "Gzip index",
+	formats: []func(testarchive.Item) testarchive.Item{gzipItem},
+	request: "/ubuntu/dists/jammy/main/binary-amd64/Packages.gz",
+}, {
+	summary: "Xz index",
+	formats: []func(testarchive.Item) testarchive.Item{xzItem},
+	request: "/ubuntu/dists/jammy/main/binary-amd64/Packages.xz",
+}, {
+	summary: "Zstd index",
+	formats: []func(testarchive.Item) testarchive.Item{zstdItem},
+	request: "/ubuntu/dists/jammy/main/binary-amd64/Packages.zst",
+}, {
+	summary: "Gzip is preferred",
+	formats: []func(testarchive.Item) testarchive.Item{zstdItem, xzItem, gzipItem},
+	request: "/ubuntu/dists/jammy/main/binary-amd64/Packages.gz",
+}, {
+	summary: "Xz is preferred over zstd",
+	formats: []func(testarchive.Item) testarchive.Item{zstdItem, xzItem},
+	request: "/ubuntu/dists/jammy/main/binary-amd64/Packages.xz",
+}, {
+	summary: "No compressed index",
+	error:   `main/binary-amd64/Packages is missing from jammy main component digests in a supported format`,
+}}
+
+func gzipItem(item testarchive.Item) testarchive.Item { return &testarchive.Gzip{item} }
+func xzItem(item testarchive.Item) testarchive.Item   { return &testarchive.Xz{item} }
+func zstdItem(item testarchive.Item) testarchive.Item { return &testarchive.Zstd{item} }
+
+func (s *httpSuite) TestIndexFormats(c *C) {
+	for _, test := range indexFormatTests {
+		c.Logf("Summary: %s", test.summary)
+		s.responses = make(map[string][]byte)
+		s.requests = nil
+		s.prepareArchiveAdjustRelease("jammy", "22.04", "amd64", []string{"main"}, func(release *testarchive.Release) {
+			index := release.Items[0]
+			release.Items = []testarchive.Item{index}
+			for _, format := range test.formats {
+				release.Items = append(release.Items, format(index))
+			}
+		})
+
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       "amd64",
+			Suites:     []string{"jammy"},
+			Components: []string{"main"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
+		}
+		testArchive, err := archive.Open(&options)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(s.requests, HasLen, 2)
+		c.Assert(s.requests[1].URL.Path, Equals, test.request)
+
+		pkg, _, err := testArchive.Fetch("mypkg2", "")
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, "mypkg2 1.2 data")
+	}
+}
+
+func (s *httpSuite) TestFetchIndexByHash(c *C) {
+	var indexDigest string
+	s.prepareArchiveAdjustRelease("jammy", "22.04", "amd64", []string{"main"}, func(release *testarchive.Release) {
+		release.AcquireByHash = true
+		release.Items = []testarchive.Item{release.Items[0], &testarchive.Xz{release.Items[0]}}
+		indexDigest = fmt.Sprintf("%x", sha256.Sum256(release.Items[1].Content()))
+	})
+	// Only the index by hash is available.
+	delete(s.responses, "/ubuntu/dists/jammy/main/binary-amd64/Packages.xz")
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+	}
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	c.Assert(s.requests, HasLen, 2)
+	c.Assert(s.requests[1].URL.Path, Equals, "/ubuntu/dists/jammy/main/binary-amd64/by-hash/SHA256/"+indexDigest)
+
+	pkg, _, err := testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+}
+
+var validUntilTests = []struct {
+	summary    string
+	validUntil string
+	snapshot   string
+	error      string
+}{{
+	summary:    "Valid release",
+	validUntil: time.Now().Add(24 * time.Hour).UTC().Format(time.RFC1123),
+}, {
+	summary:    "Valid release with numeric zone",
+	validUntil: time.Now().Add(24 * time.Hour).Format(time.RFC1123Z),
+}, {
+	summary:    "Expired release",
+	validUntil: "Thu, 28 Apr 2022 17:16:08 UTC",
+	error:      `InRelease file expired on Thu, 28 Apr 2022 17:16:08 UTC`,
+}, {
+	summary:    "Expired release in snapshot",
+	validUntil: "Thu, 28 Apr 2022 17:16:08 UTC",
+	snapshot:   "20220425T000000Z",
+}, {
+	summary:    "Invalid date",
+	validUntil: "tomorrow",
+	error:      `cannot parse Valid-Until field of InRelease file: "tomorrow"`,
+}}
+
+func (s *httpSuite) TestValidUntil(c *C) {
+	for _, test := range validUntilTests {
+		c.Logf("Summary: %s", test.summary)
+		s.responses = make(map[string][]byte)
+		s.base = "http://archive.ubuntu.com/ubuntu/"
+		if test.snapshot != "" {
+			s.base = "https://snapshot.ubuntu.com/ubuntu/" + test.snapshot + "/"
+		}
+		s.prepareArchiveAdjustRelease("jammy", "22.04", "amd64", []string{"main"}, func(release *testarchive.Release) {
+			release.ValidUntil = test.validUntil
+		})
+
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       "amd64",
+			Suites:     []string{"jammy"},
+			Components: []string{"main"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
+			Snapshot:   test.snapshot,
+		}
+		_, err := archive.Open(&options)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+		} else {
+			c.Assert(err, IsNil)
+		}
+	}
+}
+
 func (s *httpSuite) TestArchiveLabels(c *C) {
 	setLabel := func(label string) func(*testarchive.Release) {
 		return func(r *testarchive.Release) {
@@ -350,9 +860,10 @@ func (s *httpSuite) TestArchiveLabels(c *C) {
 	}
 
 	tests := []struct {
-		summary string
-		label   string
-		err     string
+		summary      string
+		label        string
+		releaseLabel string
+		err          string
 	}{{
 		summary: "Ubuntu label",
 		label:   "Ubuntu",
@@ -360,6 +871,15 @@ func (s *httpSuite) TestArchiveLabels(c *C) {
 		summary: "Unknown label",
 		label:   "Unknown",
 		err:     "corrupted archive InRelease file: no Ubuntu section",
+	}, {
+		summary:      "Custom label",
+		label:        "Debian",
+		releaseLabel: "Debian",
+	}, {
+		summary:      "Custom label does not match",
+		label:        "Ubuntu",
+		releaseLabel: "Debian",
+		err:          "corrupted archive InRelease file: no Debian section",
 	}}
 
 	for _, test := range tests {
@@ -372,13 +892,14 @@ func (s *httpSuite) TestArchiveLabels(c *C) {
 		s.prepareArchiveAdjustRelease("jammy", "22.04", "amd64", []string{"main", "universe"}, adjust)
 
 		options := archive.Options{
-			Label:      "ubuntu",
-			Version:    "22.04",
-			Arch:       "amd64",
-			Suites:     []string{"jammy"},
-			Components: []string{"main", "universe"},
-			CacheDir:   c.MkDir(),
-			PubKeys:    []*packet.PublicKey{s.pubKey},
+			Label:        "ubuntu",
+			Version:      "22.04",
+			Arch:         "amd64",
+			Suites:       []string{"jammy"},
+			Components:   []string{"main", "universe"},
+			CacheDir:     c.MkDir(),
+			PubKeys:      []*pgputil.PublicKey{s.pubKey},
+			ReleaseLabel: test.releaseLabel,
 		}
 
 		_, err := archive.Open(&options)
@@ -430,7 +951,7 @@ func (s *httpSuite) TestProArchives(c *C) {
 			Components: []string{"main"},
 			CacheDir:   c.MkDir(),
 			Pro:        pro,
-			PubKeys:    []*packet.PublicKey{s.pubKey},
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
 		}
 
 		_, err = archive.Open(&options)
@@ -456,7 +977,7 @@ func (s *httpSuite) TestProArchives(c *C) {
 		Suites:     []string{"focal"},
 		Components: []string{"main"},
 		CacheDir:   c.MkDir(),
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 	}
 
 	_, err = archive.Open(&options)
@@ -488,13 +1009,13 @@ func (s *httpSuite) TestProArchives(c *C) {
 			Components: []string{"main"},
 			CacheDir:   c.MkDir(),
 			Pro:        pro,
-			PubKeys:    []*packet.PublicKey{s.pubKey},
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
 		}
 
 		testArchive, err := archive.Open(&options)
 		c.Assert(err, IsNil)
 
-		_, _, err = testArchive.Fetch("mypkg1")
+		_, _, err = testArchive.Fetch("mypkg1", "")
 		c.Assert(err, ErrorMatches, `cannot fetch from "ubuntu": unauthorized`)
 	}
 }
@@ -510,7 +1031,7 @@ func (s *httpSuite) TestOpenUnmaintainedArchives(c *C) {
 		Suites:     []string{"jammy"},
 		Components: []string{"main", "universe"},
 		CacheDir:   c.MkDir(),
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 		OldRelease: false,
 	}
 
@@ -524,25 +1045,495 @@ func (s *httpSuite) TestOpenUnmaintainedArchives(c *C) {
 	c.Assert(err, IsNil)
 }
 
+var mirrorURLTests = []struct {
+	summary  string
+	arch     string
+	url      string
+	portsURL string
+	pro      string
+	base     string
+}{{
+	summary: "Mirror URL",
+	arch:    "amd64",
+	url:     "http://mirror.example.com/ubuntu/",
+	base:    "http://mirror.example.com/ubuntu/",
+}, {
+	summary: "Mirror URL is used for ports if there is no ports URL",
+	arch:    "arm64",
+	url:     "http://mirror.example.com/ubuntu/",
+	base:    "http://mirror.example.com/ubuntu/",
+}, {
+	summary:  "Mirror ports URL",
+	arch:     "arm64",
+	url:      "http://mirror.example.com/ubuntu/",
+	portsURL: "http://mirror.example.com/ubuntu-ports/",
+	base:     "http://mirror.example.com/ubuntu-ports/",
+}, {
+	summary:  "Mirror ports URL is not used for amd64",
+	arch:     "amd64",
+	url:      "http://mirror.example.com/ubuntu/",
+	portsURL: "http://mirror.example.com/ubuntu-ports/",
+	base:     "http://mirror.example.com/ubuntu/",
+}, {
+	summary: "Pro archive mirror without credentials",
+	arch:    "amd64",
+	url:     "https://proxy.example.com/fips/",
+	pro:     archive.ProFIPS,
+	base:    "https://proxy.example.com/fips/",
+}}
+
+func (s *httpSuite) TestOpenMirrorURL(c *C) {
+	restore := fakeEnv("CHISEL_AUTH_DIR", c.MkDir())
+	defer restore()
+
+	do := func(req *http.Request) (*http.Response, error) {
+		_, ok := req.Header["Authorization"]
+		c.Assert(ok, Equals, false)
+		return s.Do(req)
+	}
+	restoreDo := archive.FakeDo(do)
+	defer restoreDo()
+
+	for _, test := range mirrorURLTests {
+		c.Logf("Summary: %s", test.summary)
+
+		s.base = test.base
+		s.responses = make(map[string][]byte)
+		s.prepareArchiveAdjustRelease("jammy", "22.04", test.arch, []string{"main"}, func(r *testarchive.Release) {
+			if test.pro != "" {
+				r.Label = archive.ProArchiveInfo[test.pro].Label
+			}
+		})
+
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       test.arch,
+			Suites:     []string{"jammy"},
+			Components: []string{"main"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
+			Pro:        test.pro,
+			URL:        test.url,
+			PortsURL:   test.portsURL,
+		}
+
+		testArchive, err := archive.Open(&options)
+		c.Assert(err, IsNil)
+
+		pkg, _, err := testArchive.Fetch("mypkg1", "")
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	}
+}
+
+var snapshotTests = []struct {
+	summary  string
+	arch     string
+	url      string
+	pro      string
+	dir      bool
+	snapshot string
+	base     string
+	error    string
+}{{
+	summary:  "Ubuntu snapshot",
+	arch:     "amd64",
+	snapshot: "20240301T120000Z",
+	base:     "https://snapshot.ubuntu.com/ubuntu/20240301T120000Z/",
+}, {
+	summary:  "Ubuntu ports snapshot",
+	arch:     "arm64",
+	snapshot: "20240301T120000Z",
+	base:     "https://snapshot.ubuntu.com/ubuntu-ports/20240301T120000Z/",
+}, {
+	summary:  "Mirror snapshot",
+	arch:     "amd64",
+	url:      "http://mirror.example.com/snapshots",
+	snapshot: "20240301T120000Z",
+	base:     "http://mirror.example.com/snapshots/20240301T120000Z/",
+}, {
+	summary:  "Invalid timestamp",
+	arch:     "amd64",
+	snapshot: "2024-03-01",
+	error:    `invalid snapshot timestamp: "2024-03-01"`,
+}, {
+	summary:  "Pro archives do not support snapshots",
+	arch:     "amd64",
+	pro:      archive.ProFIPS,
+	snapshot: "20240301T120000Z",
+	error:    `snapshots are not supported for pro archives`,
+}, {
+	summary:  "Local archives do not support snapshots",
+	arch:     "amd64",
+	dir:      true,
+	snapshot: "20240301T120000Z",
+	error:    `snapshots are not supported for local archives`,
+}}
+
+func (s *httpSuite) TestOpenSnapshot(c *C) {
+	for _, test := range snapshotTests {
+		c.Logf("Summary: %s", test.summary)
+
+		s.base = test.base
+		s.responses = make(map[string][]byte)
+		if test.base != "" {
+			s.prepareArchive("jammy", "22.04", test.arch, []string{"main"})
+		}
+
+		options := archive.Options{
+			Label:      "ubuntu",
+			Version:    "22.04",
+			Arch:       test.arch,
+			Suites:     []string{"jammy"},
+			Components: []string{"main"},
+			CacheDir:   c.MkDir(),
+			PubKeys:    []*pgputil.PublicKey{s.pubKey},
+			Pro:        test.pro,
+			URL:        test.url,
+			Snapshot:   test.snapshot,
+		}
+		if test.dir {
+			options.Dir = c.MkDir()
+		}
+
+		testArchive, err := archive.Open(&options)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+
+		pkg, _, err := testArchive.Fetch("mypkg1", "")
+		c.Assert(err, IsNil)
+		c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+	}
+}
+
+func (s *httpSuite) TestOpenOffline(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+		Offline:    true,
+	}
+
+	// Nothing was verified yet.
+	_, err := archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot work offline, missing from cache:\n- verified InRelease, or Release and Release.gpg, for ubuntu 22.04 jammy suite")
+	c.Assert(s.requests, HasLen, 0)
+
+	options.Offline = false
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	pkg, _, err := testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	pkg.Close()
+
+	s.requests = nil
+	options.Offline = true
+	testArchive, err = archive.Open(&options)
+	c.Assert(err, IsNil)
+	pkg, info, err := testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(info.Version, Equals, "1.1")
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+	info, err = testArchive.Info("mypkg2", "")
+	c.Assert(err, IsNil)
+	_, _, err = testArchive.Fetch("mypkg2", "")
+	c.Assert(err, ErrorMatches, "cannot work offline, missing from cache:\n- sha256:"+info.SHA256+" \\(pool/main/m/mypkg2/mypkg2_1.2ubuntu1_amd64.deb\\)")
+	c.Assert(s.requests, HasLen, 0)
+}
+
+func (s *httpSuite) TestOpenOfflineMissingIndexes(c *C) {
+	s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+
+	cacheDir := c.MkDir()
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   cacheDir,
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+	}
+	_, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	// Drop everything but the InRelease file from the cache.
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "sha256"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 3)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(cacheDir, "sha256", entry.Name()))
+		c.Assert(err, IsNil)
+		if !strings.Contains(string(data), "BEGIN PGP SIGNED MESSAGE") {
+			err = os.Remove(filepath.Join(cacheDir, "sha256", entry.Name()))
+			c.Assert(err, IsNil)
+		}
+	}
+
+	options.Offline = true
+	_, err = archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot work offline, missing from cache:\n"+
+		"- sha256:[0-9a-f]{64} \\(dists/jammy/main/binary-amd64/Packages.gz\\)\n"+
+		"- sha256:[0-9a-f]{64} \\(dists/jammy/universe/binary-amd64/Packages.gz\\)")
+}
+
+func (s *httpSuite) TestOpenLocalMirror(c *C) {
+	// Requests should never hit the network.
+	s.base = "file://"
+	s.err = errors.New("unexpected request")
+
+	release := s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
+	mirrorDir := c.MkDir()
+	content := make(map[string][]byte)
+	release.Render("/", content)
+	for path, data := range content {
+		fpath := filepath.Join(mirrorDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, data, 0644)
+		c.Assert(err, IsNil)
+	}
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main", "universe"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
+		Dir:        mirrorDir,
+	}
+
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+
+	pkg, info, err := testArchive.Fetch("mypkg3", "")
+	c.Assert(err, IsNil)
+	c.Assert(info, DeepEquals, &archive.PackageInfo{
+		Name:    "mypkg3",
+		Version: "1.3",
+		Arch:    "amd64",
+		SHA256:  sha256hex("mypkg3 1.3 data"),
+	})
+	c.Assert(read(pkg), Equals, "mypkg3 1.3 data")
+
+	// The InRelease file is still verified.
+	options.PubKeys = []*pgputil.PublicKey{key2.PubKey}
+	options.CacheDir = c.MkDir()
+	_, err = archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot verify signature of the InRelease file: openpgp: .*verification failure")
+
+	c.Assert(s.requests, HasLen, 0)
+}
+
+var localArchiveTests = []struct {
+	summary string
+	files   map[string]string
+	arch    string
+	pkg     string
+	version string
+	// The SHA256 of info is computed from data.
+	info  *archive.PackageInfo
+	data  string
+	error string
+}{{
+	summary: "Single package",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb": "mypkg 1.0",
+	},
+	pkg: "mypkg",
+	info: &archive.PackageInfo{
+		Name:    "mypkg",
+		Version: "1.0",
+		Arch:    "amd64",
+	},
+	data: "mypkg 1.0",
+}, {
+	summary: "Highest version is selected",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb":      "mypkg 1.0",
+		"sub/mypkg_1.10_amd64.deb": "mypkg 1.10",
+		"mypkg_1.9_amd64.deb":      "mypkg 1.9",
+	},
+	pkg: "mypkg",
+	info: &archive.PackageInfo{
+		Name:    "mypkg",
+		Version: "1.10",
+		Arch:    "amd64",
+	},
+	data: "mypkg 1.10",
+}, {
+	summary: "Pinned version is selected",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb":      "mypkg 1.0",
+		"sub/mypkg_1.10_amd64.deb": "mypkg 1.10",
+		"mypkg_1.9_amd64.deb":      "mypkg 1.9",
+	},
+	pkg:     "mypkg",
+	version: "1.9",
+	info: &archive.PackageInfo{
+		Name:    "mypkg",
+		Version: "1.9",
+		Arch:    "amd64",
+	},
+	data: "mypkg 1.9",
+}, {
+	summary: "Pinned version is missing",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb": "mypkg 1.0",
+	},
+	pkg:     "mypkg",
+	version: "1.9",
+	error:   `cannot find package "mypkg" version 1.9 in archive`,
+}, {
+	summary: "Escaped epoch in version",
+	files: map[string]string{
+		"mypkg_1%3a1.0_amd64.deb": "mypkg 1:1.0",
+	},
+	pkg: "mypkg",
+	info: &archive.PackageInfo{
+		Name:    "mypkg",
+		Version: "1:1.0",
+		Arch:    "amd64",
+	},
+	data: "mypkg 1:1.0",
+}, {
+	summary: "Architecture all is included",
+	files: map[string]string{
+		"mypkg_1.0_all.deb":   "mypkg 1.0 all",
+		"mypkg_2.0_arm64.deb": "mypkg 2.0 arm64",
+	},
+	pkg: "mypkg",
+	info: &archive.PackageInfo{
+		Name:    "mypkg",
+		Version: "1.0",
+		Arch:    "all",
+	},
+	data: "mypkg 1.0 all",
+}, {
+	summary: "Package not found",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb": "mypkg 1.0",
+	},
+	pkg:   "otherpkg",
+	error: `cannot find package "otherpkg" in archive`,
+}, {
+	summary: "Files which do not follow the naming convention are ignored",
+	files: map[string]string{
+		"mypkg_1.0_amd64.deb": "mypkg 1.0",
+		"otherpkg.deb":        "otherpkg",
+		"README":              "readme",
+	},
+	pkg:   "otherpkg",
+	error: `cannot find package "otherpkg" in archive`,
+}, {
+	summary: "No packages for the architecture",
+	files: map[string]string{
+		"mypkg_1.0_arm64.deb": "mypkg 1.0",
+	},
+	error: `archive directory .* has no packages for amd64`,
+}}
+
+func (s *S) TestOpenLocalArchive(c *C) {
+	for _, test := range localArchiveTests {
+		c.Logf("Summary: %s", test.summary)
+
+		dir := c.MkDir()
+		for path, data := range test.files {
+			fpath := filepath.Join(dir, path)
+			err := os.MkdirAll(filepath.Dir(fpath), 0755)
+			c.Assert(err, IsNil)
+			err = os.WriteFile(fpath, []byte(data), 0644)
+			c.Assert(err, IsNil)
+		}
+
+		arch := test.arch
+		if arch == "" {
+			arch = "amd64"
+		}
+		testArchive, err := archive.Open(&archive.Options{
+			Label: "local",
+			Arch:  arch,
+			Dir:   dir,
+		})
+		if err != nil {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+
+		info, err := testArchive.Info(test.pkg, test.version)
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			c.Assert(testArchive.Exists(test.pkg), Equals, test.version != "")
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(testArchive.Exists(test.pkg), Equals, true)
+		test.info.SHA256 = sha256hex(test.data)
+		c.Assert(info, DeepEquals, test.info)
+
+		pkg, info, err := testArchive.Fetch(test.pkg, test.version)
+		c.Assert(err, IsNil)
+		c.Assert(info, DeepEquals, test.info)
+		c.Assert(read(pkg), Equals, test.data)
+		pkg.Close()
+
+		// The digest is computed only once per file.
+		for path := range test.files {
+			err = os.WriteFile(filepath.Join(dir, path), []byte("changed"), 0644)
+			c.Assert(err, IsNil)
+		}
+		info, err = testArchive.Info(test.pkg, test.version)
+		c.Assert(err, IsNil)
+		c.Assert(info, DeepEquals, test.info)
+	}
+}
+
+func sha256hex(data string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
 type verifyArchiveReleaseTest struct {
 	summary string
-	pubKeys []*packet.PublicKey
+	pubKeys []*pgputil.PublicKey
+	policy  *pgputil.Policy
 	error   string
 }
 
 var verifyArchiveReleaseTests = []verifyArchiveReleaseTest{{
 	summary: "A valid public key",
-	pubKeys: []*packet.PublicKey{key1.PubKey},
+	pubKeys: []*pgputil.PublicKey{key1.PubKey},
 }, {
 	summary: "No public key to verify with",
-	error:   `cannot verify signature of the InRelease file`,
+	error:   `cannot verify signature of the InRelease file: cannot verify any signatures`,
 }, {
 	summary: "Wrong public key",
-	pubKeys: []*packet.PublicKey{key2.PubKey},
-	error:   `cannot verify signature of the InRelease file`,
+	pubKeys: []*pgputil.PublicKey{key2.PubKey},
+	error:   `cannot verify signature of the InRelease file: openpgp: .*verification failure`,
 }, {
 	summary: "Multiple public keys (invalid, valid)",
-	pubKeys: []*packet.PublicKey{key2.PubKey, key1.PubKey},
+	pubKeys: []*pgputil.PublicKey{key2.PubKey, key1.PubKey},
+}, {
+	summary: "Signature policy accepting the key",
+	pubKeys: []*pgputil.PublicKey{key1.PubKey},
+	policy:  &pgputil.Policy{Hashes: []string{"sha256"}, KeyAlgorithms: []string{"rsa"}},
+}, {
+	summary: "Signature policy rejecting the key",
+	pubKeys: []*pgputil.PublicKey{key1.PubKey},
+	policy:  &pgputil.Policy{MinKeySize: 4096},
+	error:   `cannot verify signature of the InRelease file: key 854BAF1AA9D76600 has 2048 bits, policy requires at least 4096`,
 }}
 
 func (s *httpSuite) TestVerifyArchiveRelease(c *C) {
@@ -552,13 +1543,14 @@ func (s *httpSuite) TestVerifyArchiveRelease(c *C) {
 		s.prepareArchive("jammy", "22.04", "amd64", []string{"main", "universe"})
 
 		options := archive.Options{
-			Label:      "ubuntu",
-			Version:    "22.04",
-			Arch:       "amd64",
-			Suites:     []string{"jammy"},
-			Components: []string{"main", "universe"},
-			CacheDir:   c.MkDir(),
-			PubKeys:    test.pubKeys,
+			Label:           "ubuntu",
+			Version:         "22.04",
+			Arch:            "amd64",
+			Suites:          []string{"jammy"},
+			Components:      []string{"main", "universe"},
+			CacheDir:        c.MkDir(),
+			PubKeys:         test.pubKeys,
+			SignaturePolicy: test.policy,
 		}
 
 		_, err := archive.Open(&options)
@@ -570,6 +1562,57 @@ func (s *httpSuite) TestVerifyArchiveRelease(c *C) {
 	}
 }
 
+func (s *httpSuite) TestFetchDetachedRelease(c *C) {
+	// Requests for missing files must fail for the fallback to happen.
+	server := &flakyServer{responses: make(map[string][]byte)}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	restoreDo := archive.FakeDo(httpServer.Client().Do)
+	defer restoreDo()
+
+	s.base = httpServer.URL + "/ubuntu/"
+	s.responses = server.responses
+	s.prepareArchiveAdjustRelease("jammy", "22.04", "amd64", []string{"main"}, func(release *testarchive.Release) {
+		release.Detached = true
+	})
+	c.Assert(s.responses["/ubuntu/dists/jammy/InRelease"], IsNil)
+
+	options := archive.Options{
+		Label:      "ubuntu",
+		Version:    "22.04",
+		Arch:       "amd64",
+		Suites:     []string{"jammy"},
+		Components: []string{"main"},
+		CacheDir:   c.MkDir(),
+		PubKeys:    []*pgputil.PublicKey{key2.PubKey},
+		URL:        s.base,
+	}
+	_, err := archive.Open(&options)
+	c.Assert(err, ErrorMatches, "cannot verify signature of the Release file: openpgp: .*verification failure")
+
+	options.PubKeys = []*pgputil.PublicKey{s.pubKey}
+	testArchive, err := archive.Open(&options)
+	c.Assert(err, IsNil)
+	c.Assert(testArchive.Verifications(), DeepEquals, []*archive.Verification{{
+		Suite:        "jammy",
+		File:         "Release",
+		KeyID:        key1.ID,
+		KeyAlgorithm: "rsa 2048",
+		Hash:         "sha256",
+	}})
+	pkg, _, err := testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+
+	// The verified Release file is also used when offline.
+	options.Offline = true
+	testArchive, err = archive.Open(&options)
+	c.Assert(err, IsNil)
+	pkg, _, err = testArchive.Fetch("mypkg1", "")
+	c.Assert(err, IsNil)
+	c.Assert(read(pkg), Equals, "mypkg1 1.1 data")
+}
+
 var packageInfoTests = []struct {
 	summary string
 	pkg     string
@@ -600,14 +1643,14 @@ func (s *httpSuite) TestPackageInfo(c *C) {
 		Suites:     []string{"jammy"},
 		Components: []string{"main", "universe"},
 		CacheDir:   c.MkDir(),
-		PubKeys:    []*packet.PublicKey{s.pubKey},
+		PubKeys:    []*pgputil.PublicKey{s.pubKey},
 	}
 
 	testArchive, err := archive.Open(&options)
 	c.Assert(err, IsNil)
 
 	for _, test := range packageInfoTests {
-		info, err := testArchive.Info(test.pkg)
+		info, err := testArchive.Info(test.pkg, "")
 		if test.error != "" {
 			c.Assert(err, ErrorMatches, test.error)
 			continue
@@ -676,7 +1719,7 @@ type realArchiveTest struct {
 	components     []string
 	pro            string
 	oldRelease     bool
-	archivePubKeys []*packet.PublicKey
+	archivePubKeys []*pgputil.PublicKey
 	archs          []string
 	pkg            string
 	path           string
@@ -688,7 +1731,7 @@ var realArchiveTests = []realArchiveTest{{
 	oldRelease:     false,
 	suites:         []string{"focal"},
 	components:     []string{"main", "universe"},
-	archivePubKeys: []*packet.PublicKey{keyUbuntu2018.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntu2018.PubKey},
 	pkg:            "hostname",
 	path:           "/bin/hostname",
 }, {
@@ -697,7 +1740,7 @@ var realArchiveTests = []realArchiveTest{{
 	oldRelease:     false,
 	suites:         []string{"jammy"},
 	components:     []string{"main", "universe"},
-	archivePubKeys: []*packet.PublicKey{keyUbuntu2018.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntu2018.PubKey},
 	pkg:            "hostname",
 	path:           "/bin/hostname",
 }, {
@@ -706,7 +1749,7 @@ var realArchiveTests = []realArchiveTest{{
 	oldRelease:     false,
 	suites:         []string{"noble"},
 	components:     []string{"main", "universe"},
-	archivePubKeys: []*packet.PublicKey{keyUbuntu2018.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntu2018.PubKey},
 	pkg:            "hostname",
 	path:           "/usr/bin/hostname",
 }, {
@@ -715,7 +1758,7 @@ var realArchiveTests = []realArchiveTest{{
 	oldRelease:     true,
 	suites:         []string{"mantic"},
 	components:     []string{"main", "universe"},
-	archivePubKeys: []*packet.PublicKey{keyUbuntu2018.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntu2018.PubKey},
 	pkg:            "hostname",
 	path:           "/bin/hostname",
 }}
@@ -726,7 +1769,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"focal"},
 	components:     []string{"main"},
 	pro:            "fips",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuFIPSv1.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuFIPSv1.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "openssh-client",
 	path:           "/usr/bin/ssh",
@@ -736,7 +1779,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"focal-updates"},
 	components:     []string{"main"},
 	pro:            "fips-updates",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuFIPSv1.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuFIPSv1.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "openssh-client",
 	path:           "/usr/bin/ssh",
@@ -746,7 +1789,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"focal-apps-security", "focal-apps-updates"},
 	components:     []string{"main"},
 	pro:            "esm-apps",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuApps.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuApps.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -756,7 +1799,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"focal-infra-security", "focal-infra-updates"},
 	components:     []string{"main"},
 	pro:            "esm-infra",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuESMv2.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuESMv2.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -766,7 +1809,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"jammy-updates"},
 	components:     []string{"main"},
 	pro:            "fips-updates",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuFIPSv1.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuFIPSv1.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "openssh-client",
 	path:           "/usr/bin/ssh",
@@ -776,7 +1819,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"jammy-apps-security", "jammy-apps-updates"},
 	components:     []string{"main"},
 	pro:            "esm-apps",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuApps.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuApps.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -786,7 +1829,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"jammy-infra-security", "jammy-infra-updates"},
 	components:     []string{"main"},
 	pro:            "esm-infra",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuESMv2.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuESMv2.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -796,7 +1839,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"noble-apps-security", "noble-apps-updates"},
 	components:     []string{"main"},
 	pro:            "esm-apps",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuApps.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuApps.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -806,7 +1849,7 @@ var proArchiveTests = []realArchiveTest{{
 	suites:         []string{"noble-infra-security", "noble-infra-updates"},
 	components:     []string{"main"},
 	pro:            "esm-infra",
-	archivePubKeys: []*packet.PublicKey{keyUbuntuESMv2.PubKey},
+	archivePubKeys: []*pgputil.PublicKey{keyUbuntuESMv2.PubKey},
 	archs:          []string{"amd64"},
 	pkg:            "hello",
 	path:           "/usr/bin/hello",
@@ -851,7 +1894,7 @@ func (s *S) testOpenArchiveArch(c *C, test realArchiveTest, arch string) {
 
 	extractDir := c.MkDir()
 
-	pkg, info, err := testArchive.Fetch(test.pkg)
+	pkg, info, err := testArchive.Fetch(test.pkg, "")
 	c.Assert(err, IsNil)
 	c.Assert(info.Name, DeepEquals, test.pkg)
 	c.Assert(info.Arch, DeepEquals, arch)
@@ -893,7 +1936,7 @@ func (s *S) testRealProArchiveBadCreds(c *C) {
 		Components: []string{"main"},
 		CacheDir:   c.MkDir(),
 		Pro:        "fips",
-		PubKeys:    []*packet.PublicKey{keyUbuntuFIPSv1.PubKey},
+		PubKeys:    []*pgputil.PublicKey{keyUbuntuFIPSv1.PubKey},
 	}
 
 	// The archive can be "opened" without any credentials since the dists/ path
@@ -901,6 +1944,6 @@ func (s *S) testRealProArchiveBadCreds(c *C) {
 	testArchive, err := archive.Open(&options)
 	c.Assert(err, IsNil)
 
-	_, _, err = testArchive.Fetch("openssh-client")
+	_, _, err = testArchive.Fetch("openssh-client", "")
 	c.Assert(err, ErrorMatches, `cannot fetch from "ubuntu": unauthorized`)
 }
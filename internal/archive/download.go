@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var retryDelay = 1 * time.Second
+
+const maxRetryDelay = 30 * time.Second
+
+// retryableError marks errors which might not happen again if the request
+// is retried, such as network errors or server overload.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// notFoundError is returned when the archive has no data at the requested
+// location.
+type notFoundError struct {
+	url string
+}
+
+func (e *notFoundError) Error() string { return "cannot find archive data at " + e.url }
+
+// downloadReader reads the body of an HTTP download, retrying the request
+// on transient errors and resuming interrupted downloads with Range
+// requests.
+type downloadReader struct {
+	index   *ubuntuIndex
+	url     string
+	flags   fetchFlags
+	body    io.ReadCloser
+	offset  int64
+	retries int
+	// noRange is set once the server answered a range request with data
+	// from the wrong offset, so later requests fetch the whole file.
+	noRange bool
+}
+
+func openHTTP(index *ubuntuIndex, url string, flags fetchFlags) (io.ReadCloser, error) {
+	reader := &downloadReader{
+		index: index,
+		url:   url,
+		flags: flags,
+	}
+	for {
+		err := reader.connect()
+		if err == nil {
+			return reader, nil
+		}
+		err = reader.retry(err)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			err := r.connect()
+			if err != nil {
+				err = r.retry(err)
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		r.body.Close()
+		r.body = nil
+		if n > 0 {
+			// Resume on the next call.
+			return n, nil
+		}
+		err = r.retry(&retryableError{fmt.Errorf("cannot read from %s: %v", r.url, err)})
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (r *downloadReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// retry returns err if it cannot be retried or there are no retries left.
+// Otherwise it waits before the next attempt and returns nil.
+func (r *downloadReader) retry(err error) error {
+	var retryable *retryableError
+	if !errors.As(err, &retryable) {
+		return err
+	}
+	if r.retries >= r.index.archive.options.Retries {
+		return retryable.err
+	}
+	delay := retryDelay << r.retries
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	r.retries++
+	logf("Retrying in %v: %v", delay, retryable.err)
+	time.Sleep(delay)
+	return nil
+}
+
+// connect issues the HTTP request, starting from the current offset.
+func (r *downloadReader) connect() error {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP request: %v", err)
+	}
+	creds := r.index.archive.creds
+	if creds != nil && !creds.Empty() {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	if r.offset > 0 && !r.noRange {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+	}
+	var resp *http.Response
+	if r.flags&fetchBulk != 0 {
+		resp, err = bulkDo(req)
+	} else {
+		resp, err = httpDo(req)
+	}
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return &retryableError{fmt.Errorf("cannot talk to archive at %s: %v", r.url, err)}
+	}
+
+	switch {
+	case resp.StatusCode == 206 && r.offset > 0 && contentRangeStart(resp.Header) != r.offset:
+		// The server ignored the requested offset, so the data cannot be
+		// appended to what was read before. Start over from the beginning.
+		resp.Body.Close()
+		logf("Server sent wrong range for %s, fetching from the start", r.url)
+		r.noRange = true
+		return r.connect()
+	case resp.StatusCode == 200 && r.offset > 0:
+		// The server does not support ranges, skip what was read before.
+		_, err := io.CopyN(io.Discard, resp.Body, r.offset)
+		if err != nil {
+			resp.Body.Close()
+			return &retryableError{fmt.Errorf("cannot read from %s: %v", r.url, err)}
+		}
+	case resp.StatusCode == 200 || resp.StatusCode == 206 && r.offset > 0:
+		// ok
+	case resp.StatusCode == 401:
+		resp.Body.Close()
+		return fmt.Errorf("cannot fetch from %q: unauthorized", r.index.label)
+	case resp.StatusCode == 404:
+		resp.Body.Close()
+		return &notFoundError{r.url}
+	case resp.StatusCode == 429 || resp.StatusCode >= 500:
+		resp.Body.Close()
+		return &retryableError{fmt.Errorf("error from archive at %s: %v", r.url, resp.Status)}
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("error from archive at %s: %v", r.url, resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+// contentRangeStart returns the first byte position in the Content-Range
+// header of a partial response, or -1 if the header is missing or invalid.
+func contentRangeStart(header http.Header) int64 {
+	value, ok := strings.CutPrefix(header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return -1
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return offset
+}
@@ -2,6 +2,7 @@ package archive
 
 import (
 	"net/http"
+	"time"
 )
 
 func FakeDo(do func(req *http.Request) (*http.Response, error)) (restore func()) {
@@ -21,3 +22,11 @@ var FindCredentials = findCredentials
 var FindCredentialsInDir = findCredentialsInDir
 
 var ProArchiveInfo = proArchiveInfo
+
+func FakeRetryDelay(delay time.Duration) (restore func()) {
+	_retryDelay := retryDelay
+	retryDelay = delay
+	return func() {
+		retryDelay = _retryDelay
+	}
+}
@@ -0,0 +1,181 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/canonical/chisel/internal/deb"
+)
+
+// localArchive serves packages from a flat directory of .deb files. There are
+// no signed indexes in that case, so the files are trusted as they are.
+type localArchive struct {
+	options Options
+	// packages holds all versions found for each package name.
+	packages map[string][]*localPackage
+}
+
+type localPackage struct {
+	name    string
+	version string
+	arch    string
+	path    string
+
+	// digest is computed on first use, as hashing the whole file on every
+	// Info or Fetch call adds up for large packages.
+	digestMutex sync.Mutex
+	digest      string
+}
+
+// isMirrorDir returns whether dir holds a mirror tree, as opposed to a flat
+// collection of .deb files.
+func isMirrorDir(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "dists"))
+	return err == nil && info.IsDir()
+}
+
+func openLocal(options *Options) (Archive, error) {
+	archive := &localArchive{
+		options:  *options,
+		packages: make(map[string][]*localPackage),
+	}
+	err := filepath.WalkDir(options.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".deb") {
+			return nil
+		}
+		pkg, ok := parseDebFilename(entry.Name())
+		if !ok {
+			logf("Ignoring %s: filename does not follow <name>_<version>_<arch>.deb", path)
+			return nil
+		}
+		if pkg.arch != options.Arch && pkg.arch != "all" {
+			return nil
+		}
+		pkg.path = path
+		archive.packages[pkg.name] = append(archive.packages[pkg.name], pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive directory: %w", err)
+	}
+	if len(archive.packages) == 0 {
+		return nil, fmt.Errorf("archive directory %s has no packages for %s", options.Dir, options.Arch)
+	}
+	return archive, nil
+}
+
+// parseDebFilename parses filenames following the Debian convention of
+// <name>_<version>_<arch>.deb, where the version epoch separator might be
+// escaped as %3a.
+func parseDebFilename(filename string) (pkg *localPackage, ok bool) {
+	fields := strings.Split(strings.TrimSuffix(filename, ".deb"), "_")
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+		return nil, false
+	}
+	version, err := url.PathUnescape(fields[1])
+	if err != nil {
+		return nil, false
+	}
+	return &localPackage{name: fields[0], version: version, arch: fields[2]}, true
+}
+
+func (a *localArchive) Options() *Options {
+	return &a.options
+}
+
+// Verifications returns nil, as there are no signed release files.
+func (a *localArchive) Verifications() []*Verification {
+	return nil
+}
+
+func (a *localArchive) Exists(pkg string) bool {
+	_, ok := a.packages[pkg]
+	return ok
+}
+
+// selectPackage returns the package with the given version, or the newest
+// one if version is empty.
+func (a *localArchive) selectPackage(pkg, version string) (*localPackage, error) {
+	var selected *localPackage
+	for _, localPkg := range a.packages[pkg] {
+		if version != "" && localPkg.version != version {
+			continue
+		}
+		if selected == nil || deb.CompareVersions(selected.version, localPkg.version) < 0 {
+			selected = localPkg
+		}
+	}
+	if selected == nil {
+		if version != "" {
+			return nil, fmt.Errorf("cannot find package %q version %s in archive", pkg, version)
+		}
+		return nil, fmt.Errorf("cannot find package %q in archive", pkg)
+	}
+	return selected, nil
+}
+
+func (a *localArchive) Fetch(pkg, version string) (io.ReadSeekCloser, *PackageInfo, error) {
+	localPkg, err := a.selectPackage(pkg, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	logf("Fetching %s...", localPkg.path)
+	info, err := localPkg.info()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read package: %w", err)
+	}
+	file, err := os.Open(localPkg.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read package: %w", err)
+	}
+	return file, info, nil
+}
+
+func (a *localArchive) Info(pkg, version string) (*PackageInfo, error) {
+	localPkg, err := a.selectPackage(pkg, version)
+	if err != nil {
+		return nil, err
+	}
+	info, err := localPkg.info()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read package: %w", err)
+	}
+	return info, nil
+}
+
+// info returns the package information. There is no index holding the
+// digest, so the file is hashed the first time it is needed.
+func (p *localPackage) info() (*PackageInfo, error) {
+	p.digestMutex.Lock()
+	defer p.digestMutex.Unlock()
+	if p.digest == "" {
+		file, err := os.Open(p.path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		if err != nil {
+			return nil, err
+		}
+		p.digest = hex.EncodeToString(h.Sum(nil))
+	}
+	return &PackageInfo{
+		Name:    p.name,
+		Version: p.version,
+		Arch:    p.arch,
+		SHA256:  p.digest,
+	}, nil
+}
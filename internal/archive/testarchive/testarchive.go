@@ -3,11 +3,16 @@ package testarchive
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto"
 	"crypto/sha256"
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp/armor"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
 
@@ -57,6 +62,46 @@ func (gz *Gzip) Content() []byte {
 	return makeGzip(gz.Item.Content())
 }
 
+type Xz struct {
+	Item Item
+}
+
+func (xz *Xz) Path() string {
+	return xz.Item.Path() + ".xz"
+}
+
+func (xz *Xz) Walk(f func(Item) error) error {
+	return CallWalkFunc(xz, f, xz.Item)
+}
+
+func (xz *Xz) Section() []byte {
+	return xz.Item.Section()
+}
+
+func (xz *Xz) Content() []byte {
+	return makeXz(xz.Item.Content())
+}
+
+type Zstd struct {
+	Item Item
+}
+
+func (zst *Zstd) Path() string {
+	return zst.Item.Path() + ".zst"
+}
+
+func (zst *Zstd) Walk(f func(Item) error) error {
+	return CallWalkFunc(zst, f, zst.Item)
+}
+
+func (zst *Zstd) Section() []byte {
+	return zst.Item.Section()
+}
+
+func (zst *Zstd) Content() []byte {
+	return makeZstd(zst.Item.Content())
+}
+
 type Package struct {
 	Name      string
 	Version   string
@@ -107,6 +152,13 @@ type Release struct {
 	Label   string
 	Items   []Item
 	PrivKey *packet.PrivateKey
+	// ValidUntil is the value of the Valid-Until field, if set.
+	ValidUntil string
+	// AcquireByHash is set to also provide the indexes by their digest.
+	AcquireByHash bool
+	// Detached is set to provide the Release file along with its detached
+	// signature in Release.gpg instead of the InRelease file.
+	Detached bool
 }
 
 func (r *Release) Walk(f func(Item) error) error {
@@ -122,11 +174,36 @@ func (r *Release) Section() []byte {
 }
 
 func (r *Release) Content() []byte {
+	var buf bytes.Buffer
+	writer, err := clearsign.Encode(&buf, r.PrivKey, nil)
+	if err != nil {
+		panic(err)
+	}
+	_, err = writer.Write(r.body())
+	if err != nil {
+		panic(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// body returns the unsigned content of the release.
+func (r *Release) body() []byte {
 	digests := bytes.Buffer{}
 	for _, item := range r.Items {
 		content := item.Content()
 		fmt.Fprintf(&digests, " %s  %d  %s\n", makeSha256(content), len(content), item.Path())
 	}
+	var extra string
+	if r.ValidUntil != "" {
+		extra += "Valid-Until: " + r.ValidUntil + "\n"
+	}
+	if r.AcquireByHash {
+		extra += "Acquire-By-Hash: yes\n"
+	}
 	content := fmt.Sprintf(string(testutil.Reindent(`
 		Origin: Ubuntu
 		Label: %s
@@ -134,19 +211,37 @@ func (r *Release) Content() []byte {
 		Version: %s
 		Codename: codename
 		Date: Thu, 21 Apr 2022 17:16:08 UTC
-		Architectures: amd64 arm64 armhf i386 ppc64el riscv64 s390x
+		%sArchitectures: amd64 arm64 armhf i386 ppc64el riscv64 s390x
 		Components: main restricted universe multiverse
 		Description: Ubuntu %s
 		SHA256:
 		%s
-	`)), r.Label, r.Suite, r.Version, r.Version, digests.String())
+	`)), r.Label, r.Suite, r.Version, extra, r.Version, digests.String())
+	return []byte(content)
+}
 
+// detachedSignature returns the armored detached signature of the release
+// body, as found in the Release.gpg file.
+func (r *Release) detachedSignature() []byte {
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   r.PrivKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &r.PrivKey.KeyId,
+	}
+	hash := sig.Hash.New()
+	hash.Write(r.body())
+	err := sig.Sign(hash, r.PrivKey, nil)
+	if err != nil {
+		panic(err)
+	}
 	var buf bytes.Buffer
-	writer, err := clearsign.Encode(&buf, r.PrivKey, nil)
+	writer, err := armor.Encode(&buf, "PGP SIGNATURE", nil)
 	if err != nil {
 		panic(err)
 	}
-	_, err = writer.Write([]byte(content))
+	err = sig.Serialize(writer)
 	if err != nil {
 		panic(err)
 	}
@@ -165,7 +260,16 @@ func (r *Release) Render(prefix string, content map[string][]byte) error {
 		} else {
 			itemPath = path.Join(prefix, "dists", r.Suite, itemPath)
 		}
+		if r.Detached && item == Item(r) {
+			content[path.Join(path.Dir(itemPath), "Release")] = r.body()
+			content[path.Join(path.Dir(itemPath), "Release.gpg")] = r.detachedSignature()
+			return nil
+		}
 		content[itemPath] = item.Content()
+		if r.AcquireByHash && item != Item(r) && !strings.HasPrefix(item.Path(), "pool/") {
+			hashPath := path.Join(path.Dir(itemPath), "by-hash", "SHA256", makeSha256(item.Content()))
+			content[hashPath] = item.Content()
+		}
 		return nil
 	})
 }
@@ -204,6 +308,40 @@ func makeSha256(b []byte) string {
 	return fmt.Sprintf("%x", sha256.Sum256(b))
 }
 
+func makeXz(b []byte) []byte {
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		panic(err)
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		panic(err)
+	}
+	err = w.Close()
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func makeZstd(b []byte) []byte {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		panic(err)
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		panic(err)
+	}
+	err = w.Close()
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
 func makeGzip(b []byte) []byte {
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
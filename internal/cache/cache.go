@@ -3,12 +3,19 @@ package cache
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/juju/fslock"
 )
 
 func DefaultDir(suffix string) string {
@@ -38,6 +45,11 @@ type Writer struct {
 	hash   hash.Hash
 	file   *os.File
 	err    error
+	// path is where the file is found once closed.
+	path string
+	// outside is set when the file is kept outside of the cache because
+	// the cache directory cannot be written.
+	outside bool
 }
 
 func (cw *Writer) fail(err error) error {
@@ -77,14 +89,37 @@ func (cw *Writer) Close() error {
 		return cw.fail(fmt.Errorf("expected digest %s, got %s", cw.digest, digest))
 	}
 	fname := cw.file.Name()
-	err = os.Rename(fname, filepath.Join(filepath.Dir(fname), cw.digest))
-	if err != nil {
-		return cw.fail(err)
+	cw.path = fname
+	if !cw.outside {
+		// Renaming is atomic, so concurrent writers of the same
+		// digest leave a complete file behind in any order.
+		cw.path = filepath.Join(filepath.Dir(fname), cw.digest)
+		err = os.Rename(fname, cw.path)
+		if err != nil {
+			return cw.fail(err)
+		}
 	}
 	cw.err = io.EOF
 	return nil
 }
 
+// Open opens the file written once the writer is successfully closed. This
+// works even when the file could not be stored in the cache.
+func (cw *Writer) Open() (io.ReadSeekCloser, error) {
+	if cw.err != io.EOF {
+		return nil, fmt.Errorf("internal error: cache writer is not closed")
+	}
+	file, err := os.Open(cw.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open cache file: %v", err)
+	}
+	if cw.outside {
+		// The content remains readable until the file is closed.
+		os.Remove(cw.path)
+	}
+	return file, nil
+}
+
 func (cw *Writer) Digest() string {
 	return cw.digest
 }
@@ -101,27 +136,66 @@ func (c *Cache) Create(digest string) *Writer {
 	if c.Dir == "" {
 		return &Writer{err: fmt.Errorf("internal error: cache directory is unset")}
 	}
-	err := os.MkdirAll(filepath.Join(c.Dir, digestKind), 0755)
-	if err != nil {
-		return &Writer{err: fmt.Errorf("cannot create cache directory: %v", err)}
-	}
 	var file *os.File
-	if digest == "" {
+	outside := false
+	err := os.MkdirAll(filepath.Join(c.Dir, digestKind), 0755)
+	if err == nil {
 		file, err = os.CreateTemp(c.filePath(""), "tmp.*")
-	} else {
-		file, err = os.Create(c.filePath(digest + ".tmp"))
+	}
+	if isReadOnly(err) {
+		// The cache may be shared read-only, so keep the data
+		// elsewhere until it is used.
+		outside = true
+		file, err = os.CreateTemp("", "chisel-cache-*")
 	}
 	if err != nil {
 		return &Writer{err: fmt.Errorf("cannot create cache file: %v", err)}
 	}
 	return &Writer{
-		dir:    c.Dir,
-		digest: digest,
-		hash:   sha256.New(),
-		file:   file,
+		dir:     c.Dir,
+		digest:  digest,
+		hash:    sha256.New(),
+		file:    file,
+		outside: outside,
 	}
 }
 
+// isReadOnly returns whether err was caused by the lack of permission to
+// modify a file or directory.
+func isReadOnly(err error) bool {
+	return err != nil && (os.IsPermission(err) || errors.Is(err, syscall.EROFS))
+}
+
+const locksDir = "locks"
+
+// Lock acquires an exclusive lock on the entry for digest, shared by all
+// processes using the cache directory, so that only one of them fetches
+// the same entry at a time. It returns a function that releases the lock.
+// The lock is waited for as long as its holder is alive, as the system
+// releases it when the holder exits. Nothing is locked when the cache
+// directory cannot be written.
+func (c *Cache) Lock(digest string) (unlock func(), err error) {
+	if c.Dir == "" || digest == "" {
+		return func() {}, nil
+	}
+	err = os.MkdirAll(filepath.Join(c.Dir, locksDir), 0755)
+	if err == nil {
+		lock := fslock.New(c.lockPath(digest))
+		err = lock.Lock()
+		if err == nil {
+			return func() { lock.Unlock() }, nil
+		}
+	}
+	if isReadOnly(err) {
+		return func() {}, nil
+	}
+	return nil, fmt.Errorf("cannot lock cache entry: %v", err)
+}
+
+func (c *Cache) lockPath(digest string) string {
+	return filepath.Join(c.Dir, locksDir, digest)
+}
+
 func (c *Cache) Write(digest string, data []byte) error {
 	f := c.Create(digest)
 	_, err1 := f.Write(data)
@@ -145,12 +219,57 @@ func (c *Cache) Open(digest string) (io.ReadSeekCloser, error) {
 	}
 	// Use mtime as last reuse time.
 	now := time.Now()
-	if err := os.Chtimes(filePath, now, now); err != nil {
+	if err := os.Chtimes(filePath, now, now); err != nil && !isReadOnly(err) {
+		file.Close()
 		return nil, fmt.Errorf("cannot update cached file timestamp: %v", err)
 	}
 	return file, nil
 }
 
+// OpenVerified is like Open, but it also checks that the content of the
+// file matches the digest. Files that do not match are moved into
+// quarantine and reported as ErrMiss, so that they may be fetched again.
+func (c *Cache) OpenVerified(digest string) (io.ReadSeekCloser, error) {
+	file, err := c.Open(digest)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read file from cache: %v", err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != digest {
+		file.Close()
+		err = c.quarantine(digest)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrMiss
+	}
+	return file, nil
+}
+
+const quarantineDir = "quarantine"
+
+// quarantine moves the file with the given digest out of the cache and
+// into the quarantine directory, where it is kept for inspection. The file
+// is left in place if the cache directory cannot be written.
+func (c *Cache) quarantine(digest string) error {
+	err := os.MkdirAll(filepath.Join(c.Dir, quarantineDir), 0755)
+	if err == nil {
+		err = os.Rename(c.filePath(digest), filepath.Join(c.Dir, quarantineDir, digest))
+	}
+	if err != nil && !os.IsNotExist(err) && !isReadOnly(err) {
+		return fmt.Errorf("cannot quarantine cache file: %v", err)
+	}
+	return nil
+}
+
 func (c *Cache) Read(digest string) ([]byte, error) {
 	file, err := c.Open(digest)
 	if err != nil {
@@ -164,23 +283,238 @@ func (c *Cache) Read(digest string) ([]byte, error) {
 	return data, nil
 }
 
-func (c *Cache) Expire(timeout time.Duration) error {
-	entries, err := os.ReadDir(filepath.Join(c.Dir, digestKind))
+const refsDir = "refs"
+
+func (c *Cache) refPath(name string) string {
+	return filepath.Join(c.Dir, refsDir, url.PathEscape(name))
+}
+
+// SetRef records digest under the given name, replacing any digest that
+// was previously recorded for it. Nothing is recorded when the cache
+// directory cannot be written.
+func (c *Cache) SetRef(name, digest string) error {
+	if c.Dir == "" {
+		return fmt.Errorf("internal error: cache directory is unset")
+	}
+	var file *os.File
+	err := os.MkdirAll(filepath.Join(c.Dir, refsDir), 0755)
+	if err == nil {
+		file, err = os.CreateTemp(filepath.Join(c.Dir, refsDir), "tmp.*")
+	}
+	if isReadOnly(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot create cache ref: %v", err)
+	}
+	_, err = file.WriteString(digest)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), c.refPath(name))
+	}
 	if err != nil {
-		return fmt.Errorf("cannot list cache directory: %v", err)
+		os.Remove(file.Name())
+		return fmt.Errorf("cannot write cache ref: %v", err)
+	}
+	return nil
+}
+
+// Ref returns the digest recorded under the given name, or ErrMiss if
+// there is none.
+func (c *Cache) Ref(name string) (string, error) {
+	if c.Dir == "" {
+		return "", ErrMiss
+	}
+	data, err := os.ReadFile(c.refPath(name))
+	if os.IsNotExist(err) {
+		return "", ErrMiss
+	} else if err != nil {
+		return "", fmt.Errorf("cannot read cache ref: %v", err)
+	}
+	return string(data), nil
+}
+
+// Expire removes the entries which were not used within the timeout, except
+// for those locked by a process fetching them. It returns the entries
+// removed.
+func (c *Cache) Expire(timeout time.Duration) ([]*Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
 	}
 	expired := time.Now().Add(-timeout)
+	var removed []*Entry
 	for _, entry := range entries {
-		finfo, err := entry.Info()
+		if entry.LastUsed.After(expired) {
+			// Entries are sorted by the time they were last used.
+			break
+		}
+		ok, err := c.removeUnused(entry)
 		if err != nil {
-			return err
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, entry)
+		}
+	}
+	return removed, nil
+}
+
+// Entry describes a file stored in the cache.
+type Entry struct {
+	Digest string
+	Size   int64
+	// LastUsed is the time the entry was last written or opened.
+	LastUsed time.Time
+}
+
+// Entries returns the entries in the cache, least recently used first.
+func (c *Cache) Entries() ([]*Entry, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(c.Dir, digestKind))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot list cache directory: %v", err)
+	}
+	var entries []*Entry
+	for _, dirEntry := range dirEntries {
+		if strings.Contains(dirEntry.Name(), ".") {
+			// Still being written.
+			continue
 		}
-		if finfo.ModTime().After(expired) {
+		finfo, err := dirEntry.Info()
+		if os.IsNotExist(err) {
 			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot stat cache entry: %v", err)
 		}
-		err = os.Remove(filepath.Join(c.Dir, digestKind, finfo.Name()))
+		entries = append(entries, &Entry{
+			Digest:   finfo.Name(),
+			Size:     finfo.Size(),
+			LastUsed: finfo.ModTime(),
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Remove removes the entry with the given digest from the cache. Its lock
+// file is left in place, as other processes may be waiting on it.
+func (c *Cache) Remove(digest string) error {
+	err := os.Remove(c.filePath(digest))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove cache entry: %v", err)
+	}
+	return nil
+}
+
+// removeUnused removes the entry unless it is locked by a process fetching
+// it, or it was used since it was listed. It returns whether the entry was
+// removed.
+func (c *Cache) removeUnused(entry *Entry) (bool, error) {
+	lock := fslock.New(c.lockPath(entry.Digest))
+	err := lock.TryLock()
+	if err == fslock.ErrLocked {
+		return false, nil
+	} else if err == nil {
+		defer lock.Unlock()
+	} else if !os.IsNotExist(err) && !isReadOnly(err) {
+		return false, fmt.Errorf("cannot lock cache entry: %v", err)
+	}
+	finfo, err := os.Stat(c.filePath(entry.Digest))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("cannot stat cache entry: %v", err)
+	}
+	if finfo.ModTime().After(entry.LastUsed) {
+		return false, nil
+	}
+	err = c.Remove(entry.Digest)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Prune removes the least recently used entries until the total size of
+// the entries left is at most maxSize bytes, except for those locked by a
+// process fetching them. It returns the entries removed.
+func (c *Cache) Prune(maxSize int64) ([]*Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	var removed []*Entry
+	for _, entry := range entries {
+		if total <= maxSize {
+			break
+		}
+		ok, err := c.removeUnused(entry)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			total -= entry.Size
+			removed = append(removed, entry)
+		}
+	}
+	return removed, nil
+}
+
+// Verify checks that the content of every entry matches its digest, and
+// moves the entries that do not into quarantine. It returns the entries
+// quarantined.
+func (c *Cache) Verify() ([]*Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var quarantined []*Entry
+	for _, entry := range entries {
+		file, err := os.Open(c.filePath(entry.Digest))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return quarantined, fmt.Errorf("cannot open cache file: %v", err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return quarantined, fmt.Errorf("cannot read file from cache: %v", err)
+		}
+		if hex.EncodeToString(h.Sum(nil)) == entry.Digest {
+			continue
+		}
+		err = c.quarantine(entry.Digest)
+		if err != nil {
+			return quarantined, err
+		}
+		quarantined = append(quarantined, entry)
+	}
+	return quarantined, nil
+}
+
+// Clean removes all entries, refs and quarantined files from the cache.
+// Lock files are left in place, as other processes may be waiting on them.
+func (c *Cache) Clean() error {
+	if c.Dir == "" {
+		return fmt.Errorf("internal error: cache directory is unset")
+	}
+	for _, dir := range []string{digestKind, refsDir, quarantineDir} {
+		err := os.RemoveAll(filepath.Join(c.Dir, dir))
 		if err != nil {
-			return fmt.Errorf("cannot expire cache entry: %v", err)
+			return fmt.Errorf("cannot clean cache: %v", err)
 		}
 	}
 	return nil
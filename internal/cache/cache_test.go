@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/canonical/chisel/internal/cache"
+	"github.com/canonical/chisel/internal/testutil"
 )
 
 const (
@@ -89,8 +90,10 @@ func (s *S) TestCacheReadWrite(c *C) {
 	err = os.Chtimes(data1Path, now, expired)
 	c.Assert(err, IsNil)
 
-	err = cc.Expire(time.Hour)
+	removed, err := cc.Expire(time.Hour)
 	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 1)
+	c.Assert(removed[0].Digest, Equals, data1Digest)
 	_, err = os.Stat(data1Path)
 	c.Assert(os.IsNotExist(err), Equals, true)
 }
@@ -151,3 +154,340 @@ func (s *S) TestCacheOpen(c *C) {
 
 	c.Assert(string(data1), Equals, "data1")
 }
+
+func (s *S) TestCacheRef(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	_, err := cc.Ref("http://example.com/dists/jammy/InRelease")
+	c.Assert(err, Equals, cache.ErrMiss)
+
+	err = cc.SetRef("http://example.com/dists/jammy/InRelease", data1Digest)
+	c.Assert(err, IsNil)
+	err = cc.SetRef("http://example.com/dists/noble/InRelease", data2Digest)
+	c.Assert(err, IsNil)
+
+	digest, err := cc.Ref("http://example.com/dists/jammy/InRelease")
+	c.Assert(err, IsNil)
+	c.Assert(digest, Equals, data1Digest)
+
+	// Refs are replaced.
+	err = cc.SetRef("http://example.com/dists/jammy/InRelease", data3Digest)
+	c.Assert(err, IsNil)
+	digest, err = cc.Ref("http://example.com/dists/jammy/InRelease")
+	c.Assert(err, IsNil)
+	c.Assert(digest, Equals, data3Digest)
+
+	entries, err := os.ReadDir(filepath.Join(cc.Dir, "refs"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+}
+
+func (s *S) TestCacheEntries(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	entries, err := cc.Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+
+	err = cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = cc.Write(data2Digest, []byte("data2"))
+	c.Assert(err, IsNil)
+	err = cc.Write(data3Digest, []byte("data3"))
+	c.Assert(err, IsNil)
+
+	// Unfinished writes are not listed.
+	w := cc.Create("")
+	_, err = w.Write([]byte("data4"))
+	c.Assert(err, IsNil)
+
+	now := time.Now()
+	setTime := func(digest string, t time.Time) {
+		err := os.Chtimes(filepath.Join(cc.Dir, "sha256", digest), t, t)
+		c.Assert(err, IsNil)
+	}
+	setTime(data1Digest, now.Add(-1*time.Hour))
+	setTime(data2Digest, now.Add(-3*time.Hour))
+	setTime(data3Digest, now.Add(-2*time.Hour))
+
+	entries, err = cc.Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 3)
+	c.Assert(entries[0].Digest, Equals, data2Digest)
+	c.Assert(entries[0].Size, Equals, int64(5))
+	c.Assert(entries[1].Digest, Equals, data3Digest)
+	c.Assert(entries[2].Digest, Equals, data1Digest)
+
+	// Opening an entry makes it the most recently used.
+	f, err := cc.Open(data2Digest)
+	c.Assert(err, IsNil)
+	f.Close()
+	entries, err = cc.Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries[2].Digest, Equals, data2Digest)
+
+	err = w.Close()
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestCachePrune(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	now := time.Now()
+	for i, item := range []struct{ digest, data string }{
+		{data1Digest, "data1"},
+		{data2Digest, "data2"},
+		{data3Digest, "data3"},
+	} {
+		err := cc.Write(item.digest, []byte(item.data))
+		c.Assert(err, IsNil)
+		t := now.Add(time.Duration(i-3) * time.Hour)
+		err = os.Chtimes(filepath.Join(cc.Dir, "sha256", item.digest), t, t)
+		c.Assert(err, IsNil)
+	}
+
+	removed, err := cc.Prune(15)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 0)
+
+	removed, err = cc.Prune(11)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 1)
+	c.Assert(removed[0].Digest, Equals, data1Digest)
+
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+	_, err = cc.Read(data2Digest)
+	c.Assert(err, IsNil)
+
+	removed, err = cc.Prune(0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 2)
+	entries, err := cc.Entries()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
+func (s *S) TestCacheVerify(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = cc.Write(data2Digest, []byte("data2"))
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(cc.Dir, "sha256", data2Digest), []byte("corrupted"), 0644)
+	c.Assert(err, IsNil)
+
+	quarantined, err := cc.Verify()
+	c.Assert(err, IsNil)
+	c.Assert(quarantined, HasLen, 1)
+	c.Assert(quarantined[0].Digest, Equals, data2Digest)
+
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	_, err = cc.Read(data2Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+	data, err := os.ReadFile(filepath.Join(cc.Dir, "quarantine", data2Digest))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "corrupted")
+}
+
+func (s *S) TestCacheClean(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = cc.SetRef("ref", data1Digest)
+	c.Assert(err, IsNil)
+
+	err = cc.Clean()
+	c.Assert(err, IsNil)
+
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+	_, err = cc.Ref("ref")
+	c.Assert(err, Equals, cache.ErrMiss)
+}
+
+func (s *S) TestCacheOpenVerified(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+
+	f, err := cc.OpenVerified(data1Digest)
+	c.Assert(err, IsNil)
+	data, err := io.ReadAll(f)
+	f.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data1")
+
+	// Truncate the cached file.
+	err = os.WriteFile(filepath.Join(cc.Dir, "sha256", data1Digest), []byte("da"), 0644)
+	c.Assert(err, IsNil)
+
+	// Plain opening does not notice.
+	f, err = cc.Open(data1Digest)
+	c.Assert(err, IsNil)
+	f.Close()
+
+	_, err = cc.OpenVerified(data1Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+	_, err = cc.Open(data1Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+	data, err = os.ReadFile(filepath.Join(cc.Dir, "quarantine", data1Digest))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "da")
+
+	// The entry may be written again.
+	err = cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	f, err = cc.OpenVerified(data1Digest)
+	c.Assert(err, IsNil)
+	f.Close()
+}
+
+func (s *S) TestCacheLock(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	unlock, err := cc.Lock(data1Digest)
+	c.Assert(err, IsNil)
+
+	// Other digests are not affected.
+	unlock2, err := cc.Lock(data2Digest)
+	c.Assert(err, IsNil)
+	unlock2()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := cc.Lock(data1Digest)
+		c.Check(err, IsNil)
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		c.Fatalf("lock acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("lock not released")
+	}
+}
+
+func (s *S) TestCachePruneLocked(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = cc.Write(data2Digest, []byte("data2"))
+	c.Assert(err, IsNil)
+
+	unlock, err := cc.Lock(data1Digest)
+	c.Assert(err, IsNil)
+
+	// Locked entries are kept along with their lock file.
+	removed, err := cc.Prune(0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 1)
+	c.Assert(removed[0].Digest, Equals, data2Digest)
+	removed, err = cc.Expire(0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 0)
+	_, err = cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Join(cc.Dir, "locks", data1Digest), testutil.FilePresent)
+
+	// The lock is still effective.
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := cc.Lock(data1Digest)
+		c.Check(err, IsNil)
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		c.Fatalf("lock acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	// Lock files are never removed, as processes may be waiting on them.
+	removed, err = cc.Prune(0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 1)
+	c.Assert(filepath.Join(cc.Dir, "locks", data1Digest), testutil.FilePresent)
+	err = cc.Clean()
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Join(cc.Dir, "locks", data1Digest), testutil.FilePresent)
+}
+
+func (s *S) TestCacheConcurrentCreate(c *C) {
+	cc := cache.Cache{Dir: c.MkDir()}
+
+	w1 := cc.Create(data1Digest)
+	w2 := cc.Create(data1Digest)
+	_, err := w1.Write([]byte("data1"))
+	c.Assert(err, IsNil)
+	_, err = w2.Write([]byte("da"))
+	c.Assert(err, IsNil)
+	c.Assert(w1.Close(), IsNil)
+	_, err = w2.Write([]byte("ta1"))
+	c.Assert(err, IsNil)
+	c.Assert(w2.Close(), IsNil)
+
+	data, err := cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data1")
+
+	f, err := w2.Open()
+	c.Assert(err, IsNil)
+	data, err = io.ReadAll(f)
+	f.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data1")
+}
+
+func (s *S) TestCacheReadOnly(c *C) {
+	if os.Getuid() == 0 {
+		c.Skip("test cannot run as root")
+	}
+	cc := cache.Cache{Dir: c.MkDir()}
+	err := cc.Write(data1Digest, []byte("data1"))
+	c.Assert(err, IsNil)
+	err = os.Chmod(filepath.Join(cc.Dir, "sha256", data1Digest), 0444)
+	c.Assert(err, IsNil)
+	err = os.Chmod(filepath.Join(cc.Dir, "sha256"), 0555)
+	c.Assert(err, IsNil)
+	err = os.Chmod(cc.Dir, 0555)
+	c.Assert(err, IsNil)
+	defer os.Chmod(filepath.Join(cc.Dir, "sha256"), 0755)
+	defer os.Chmod(cc.Dir, 0755)
+
+	data, err := cc.Read(data1Digest)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data1")
+
+	unlock, err := cc.Lock(data2Digest)
+	c.Assert(err, IsNil)
+	unlock()
+
+	// New data is kept outside of the cache.
+	w := cc.Create(data2Digest)
+	_, err = w.Write([]byte("data2"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	f, err := w.Open()
+	c.Assert(err, IsNil)
+	data, err = io.ReadAll(f)
+	f.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data2")
+	_, err = cc.Open(data2Digest)
+	c.Assert(err, Equals, cache.ErrMiss)
+}
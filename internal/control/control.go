@@ -142,3 +142,12 @@ func ParseString(sectionKey, content string) (File, error) {
 		sectionKey: sectionKey,
 	}, nil
 }
+
+// ParseSection parses content holding a single section, such as the control
+// file of a binary package. Anything past the first section is ignored.
+func ParseSection(content string) Section {
+	if end := strings.Index(content, "\n\n"); end >= 0 {
+		content = content[:end]
+	}
+	return &ctrlSection{content}
+}
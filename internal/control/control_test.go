@@ -80,6 +80,15 @@ func (s *S) TestParseReader(c *C) {
 	}
 }
 
+func (s *S) TestParseSection(c *C) {
+	section := control.ParseSection(testFile)
+	for key, value := range testFileResults["one"] {
+		c.Assert(section.Get(key), Equals, value, Commentf("Key %q", key))
+	}
+	// Fields of the sections after the first one are not visible.
+	c.Assert(control.ParseSection("Line: one\n\nOther: two\n").Get("Other"), Equals, "")
+}
+
 func BenchmarkParse(b *testing.B) {
 	data, err := os.ReadFile("Packages")
 	if err != nil {
@@ -0,0 +1,156 @@
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/canonical/chisel/internal/control"
+)
+
+// maintainerScripts lists the names of the maintainer scripts which may be
+// present in the control tarball, as described in deb-control(5).
+var maintainerScripts = []string{"preinst", "postinst", "prerm", "postrm", "config"}
+
+// PackageControl holds the content of the control tarball of a package.
+type PackageControl struct {
+	// Control holds the package stanza from the control file.
+	Control string
+	// Conffiles lists the absolute paths of the configuration files.
+	Conffiles []string
+	// MD5Sums maps the absolute paths of the package files to their MD5
+	// digest.
+	MD5Sums map[string]string
+	// Triggers holds the content of the triggers file.
+	Triggers string
+	// Scripts maps the names of the maintainer scripts present to their
+	// content.
+	Scripts map[string]string
+
+	section control.Section
+}
+
+// Field returns the value of the given field of the control stanza, or the
+// empty string if it is not set.
+func (c *PackageControl) Field(key string) string {
+	return c.section.Get(key)
+}
+
+// TrivialScript returns whether the named maintainer script is missing or
+// holds no logic, meaning it only has comments, blank lines, and the "set"
+// or "exit 0" commands usually found in otherwise empty scripts.
+func (c *PackageControl) TrivialScript(name string) bool {
+	for _, line := range strings.Split(c.Scripts[name], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "exit 0" ||
+			line == "set" || strings.HasPrefix(line, "set ") {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// ReadControl reads the content of the control tarball of the package. The
+// control file is required, while the other members are optional.
+func ReadControl(pkgReader io.ReadSeeker) (*PackageControl, error) {
+	controlReader, err := ControlReader(pkgReader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read package control: %w", err)
+	}
+	defer controlReader.Close()
+
+	pkgControl := &PackageControl{
+		MD5Sums: make(map[string]string),
+		Scripts: make(map[string]string),
+	}
+	hasControl := false
+	tarReader := tar.NewReader(controlReader)
+	for {
+		tarHeader, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read package control: %w", err)
+		}
+		if !tarHeader.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		name := strings.TrimPrefix(tarHeader.Name, "./")
+		isScript := slices.Contains(maintainerScripts, name)
+		if name != "control" && name != "conffiles" && name != "md5sums" && name != "triggers" && !isScript {
+			continue
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read package control: %w", err)
+		}
+		content := string(data)
+		switch {
+		case name == "control":
+			hasControl = true
+			pkgControl.Control = content
+		case name == "conffiles":
+			pkgControl.Conffiles = parseConffiles(content)
+		case name == "md5sums":
+			pkgControl.MD5Sums, err = parseMD5Sums(content)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read package control: %w", err)
+			}
+		case name == "triggers":
+			pkgControl.Triggers = content
+		case isScript:
+			pkgControl.Scripts[name] = content
+		}
+	}
+	if !hasControl {
+		return nil, fmt.Errorf("cannot read package control: no control file")
+	}
+
+	pkgControl.section = control.ParseSection(pkgControl.Control)
+	if pkgControl.section.Get("Package") == "" {
+		return nil, fmt.Errorf("cannot read package control: control file has no package stanza")
+	}
+	return pkgControl, nil
+}
+
+// parseConffiles returns the paths listed in the conffiles member, which
+// may be preceded by flags such as "remove-on-upgrade".
+func parseConffiles(content string) []string {
+	var paths []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if i := strings.Index(line, " /"); i >= 0 && !strings.HasPrefix(line, "/") {
+			line = line[i+1:]
+		}
+		paths = append(paths, line)
+	}
+	return paths
+}
+
+// parseMD5Sums parses the md5sums member, where each line holds a digest
+// followed by a path relative to the root.
+func parseMD5Sums(content string) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sum, path, ok := strings.Cut(line, " ")
+		path = strings.TrimLeft(path, " *")
+		if !ok || len(sum) != 32 || path == "" {
+			return nil, fmt.Errorf("invalid md5sums line: %q", line)
+		}
+		sums["/"+strings.TrimPrefix(path, "/")] = sum
+	}
+	return sums, scanner.Err()
+}
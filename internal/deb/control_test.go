@@ -0,0 +1,136 @@
+package deb_test
+
+import (
+	"bytes"
+	"slices"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var readControlTests = []struct {
+	summary    string
+	pkgdata    []byte
+	control    *deb.PackageControl
+	fields     map[string]string
+	nonTrivial []string
+	error      string
+}{{
+	summary: "Read all control members",
+	pkgdata: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./control", `Package: test-package
+Source: test-source (1.0-1)
+Version: 1.0-1ubuntu1
+Architecture: amd64
+Installed-Size: 42
+Depends: libc6 (>= 2.34)
+Homepage: https://example.com
+Description: Test package
+ With a long description.
+`),
+		testutil.Reg(0644, "./conffiles", "/etc/test.conf\nremove-on-upgrade /etc/old.conf\n"),
+		testutil.Reg(0644, "./md5sums", "d41d8cd98f00b204e9800998ecf8427e  usr/bin/test\n"+
+			"0cc175b9c0f1b6a831c399e269772661  usr/share/doc/test-package/copyright\n"),
+		testutil.Reg(0644, "./triggers", "activate-noawait ldconfig\n"),
+		testutil.Reg(0755, "./preinst", "#!/bin/sh\nset -e\n# Nothing to do.\n\nexit 0\n"),
+		testutil.Reg(0755, "./postinst", "#!/bin/sh\nset -e\nldconfig\n"),
+		testutil.Reg(0644, "./shlibs", "libtest 1 test-package\n"),
+	}, testutil.TestPackageEntries),
+	control: &deb.PackageControl{
+		Control: `Package: test-package
+Source: test-source (1.0-1)
+Version: 1.0-1ubuntu1
+Architecture: amd64
+Installed-Size: 42
+Depends: libc6 (>= 2.34)
+Homepage: https://example.com
+Description: Test package
+ With a long description.
+`,
+		Conffiles: []string{"/etc/test.conf", "/etc/old.conf"},
+		MD5Sums: map[string]string{
+			"/usr/bin/test":                         "d41d8cd98f00b204e9800998ecf8427e",
+			"/usr/share/doc/test-package/copyright": "0cc175b9c0f1b6a831c399e269772661",
+		},
+		Triggers: "activate-noawait ldconfig\n",
+		Scripts: map[string]string{
+			"preinst":  "#!/bin/sh\nset -e\n# Nothing to do.\n\nexit 0\n",
+			"postinst": "#!/bin/sh\nset -e\nldconfig\n",
+		},
+	},
+	fields: map[string]string{
+		"Source":         "test-source (1.0-1)",
+		"Installed-Size": "42",
+		"Depends":        "libc6 (>= 2.34)",
+		"Homepage":       "https://example.com",
+		"Pre-Depends":    "",
+	},
+	nonTrivial: []string{"postinst"},
+}, {
+	summary: "Only the control file is required",
+	pkgdata: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./control", "Package: test-package\nVersion: 1.0\n"),
+	}, testutil.TestPackageEntries),
+	control: &deb.PackageControl{
+		Control: "Package: test-package\nVersion: 1.0\n",
+		MD5Sums: map[string]string{},
+		Scripts: map[string]string{},
+	},
+	fields: map[string]string{
+		"Version": "1.0",
+	},
+}, {
+	summary: "Package without control payload",
+	pkgdata: testutil.PackageData["test-package"],
+	error:   `cannot read package control: no control payload`,
+}, {
+	summary: "Control payload without control file",
+	pkgdata: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./md5sums", ""),
+	}, testutil.TestPackageEntries),
+	error: `cannot read package control: no control file`,
+}, {
+	summary: "Control file without package stanza",
+	pkgdata: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./control", "Version: 1.0\n"),
+	}, testutil.TestPackageEntries),
+	error: `cannot read package control: control file has no package stanza`,
+}, {
+	summary: "Invalid md5sums",
+	pkgdata: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./control", "Package: test-package\n"),
+		testutil.Reg(0644, "./md5sums", "foo\n"),
+	}, testutil.TestPackageEntries),
+	error: `cannot read package control: invalid md5sums line: "foo"`,
+}}
+
+func (s *S) TestReadControl(c *C) {
+	for _, test := range readControlTests {
+		c.Logf("Summary: %s", test.summary)
+		pkgControl, err := deb.ReadControl(bytes.NewReader(test.pkgdata))
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		for key, value := range test.fields {
+			c.Assert(pkgControl.Field(key), Equals, value)
+		}
+		for _, name := range []string{"preinst", "postinst", "prerm", "postrm", "config"} {
+			trivial := !slices.Contains(test.nonTrivial, name)
+			c.Assert(pkgControl.TrivialScript(name), Equals, trivial)
+		}
+		c.Assert(pkgControl.Control, Equals, test.control.Control)
+		c.Assert(pkgControl.Conffiles, DeepEquals, test.control.Conffiles)
+		c.Assert(pkgControl.MD5Sums, DeepEquals, test.control.MD5Sums)
+		c.Assert(pkgControl.Triggers, Equals, test.control.Triggers)
+		c.Assert(pkgControl.Scripts, DeepEquals, test.control.Scripts)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -382,39 +383,57 @@ func extractHardLinks(pkgReader io.ReadSeeker, opts *extractHardLinkOptions) err
 // DataReader takes a Reader for the ar file belonging to a Debian package and
 // returns a Reader to the inner tarball.
 func DataReader(pkgReader io.ReadSeeker) (io.ReadCloser, error) {
+	return memberReader(pkgReader, "data")
+}
+
+// ErrNoControl is returned when the package has no control tarball.
+var ErrNoControl = errors.New("no control payload")
+
+// ControlReader returns a reader for the tarball holding the package control
+// information, such as the control file and the maintainer scripts.
+func ControlReader(pkgReader io.ReadSeeker) (io.ReadCloser, error) {
+	return memberReader(pkgReader, "control")
+}
+
+// memberReader returns a reader for the decompressed content of the first
+// "<name>.tar.*" member of the package archive.
+func memberReader(pkgReader io.ReadSeeker, name string) (io.ReadCloser, error) {
 	arReader := ar.NewReader(pkgReader)
-	var dataReader io.ReadCloser
-	for dataReader == nil {
+	var tarReader io.ReadCloser
+	for tarReader == nil {
 		arHeader, err := arReader.Next()
 		if err == io.EOF {
-			return nil, fmt.Errorf("no data payload")
+			if name == "control" {
+				return nil, ErrNoControl
+			}
+			return nil, fmt.Errorf("no %s payload", name)
 		}
 		if err != nil {
 			return nil, err
 		}
 		switch arHeader.Name {
-		case "data.tar.gz":
+		case name + ".tar.gz":
 			gzipReader, err := gzip.NewReader(arReader)
 			if err != nil {
 				return nil, err
 			}
-			dataReader = gzipReader
-		case "data.tar.xz":
+			tarReader = gzipReader
+		case name + ".tar.xz":
 			xzReader, err := xz.NewReader(arReader)
 			if err != nil {
 				return nil, err
 			}
-			dataReader = io.NopCloser(xzReader)
-		case "data.tar.zst":
+			tarReader = io.NopCloser(xzReader)
+		case name + ".tar.zst":
 			zstdReader, err := zstd.NewReader(arReader)
 			if err != nil {
 				return nil, err
 			}
-			dataReader = zstdReader.IOReadCloser()
+			tarReader = zstdReader.IOReadCloser()
 		}
 	}
 
-	return dataReader, nil
+	return tarReader, nil
 }
 
 func parentDirs(path string) []string {
@@ -0,0 +1,75 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// NewClient returns an HTTP client with the provided timeout, configured
+// from the following environment variables:
+//
+//   - CHISEL_PROXY: URL of the proxy used for all requests. If unset, the
+//     standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables are used.
+//   - CHISEL_CA_CERTS: path to a file with PEM encoded certificates trusted
+//     in addition to the system ones.
+//   - CHISEL_CLIENT_CERT and CHISEL_CLIENT_KEY: paths to the PEM encoded
+//     certificate and private key presented to servers that require them.
+func NewClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := newTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
+
+func newTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if v := os.Getenv("CHISEL_PROXY"); v != "" {
+		proxyURL, err := url.Parse(v)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid CHISEL_PROXY value: %q", v)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+	if v := os.Getenv("CHISEL_CA_CERTS"); v != "" {
+		data, err := os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("cannot find CA certificates in %s", v)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile := os.Getenv("CHISEL_CLIENT_CERT")
+	keyFile := os.Getenv("CHISEL_CLIENT_KEY")
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("CHISEL_CLIENT_CERT and CHISEL_CLIENT_KEY must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
@@ -0,0 +1,221 @@
+package httputil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/httputil"
+)
+
+func fakeEnv(name, value string) (restore func()) {
+	origValue, origSet := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if origSet {
+			os.Setenv(name, origValue)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func get(c *C, client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	return string(data), nil
+}
+
+// writeCertPEM writes the certificate and, if set, its private key to PEM
+// files in dir and returns their paths.
+func writeCertPEM(c *C, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) (certFile, keyFile string) {
+	certFile = filepath.Join(dir, "cert.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	err := os.WriteFile(certFile, data, 0644)
+	c.Assert(err, IsNil)
+	if key == nil {
+		return certFile, ""
+	}
+	keyData, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+	keyFile = filepath.Join(dir, "key.pem")
+	data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData})
+	err = os.WriteFile(keyFile, data, 0600)
+	c.Assert(err, IsNil)
+	return certFile, keyFile
+}
+
+func makeClientCert(c *C) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chisel-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	data, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(data)
+	c.Assert(err, IsNil)
+	return cert, key
+}
+
+func (s *S) TestDefaultClient(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(client.Timeout, Equals, time.Minute)
+	body, err := get(c, client, server.URL)
+	c.Assert(err, IsNil)
+	c.Assert(body, Equals, "ok")
+}
+
+func (s *S) TestProxy(c *C) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	restore := fakeEnv("CHISEL_PROXY", proxy.URL)
+	defer restore()
+
+	client, err := httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	body, err := get(c, client, "http://archive.example.com/ubuntu/")
+	c.Assert(err, IsNil)
+	c.Assert(body, Equals, "proxied http://archive.example.com/ubuntu/")
+}
+
+func (s *S) TestCACerts(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Untrusted by default.
+	client, err := httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	_, err = get(c, client, server.URL)
+	c.Assert(err, ErrorMatches, `.*certificate.*`)
+
+	certFile, _ := writeCertPEM(c, c.MkDir(), server.Certificate(), nil)
+	restore := fakeEnv("CHISEL_CA_CERTS", certFile)
+	defer restore()
+
+	client, err = httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	body, err := get(c, client, server.URL)
+	c.Assert(err, IsNil)
+	c.Assert(body, Equals, "ok")
+}
+
+func (s *S) TestClientCert(c *C) {
+	clientCert, clientKey := makeClientCert(c)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile, _ := writeCertPEM(c, c.MkDir(), server.Certificate(), nil)
+	restore := fakeEnv("CHISEL_CA_CERTS", caFile)
+	defer restore()
+
+	// Rejected without a client certificate.
+	client, err := httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	_, err = get(c, client, server.URL)
+	c.Assert(err, NotNil)
+
+	certFile, keyFile := writeCertPEM(c, c.MkDir(), clientCert, clientKey)
+	restore = fakeEnv("CHISEL_CLIENT_CERT", certFile)
+	defer restore()
+	restore = fakeEnv("CHISEL_CLIENT_KEY", keyFile)
+	defer restore()
+
+	client, err = httputil.NewClient(time.Minute)
+	c.Assert(err, IsNil)
+	body, err := get(c, client, server.URL)
+	c.Assert(err, IsNil)
+	c.Assert(body, Equals, "hello chisel-test")
+}
+
+var configErrorTests = []struct {
+	summary string
+	env     map[string]string
+	error   string
+}{{
+	summary: "Invalid proxy",
+	env:     map[string]string{"CHISEL_PROXY": "foo"},
+	error:   `invalid CHISEL_PROXY value: "foo"`,
+}, {
+	summary: "Missing CA certificates file",
+	env:     map[string]string{"CHISEL_CA_CERTS": "/non-existent"},
+	error:   `cannot read CA certificates: open /non-existent: no such file or directory`,
+}, {
+	summary: "Client certificate without key",
+	env:     map[string]string{"CHISEL_CLIENT_CERT": "/cert.pem"},
+	error:   `CHISEL_CLIENT_CERT and CHISEL_CLIENT_KEY must be set together`,
+}, {
+	summary: "Missing client certificate",
+	env:     map[string]string{"CHISEL_CLIENT_CERT": "/non-existent", "CHISEL_CLIENT_KEY": "/non-existent"},
+	error:   `cannot load client certificate: open /non-existent: no such file or directory`,
+}}
+
+func (s *S) TestConfigErrors(c *C) {
+	for _, test := range configErrorTests {
+		c.Logf("Summary: %s", test.summary)
+		var restores []func()
+		for name, value := range test.env {
+			restores = append(restores, fakeEnv(name, value))
+		}
+		_, err := httputil.NewClient(time.Minute)
+		for _, restore := range restores {
+			restore()
+		}
+		c.Assert(err, ErrorMatches, test.error)
+	}
+}
+
+func (s *S) TestInvalidCACerts(c *C) {
+	caFile := filepath.Join(c.MkDir(), "ca.pem")
+	err := os.WriteFile(caFile, []byte("foo"), 0644)
+	c.Assert(err, IsNil)
+	restore := fakeEnv("CHISEL_CA_CERTS", caFile)
+	defer restore()
+
+	_, err = httputil.NewClient(time.Minute)
+	c.Assert(err, ErrorMatches, `cannot find CA certificates in .*/ca.pem`)
+}
@@ -0,0 +1,199 @@
+package lockfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lock records the outcome of resolving a selection of slices, so that a
+// later cut can verify it resolves to exactly the same packages.
+type Lock struct {
+	// ReleaseETag identifies the revision of the release used, if known.
+	ReleaseETag string
+	// Slices holds the names of all selected slices, sorted.
+	Slices []string
+	// Packages holds the packages used, sorted by name and architecture.
+	Packages []*Package
+}
+
+type Package struct {
+	Name    string
+	Version string
+	Arch    string
+	Archive string
+	SHA256  string
+}
+
+const format = "v1"
+
+type yamlLock struct {
+	Format   string        `yaml:"format"`
+	Release  yamlRelease   `yaml:"release,omitempty"`
+	Slices   []string      `yaml:"slices"`
+	Packages []yamlPackage `yaml:"packages"`
+}
+
+type yamlRelease struct {
+	ETag string `yaml:"etag,omitempty"`
+}
+
+type yamlPackage struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Arch    string `yaml:"arch"`
+	Archive string `yaml:"archive"`
+	SHA256  string `yaml:"sha256"`
+}
+
+// Read reads the lock file at path.
+func Read(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read lock file: %w", err)
+	}
+	var yamlVar yamlLock
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&yamlVar)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse lock file %s: %w", path, err)
+	}
+	if yamlVar.Format != format {
+		return nil, fmt.Errorf("lock file %s has unknown format %q", path, yamlVar.Format)
+	}
+	lock := &Lock{
+		ReleaseETag: yamlVar.Release.ETag,
+		Slices:      yamlVar.Slices,
+	}
+	keys := make(map[string]bool)
+	for _, pkg := range yamlVar.Packages {
+		if pkg.Name == "" || pkg.Version == "" || pkg.SHA256 == "" {
+			return nil, fmt.Errorf("lock file %s has incomplete package entry", path)
+		}
+		lockPkg := &Package{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Arch:    pkg.Arch,
+			Archive: pkg.Archive,
+			SHA256:  pkg.SHA256,
+		}
+		if keys[lockPkg.key()] {
+			return nil, fmt.Errorf("lock file %s lists package %q more than once", path, lockPkg.Name)
+		}
+		keys[lockPkg.key()] = true
+		lock.Packages = append(lock.Packages, lockPkg)
+	}
+	return lock, nil
+}
+
+// Write writes the lock to the file at path, sorting slices and packages so
+// that the output is stable.
+func Write(path string, lock *Lock) error {
+	yamlVar := yamlLock{
+		Format:  format,
+		Release: yamlRelease{ETag: lock.ReleaseETag},
+		Slices:  slices.Sorted(slices.Values(lock.Slices)),
+	}
+	for _, pkg := range lock.Packages {
+		yamlVar.Packages = append(yamlVar.Packages, yamlPackage{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Arch:    pkg.Arch,
+			Archive: pkg.Archive,
+			SHA256:  pkg.SHA256,
+		})
+	}
+	slices.SortFunc(yamlVar.Packages, func(a, b yamlPackage) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Arch, b.Arch)
+	})
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(&yamlVar)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot encode lock file: %w", err)
+	}
+	err = os.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write lock file: %w", err)
+	}
+	return nil
+}
+
+// Diff returns a description of each difference between the old and new
+// locks, or nil if they are equivalent.
+func Diff(old, new *Lock) []string {
+	var diffs []string
+	if old.ReleaseETag != new.ReleaseETag {
+		diffs = append(diffs, fmt.Sprintf("release changed from %q to %q", old.ReleaseETag, new.ReleaseETag))
+	}
+
+	for _, slice := range new.Slices {
+		if !slices.Contains(old.Slices, slice) {
+			diffs = append(diffs, "slice added: "+slice)
+		}
+	}
+	for _, slice := range old.Slices {
+		if !slices.Contains(new.Slices, slice) {
+			diffs = append(diffs, "slice removed: "+slice)
+		}
+	}
+
+	oldPkgs := make(map[string]*Package)
+	for _, pkg := range old.Packages {
+		oldPkgs[pkg.key()] = pkg
+	}
+	newPkgs := make(map[string]*Package)
+	for _, pkg := range new.Packages {
+		newPkgs[pkg.key()] = pkg
+		oldPkg, ok := oldPkgs[pkg.key()]
+		if !ok {
+			diffs = append(diffs, "package added: "+pkg.String())
+		} else if *oldPkg != *pkg {
+			diffs = append(diffs, fmt.Sprintf("package changed: %s -> %s", oldPkg, pkg))
+		}
+	}
+	for _, pkg := range old.Packages {
+		if _, ok := newPkgs[pkg.key()]; !ok {
+			diffs = append(diffs, "package removed: "+pkg.String())
+		}
+	}
+	slices.Sort(diffs)
+	return diffs
+}
+
+// Pins returns the version locked for each package name. Package versions
+// are pinned by name alone, so a lock holding different versions of one
+// package for different architectures cannot be used to pin them.
+func (l *Lock) Pins() (map[string]string, error) {
+	pins := make(map[string]string)
+	for _, pkg := range l.Packages {
+		if old, ok := pins[pkg.Name]; ok && old != pkg.Version {
+			return nil, fmt.Errorf("lock file has package %q with different versions: %s and %s", pkg.Name, old, pkg.Version)
+		}
+		pins[pkg.Name] = pkg.Version
+	}
+	return pins, nil
+}
+
+// key identifies the package within a lock, which may hold packages with
+// the same name for different architectures.
+func (p *Package) key() string {
+	return p.Name + ":" + p.Arch
+}
+
+func (p *Package) String() string {
+	return fmt.Sprintf("%s %s %s from %s (sha256 %s)", p.Name, p.Version, p.Arch, p.Archive, p.SHA256)
+}
@@ -0,0 +1,203 @@
+package lockfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/lockfile"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var sampleLock = &lockfile.Lock{
+	ReleaseETag: `"abc123"`,
+	Slices:      []string{"mypkg_myslice", "base-files_base"},
+	Packages: []*lockfile.Package{{
+		Name:    "mypkg",
+		Version: "1.0",
+		Arch:    "amd64",
+		Archive: "ubuntu",
+		SHA256:  "fb0f2b3e3ec5ac7e9a1e4d1d2c8ea1f0a0e3cc52a8e0b4d6d8c0bf3e7fa4cd11",
+	}, {
+		Name:    "base-files",
+		Version: "12ubuntu4",
+		Arch:    "amd64",
+		Archive: "ubuntu",
+		SHA256:  "3c2b7a1d0a6c1f0b7c5e2e8b1f8d9c4a6b0e2d4f6a8c0e2b4d6f8a0c2e4b6d8f",
+	}},
+}
+
+func (s *S) TestWriteRead(c *C) {
+	path := filepath.Join(c.MkDir(), "chisel.lock")
+	err := lockfile.Write(path, sampleLock)
+	c.Assert(err, IsNil)
+
+	data, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+	expected := string(testutil.Reindent(`
+		format: v1
+		release:
+		  etag: '"abc123"'
+		slices:
+		  - base-files_base
+		  - mypkg_myslice
+		packages:
+		  - name: base-files
+		    version: 12ubuntu4
+		    arch: amd64
+		    archive: ubuntu
+		    sha256: 3c2b7a1d0a6c1f0b7c5e2e8b1f8d9c4a6b0e2d4f6a8c0e2b4d6f8a0c2e4b6d8f
+		  - name: mypkg
+		    version: "1.0"
+		    arch: amd64
+		    archive: ubuntu
+		    sha256: fb0f2b3e3ec5ac7e9a1e4d1d2c8ea1f0a0e3cc52a8e0b4d6d8c0bf3e7fa4cd11
+	`))
+	c.Assert(string(data), Equals, strings.TrimSpace(expected)+"\n")
+
+	lock, err := lockfile.Read(path)
+	c.Assert(err, IsNil)
+	c.Assert(lockfile.Diff(sampleLock, lock), IsNil)
+	c.Assert(lock.Slices, DeepEquals, []string{"base-files_base", "mypkg_myslice"})
+	c.Assert(lock.Packages[0].Name, Equals, "base-files")
+}
+
+var readErrorTests = []struct {
+	summary string
+	content string
+	error   string
+}{{
+	summary: "Unknown format",
+	content: "format: v9\n",
+	error:   `lock file .* has unknown format "v9"`,
+}, {
+	summary: "Unknown field",
+	content: "format: v1\nfoo: bar\n",
+	error:   `cannot parse lock file .*: yaml: unmarshal errors:\n  line 2: field foo not found in type lockfile.yamlLock`,
+}, {
+	summary: "Incomplete package",
+	content: "format: v1\npackages:\n  - name: mypkg\n",
+	error:   `lock file .* has incomplete package entry`,
+}, {
+	summary: "Repeated package",
+	content: "format: v1\npackages:\n  - {name: mypkg, version: '1', sha256: a}\n  - {name: mypkg, version: '2', sha256: b}\n",
+	error:   `lock file .* lists package "mypkg" more than once`,
+}, {
+	summary: "Repeated package with architecture",
+	content: "format: v1\npackages:\n  - {name: mypkg, version: '1', arch: i386, sha256: a}\n  - {name: mypkg, version: '2', arch: i386, sha256: b}\n",
+	error:   `lock file .* lists package "mypkg" more than once`,
+}}
+
+func (s *S) TestReadErrors(c *C) {
+	for _, test := range readErrorTests {
+		c.Logf("Summary: %s", test.summary)
+		path := filepath.Join(c.MkDir(), "chisel.lock")
+		err := os.WriteFile(path, []byte(test.content), 0644)
+		c.Assert(err, IsNil)
+		_, err = lockfile.Read(path)
+		c.Assert(err, ErrorMatches, test.error)
+	}
+}
+
+func (s *S) TestReadMissing(c *C) {
+	_, err := lockfile.Read(filepath.Join(c.MkDir(), "chisel.lock"))
+	c.Assert(err, ErrorMatches, `cannot read lock file: open .*: no such file or directory`)
+}
+
+var diffTests = []struct {
+	summary string
+	old     *lockfile.Lock
+	new     *lockfile.Lock
+	diffs   []string
+}{{
+	summary: "Same lock",
+	old:     &lockfile.Lock{Slices: []string{"a_b"}, Packages: []*lockfile.Package{{Name: "a", Version: "1"}}},
+	new:     &lockfile.Lock{Slices: []string{"a_b"}, Packages: []*lockfile.Package{{Name: "a", Version: "1"}}},
+}, {
+	summary: "Release changed",
+	old:     &lockfile.Lock{ReleaseETag: "x"},
+	new:     &lockfile.Lock{ReleaseETag: "y"},
+	diffs:   []string{`release changed from "x" to "y"`},
+}, {
+	summary: "Slices changed",
+	old:     &lockfile.Lock{Slices: []string{"a_b", "a_c"}},
+	new:     &lockfile.Lock{Slices: []string{"a_b", "a_d"}},
+	diffs:   []string{"slice added: a_d", "slice removed: a_c"},
+}, {
+	summary: "Packages changed",
+	old: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "1", Arch: "amd64", Archive: "ubuntu", SHA256: "h1"},
+		{Name: "b", Version: "1", Arch: "amd64", Archive: "ubuntu", SHA256: "h2"},
+	}},
+	new: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "2", Arch: "amd64", Archive: "ubuntu", SHA256: "h3"},
+		{Name: "c", Version: "1", Arch: "all", Archive: "other", SHA256: "h4"},
+	}},
+	diffs: []string{
+		"package added: c 1 all from other (sha256 h4)",
+		"package changed: a 1 amd64 from ubuntu (sha256 h1) -> a 2 amd64 from ubuntu (sha256 h3)",
+		"package removed: b 1 amd64 from ubuntu (sha256 h2)",
+	},
+}, {
+	summary: "Same package for different architectures",
+	old: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "1", Arch: "amd64", Archive: "ubuntu", SHA256: "h1"},
+		{Name: "a", Version: "1", Arch: "i386", Archive: "ubuntu", SHA256: "h2"},
+	}},
+	new: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "1", Arch: "amd64", Archive: "ubuntu", SHA256: "h1"},
+		{Name: "a", Version: "2", Arch: "i386", Archive: "ubuntu", SHA256: "h3"},
+		{Name: "a", Version: "1", Arch: "arm64", Archive: "ubuntu", SHA256: "h4"},
+	}},
+	diffs: []string{
+		"package added: a 1 arm64 from ubuntu (sha256 h4)",
+		"package changed: a 1 i386 from ubuntu (sha256 h2) -> a 2 i386 from ubuntu (sha256 h3)",
+	},
+}}
+
+func (s *S) TestDiff(c *C) {
+	for _, test := range diffTests {
+		c.Logf("Summary: %s", test.summary)
+		c.Assert(lockfile.Diff(test.old, test.new), DeepEquals, test.diffs)
+	}
+}
+
+var pinsTests = []struct {
+	summary string
+	lock    *lockfile.Lock
+	pins    map[string]string
+	error   string
+}{{
+	summary: "Packages for one architecture",
+	lock:    sampleLock,
+	pins:    map[string]string{"mypkg": "1.0", "base-files": "12ubuntu4"},
+}, {
+	summary: "Same version for different architectures",
+	lock: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "1", Arch: "amd64"},
+		{Name: "a", Version: "1", Arch: "i386"},
+	}},
+	pins: map[string]string{"a": "1"},
+}, {
+	summary: "Different versions for different architectures",
+	lock: &lockfile.Lock{Packages: []*lockfile.Package{
+		{Name: "a", Version: "1", Arch: "amd64"},
+		{Name: "a", Version: "2", Arch: "i386"},
+	}},
+	error: `lock file has package "a" with different versions: 1 and 2`,
+}}
+
+func (s *S) TestPins(c *C) {
+	for _, test := range pinsTests {
+		c.Logf("Summary: %s", test.summary)
+		pins, err := test.lock.Pins()
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(pins, DeepEquals, test.pins)
+	}
+}
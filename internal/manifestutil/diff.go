@@ -0,0 +1,272 @@
+package manifestutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"iter"
+
+	"github.com/canonical/chisel/public/manifest"
+)
+
+// Kinds of changes reported by Diff.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeVersion = "version"
+	ChangeContent = "content"
+	ChangeMode    = "mode"
+	ChangeLink    = "link"
+)
+
+// DiffEntry describes a difference between two manifests.
+type DiffEntry struct {
+	// Kind is one of "package", "slice" or "path".
+	Kind string
+	// Name is the package name qualified with its architecture (e.g.
+	// "libc6:amd64"), the slice name, or the path.
+	Name   string
+	Change string
+	Old    string
+	New    string
+}
+
+// Diff reports the packages and slices added or removed between the old
+// and new manifests, as well as the package versions and the paths that
+// changed. Both manifests are walked in step through their sorted entries,
+// which are decoded one at a time instead of being collected.
+func Diff(oldMfest, newMfest *manifest.Manifest) ([]*DiffEntry, error) {
+	var entries []*DiffEntry
+	add := func(kind, name, change, oldValue, newValue string) {
+		entries = append(entries, &DiffEntry{
+			Kind:   kind,
+			Name:   name,
+			Change: change,
+			Old:    oldValue,
+			New:    newValue,
+		})
+	}
+
+	oldPkgs, stopOld := pull(oldMfest.IteratePackages)
+	defer stopOld()
+	newPkgs, stopNew := pull(newMfest.IteratePackages)
+	defer stopNew()
+	err := merge(groupPackages(oldPkgs), groupPackages(newPkgs), func(group *packageGroup) string {
+		return group.pkgs[0].Name
+	}, func(oldGroup, newGroup *packageGroup) {
+		var oldList, newList []*manifest.Package
+		if oldGroup != nil {
+			oldList = oldGroup.pkgs
+		}
+		if newGroup != nil {
+			newList = newGroup.pkgs
+		}
+		for _, oldPkg := range oldList {
+			name := oldPkg.Name + ":" + oldPkg.Arch
+			newPkg := findArch(newList, oldPkg.Arch)
+			switch {
+			case newPkg == nil:
+				add("package", name, ChangeRemoved, oldPkg.Version, "")
+			case newPkg.Version != oldPkg.Version || newPkg.Digest != oldPkg.Digest:
+				add("package", name, ChangeVersion, oldPkg.Version, newPkg.Version)
+			}
+		}
+		for _, newPkg := range newList {
+			if findArch(oldList, newPkg.Arch) == nil {
+				add("package", newPkg.Name+":"+newPkg.Arch, ChangeAdded, "", newPkg.Version)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	iterateSlices := func(mfest *manifest.Manifest) func(func(*manifest.Slice) error) error {
+		return func(onMatch func(*manifest.Slice) error) error {
+			return mfest.IterateSlices("", onMatch)
+		}
+	}
+	oldSlices, stopOld := pull(iterateSlices(oldMfest))
+	defer stopOld()
+	newSlices, stopNew := pull(iterateSlices(newMfest))
+	defer stopNew()
+	err = merge(oldSlices, newSlices, func(slice *manifest.Slice) string {
+		return slice.Name
+	}, func(oldSlice, newSlice *manifest.Slice) {
+		if oldSlice == nil {
+			add("slice", newSlice.Name, ChangeAdded, "", "")
+		} else if newSlice == nil {
+			add("slice", oldSlice.Name, ChangeRemoved, "", "")
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	iteratePaths := func(mfest *manifest.Manifest) func(func(*manifest.Path) error) error {
+		return func(onMatch func(*manifest.Path) error) error {
+			return mfest.IteratePaths("", onMatch)
+		}
+	}
+	oldPaths, stopOld := pull(iteratePaths(oldMfest))
+	defer stopOld()
+	newPaths, stopNew := pull(iteratePaths(newMfest))
+	defer stopNew()
+	err = merge(oldPaths, newPaths, func(path *manifest.Path) string {
+		return path.Path
+	}, func(oldPath, newPath *manifest.Path) {
+		switch {
+		case oldPath == nil:
+			add("path", newPath.Path, ChangeAdded, "", "")
+			return
+		case newPath == nil:
+			add("path", oldPath.Path, ChangeRemoved, "", "")
+			return
+		}
+		if oldDigest, newDigest := finalDigest(oldPath), finalDigest(newPath); oldDigest != newDigest {
+			add("path", oldPath.Path, ChangeContent, oldDigest, newDigest)
+		}
+		if oldPath.Mode != newPath.Mode {
+			add("path", oldPath.Path, ChangeMode, oldPath.Mode, newPath.Mode)
+		}
+		if oldPath.Link != newPath.Link {
+			add("path", oldPath.Path, ChangeLink, oldPath.Link, newPath.Link)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func finalDigest(path *manifest.Path) string {
+	if path.FinalSHA256 != "" {
+		return path.FinalSHA256
+	}
+	return path.SHA256
+}
+
+func findArch(pkgs []*manifest.Package, arch string) *manifest.Package {
+	for _, pkg := range pkgs {
+		if pkg.Arch == arch {
+			return pkg
+		}
+	}
+	return nil
+}
+
+var errStopIteration = errors.New("iteration stopped")
+
+// pull turns a manifest iteration into a function returning one entry per
+// call, and nil once all entries were returned. The stop function must be
+// called to release the iteration if it is abandoned early.
+func pull[T any](iterate func(onMatch func(*T) error) error) (next func() (*T, error), stop func()) {
+	var iterErr error
+	seq := func(yield func(*T) bool) {
+		iterErr = iterate(func(entry *T) error {
+			if !yield(entry) {
+				return errStopIteration
+			}
+			return nil
+		})
+	}
+	nextEntry, stop := iter.Pull(iter.Seq[*T](seq))
+	next = func() (*T, error) {
+		entry, ok := nextEntry()
+		if !ok {
+			return nil, iterErr
+		}
+		return entry, nil
+	}
+	return next, stop
+}
+
+// packageGroup holds the packages sharing the same name, which happens
+// with the packages of several architectures.
+type packageGroup struct {
+	pkgs []*manifest.Package
+}
+
+// groupPackages returns the packages from next grouped by name.
+func groupPackages(next func() (*manifest.Package, error)) func() (*packageGroup, error) {
+	var pending *manifest.Package
+	return func() (*packageGroup, error) {
+		group := &packageGroup{}
+		for {
+			pkg := pending
+			pending = nil
+			if pkg == nil {
+				var err error
+				pkg, err = next()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if pkg == nil {
+				break
+			}
+			if len(group.pkgs) > 0 && pkg.Name != group.pkgs[0].Name {
+				pending = pkg
+				break
+			}
+			group.pkgs = append(group.pkgs, pkg)
+		}
+		if len(group.pkgs) == 0 {
+			return nil, nil
+		}
+		return group, nil
+	}
+}
+
+// merge walks in step two sequences of entries sorted by key as in the
+// manifest, calling onPair with the entries holding the same key, or with
+// nil in place of an entry missing from one of the sequences. The sequences
+// return nil once exhausted.
+func merge[T comparable](oldNext, newNext func() (T, error), key func(T) string, onPair func(oldEntry, newEntry T)) error {
+	var none T
+	oldEntry, err := oldNext()
+	if err != nil {
+		return err
+	}
+	newEntry, err := newNext()
+	if err != nil {
+		return err
+	}
+	for oldEntry != none || newEntry != none {
+		cmp := 0
+		switch {
+		case oldEntry == none:
+			cmp = 1
+		case newEntry == none:
+			cmp = -1
+		default:
+			cmp = compareKeys(key(oldEntry), key(newEntry))
+		}
+		switch {
+		case cmp < 0:
+			onPair(oldEntry, none)
+			oldEntry, err = oldNext()
+		case cmp > 0:
+			onPair(none, newEntry)
+			newEntry, err = newNext()
+		default:
+			onPair(oldEntry, newEntry)
+			oldEntry, err = oldNext()
+			if err == nil {
+				newEntry, err = newNext()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareKeys compares keys in the order of the manifest entries, which are
+// sorted by their JSON encoding.
+func compareKeys(a, b string) int {
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	return bytes.Compare(encodedA, encodedB)
+}
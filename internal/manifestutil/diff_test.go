@@ -0,0 +1,124 @@
+package manifestutil_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/public/jsonwall"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+var diffTests = []struct {
+	summary string
+	old     []any
+	new     []any
+	entries []*manifestutil.DiffEntry
+}{{
+	summary: "Same manifest",
+	old: []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64"},
+		&manifest.Slice{Kind: "slice", Name: "pkg1_myslice"},
+		&manifest.Path{Kind: "path", Path: "/file", Mode: "0644", Slices: []string{"pkg1_myslice"}, SHA256: "sha1"},
+	},
+	new: []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64"},
+		&manifest.Slice{Kind: "slice", Name: "pkg1_myslice"},
+		&manifest.Path{Kind: "path", Path: "/file", Mode: "0644", Slices: []string{"pkg1_myslice"}, SHA256: "sha1"},
+	},
+}, {
+	summary: "Packages added, removed and upgraded",
+	old: []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64"},
+		&manifest.Package{Kind: "package", Name: "pkg2", Version: "v1", Digest: "hash2", Arch: "all"},
+		&manifest.Package{Kind: "package", Name: "pkg3", Version: "v1", Digest: "hash3", Arch: "amd64"},
+		&manifest.Package{Kind: "package", Name: "pkg3", Version: "v1", Digest: "hash4", Arch: "i386"},
+		&manifest.Package{Kind: "package", Name: "pkg5", Version: "v1", Digest: "hash5", Arch: "amd64"},
+	},
+	new: []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v2", Digest: "hash6", Arch: "amd64"},
+		&manifest.Package{Kind: "package", Name: "pkg3", Version: "v1", Digest: "hash3", Arch: "amd64"},
+		&manifest.Package{Kind: "package", Name: "pkg4", Version: "v1", Digest: "hash7", Arch: "amd64"},
+		// Same version rebuilt with different content.
+		&manifest.Package{Kind: "package", Name: "pkg5", Version: "v1", Digest: "hash8", Arch: "amd64"},
+	},
+	entries: []*manifestutil.DiffEntry{
+		{Kind: "package", Name: "pkg1:amd64", Change: "version", Old: "v1", New: "v2"},
+		{Kind: "package", Name: "pkg2:all", Change: "removed", Old: "v1"},
+		{Kind: "package", Name: "pkg3:i386", Change: "removed", Old: "v1"},
+		{Kind: "package", Name: "pkg4:amd64", Change: "added", New: "v1"},
+		{Kind: "package", Name: "pkg5:amd64", Change: "version", Old: "v1", New: "v1"},
+	},
+}, {
+	summary: "Slices added and removed",
+	old: []any{
+		&manifest.Slice{Kind: "slice", Name: "pkg1_a"},
+		&manifest.Slice{Kind: "slice", Name: "pkg1_b"},
+		&manifest.Slice{Kind: "slice", Name: "pkg2:i386_a"},
+	},
+	new: []any{
+		&manifest.Slice{Kind: "slice", Name: "pkg1_b"},
+		&manifest.Slice{Kind: "slice", Name: "pkg1_c"},
+		&manifest.Slice{Kind: "slice", Name: "pkg2_a"},
+	},
+	entries: []*manifestutil.DiffEntry{
+		{Kind: "slice", Name: "pkg1_a", Change: "removed"},
+		{Kind: "slice", Name: "pkg1_c", Change: "added"},
+		{Kind: "slice", Name: "pkg2:i386_a", Change: "removed"},
+		{Kind: "slice", Name: "pkg2_a", Change: "added"},
+	},
+}, {
+	summary: "Paths changed",
+	old: []any{
+		&manifest.Path{Kind: "path", Path: "/dir/", Mode: "0755"},
+		&manifest.Path{Kind: "path", Path: "/dir/file", Mode: "0644", SHA256: "sha1"},
+		// Sorted before "/dir/file" in the manifest.
+		&manifest.Path{Kind: "path", Path: "/dir/file two", Mode: "0644", SHA256: "sha1"},
+		&manifest.Path{Kind: "path", Path: "/link", Mode: "0777", Link: "/dir/file"},
+		&manifest.Path{Kind: "path", Path: "/mutated", Mode: "0644", SHA256: "sha1", FinalSHA256: "sha2"},
+		&manifest.Path{Kind: "path", Path: "/removed", Mode: "0644", SHA256: "sha1"},
+	},
+	new: []any{
+		&manifest.Path{Kind: "path", Path: "/added", Mode: "0644", SHA256: "sha1"},
+		&manifest.Path{Kind: "path", Path: "/dir/", Mode: "0700"},
+		&manifest.Path{Kind: "path", Path: "/dir/file", Mode: "0600", SHA256: "sha3"},
+		&manifest.Path{Kind: "path", Path: "/dir/file two", Mode: "0644", SHA256: "sha1"},
+		&manifest.Path{Kind: "path", Path: "/link", Mode: "0777", Link: "/dir/file two"},
+		// Only the final content of mutated paths is compared.
+		&manifest.Path{Kind: "path", Path: "/mutated", Mode: "0644", SHA256: "sha3", FinalSHA256: "sha2"},
+	},
+	entries: []*manifestutil.DiffEntry{
+		{Kind: "path", Name: "/added", Change: "added"},
+		{Kind: "path", Name: "/dir/", Change: "mode", Old: "0755", New: "0700"},
+		{Kind: "path", Name: "/dir/file", Change: "content", Old: "sha1", New: "sha3"},
+		{Kind: "path", Name: "/dir/file", Change: "mode", Old: "0644", New: "0600"},
+		{Kind: "path", Name: "/link", Change: "link", Old: "/dir/file", New: "/dir/file two"},
+		{Kind: "path", Name: "/removed", Change: "removed"},
+	},
+}}
+
+func (s *S) TestDiff(c *C) {
+	for _, test := range diffTests {
+		c.Logf("Summary: %s", test.summary)
+		oldMfest := makeManifest(c, test.old)
+		newMfest := makeManifest(c, test.new)
+		entries, err := manifestutil.Diff(oldMfest, newMfest)
+		c.Assert(err, IsNil)
+		c.Assert(entries, DeepEquals, test.entries)
+	}
+}
+
+func makeManifest(c *C, values []any) *manifest.Manifest {
+	dbw := jsonwall.NewDBWriter(&jsonwall.DBWriterOptions{Schema: manifest.Schema})
+	for _, value := range values {
+		err := dbw.Add(value)
+		c.Assert(err, IsNil)
+	}
+	var buffer bytes.Buffer
+	_, err := dbw.WriteTo(&buffer)
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(&buffer)
+	c.Assert(err, IsNil)
+	return mfest
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
 
-	"github.com/canonical/chisel/internal/apacheutil"
+	"github.com/klauspost/compress/zstd"
+
 	"github.com/canonical/chisel/internal/archive"
 	"github.com/canonical/chisel/internal/setup"
 	"github.com/canonical/chisel/public/jsonwall"
@@ -72,11 +74,15 @@ func Write(options *WriteOptions, writer io.Writer) error {
 func manifestAddPackages(dbw *jsonwall.DBWriter, infos []*archive.PackageInfo) error {
 	for _, info := range infos {
 		err := dbw.Add(&manifest.Package{
-			Kind:    "package",
-			Name:    info.Name,
-			Version: info.Version,
-			Digest:  info.SHA256,
-			Arch:    info.Arch,
+			Kind:          "package",
+			Name:          info.Name,
+			Version:       info.Version,
+			Digest:        info.SHA256,
+			Arch:          info.Arch,
+			Source:        info.Source,
+			InstalledSize: info.InstalledSize,
+			Depends:       info.Depends,
+			Homepage:      info.Homepage,
 		})
 		if err != nil {
 			return err
@@ -116,7 +122,7 @@ func manifestAddReport(dbw *jsonwall.DBWriter, report *Report) error {
 		err := dbw.Add(&manifest.Path{
 			Kind:        "path",
 			Path:        entry.Path,
-			Mode:        fmt.Sprintf("0%o", unixPerm(entry.Mode)),
+			Mode:        FormatMode(entry.Mode),
 			Slices:      sliceNames,
 			SHA256:      entry.SHA256,
 			FinalSHA256: entry.FinalSHA256,
@@ -131,6 +137,12 @@ func manifestAddReport(dbw *jsonwall.DBWriter, report *Report) error {
 	return nil
 }
 
+// FormatMode returns the permissions of mode as recorded in the manifest,
+// such as "0644".
+func FormatMode(mode fs.FileMode) string {
+	return fmt.Sprintf("0%o", unixPerm(mode))
+}
+
 func unixPerm(mode fs.FileMode) (perm uint32) {
 	perm = uint32(mode.Perm())
 	if mode&fs.ModeSticky != 0 {
@@ -156,10 +168,13 @@ func fastValidate(options *WriteOptions) (err error) {
 			return err
 		}
 		pkgExist[pkg.Name] = true
+		// Slices of foreign architectures refer to their package qualified
+		// with the architecture, as in "libc6:i386".
+		pkgExist[pkg.Name+":"+pkg.Arch] = true
 	}
 	sliceExist := map[string]bool{}
 	for _, slice := range options.Selection {
-		if _, ok := pkgExist[slice.Package]; !ok {
+		if !qualifiedPkgExists(pkgExist, slice.Package) {
 			return fmt.Errorf("slice %s refers to missing package %q", slice.String(), slice.Package)
 		}
 		sliceExist[slice.String()] = true
@@ -250,6 +265,17 @@ func validateReportEntry(entry *ReportEntry) (err error) {
 	return nil
 }
 
+// qualifiedPkgExists returns whether the package exists, where the name may
+// be qualified with a foreign architecture. Packages for all architectures
+// satisfy any qualifier.
+func qualifiedPkgExists(pkgExist map[string]bool, pkgName string) bool {
+	if pkgExist[pkgName] {
+		return true
+	}
+	name, _, ok := strings.Cut(pkgName, ":")
+	return ok && pkgExist[name+":all"]
+}
+
 func validatePackage(pkg *archive.PackageInfo) (err error) {
 	if pkg.Name == "" {
 		return fmt.Errorf("package name not set")
@@ -266,6 +292,35 @@ func validatePackage(pkg *archive.PackageInfo) (err error) {
 	return nil
 }
 
+// ReadFile reads the zstd-compressed manifest at path and validates it.
+func ReadFile(path string) (*manifest.Manifest, error) {
+	mfest, err := ReadFileUnchecked(path)
+	if err != nil {
+		return nil, err
+	}
+	err = Validate(mfest)
+	if err != nil {
+		return nil, err
+	}
+	return mfest, nil
+}
+
+// ReadFileUnchecked reads the zstd-compressed manifest at path without
+// validating it. Its entries are only unmarshalled as they are iterated.
+func ReadFileUnchecked(path string) (*manifest.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return manifest.Read(r)
+}
+
 // Validate checks that the Manifest is valid. Note that to do that it has to
 // load practically the whole manifest into memory and unmarshall all the
 // entries.
@@ -279,6 +334,7 @@ func Validate(mfest *manifest.Manifest) (err error) {
 	pkgExist := map[string]bool{}
 	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
 		pkgExist[pkg.Name] = true
+		pkgExist[pkg.Name+":"+pkg.Arch] = true
 		return nil
 	})
 	if err != nil {
@@ -287,11 +343,14 @@ func Validate(mfest *manifest.Manifest) (err error) {
 
 	sliceExist := map[string]bool{}
 	err = mfest.IterateSlices("", func(slice *manifest.Slice) error {
-		sk, err := apacheutil.ParseSliceKey(slice.Name)
+		sk, arch, err := setup.ParseQualifiedSliceName(slice.Name)
 		if err != nil {
 			return err
 		}
-		if !pkgExist[sk.Package] {
+		if arch != "" {
+			sk.Package += ":" + arch
+		}
+		if !qualifiedPkgExists(pkgExist, sk.Package) {
 			return fmt.Errorf("slice %s refers to missing package %q", slice.Name, sk.Package)
 		}
 		sliceExist[slice.Name] = true
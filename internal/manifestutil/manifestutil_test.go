@@ -624,6 +624,30 @@ var validateManifestTests = []struct {
 		{"kind":"slice","name":"pkg1_myslice"}
 	`,
 	error: `invalid manifest: content path /dir/ has no matching entry in paths`,
+}, {
+	summary: "Slice of foreign architecture",
+	input: `
+		{"jsonwall":"1.0","schema":"1.0","count":4}
+		{"kind":"content","slice":"pkg1:arch2_myslice","path":"/dir/"}
+		{"kind":"package","name":"pkg1","version":"v1","sha256":"hash1","arch":"arch2"}
+		{"kind":"path","path":"/dir/","mode":"01777","slices":["pkg1:arch2_myslice"]}
+		{"kind":"slice","name":"pkg1:arch2_myslice"}
+	`,
+}, {
+	summary: "Package of foreign architecture not found",
+	input: `
+		{"jsonwall":"1.0","schema":"1.0","count":2}
+		{"kind":"package","name":"pkg1","version":"v1","sha256":"hash1","arch":"arch1"}
+		{"kind":"slice","name":"pkg1:arch2_myslice"}
+	`,
+	error: `invalid manifest: slice pkg1:arch2_myslice refers to missing package "pkg1:arch2"`,
+}, {
+	summary: "Slice of foreign architecture from package for all architectures",
+	input: `
+		{"jsonwall":"1.0","schema":"1.0","count":2}
+		{"kind":"package","name":"pkg1","version":"v1","sha256":"hash1","arch":"all"}
+		{"kind":"slice","name":"pkg1:arch2_myslice"}
+	`,
 }, {
 	summary: "Malformed jsonwall",
 	input: `
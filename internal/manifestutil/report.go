@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/canonical/chisel/internal/fsutil"
 	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
 )
 
 type ReportEntry struct {
@@ -104,6 +106,40 @@ func (r *Report) Add(slice *setup.Slice, fsEntry *fsutil.Entry) error {
 	return nil
 }
 
+// AddManifestPath adds a path recorded in the manifest of a previous cut,
+// attributing it to the provided slices.
+func (r *Report) AddManifestPath(path *manifest.Path, slices []*setup.Slice) error {
+	perm, err := strconv.ParseUint(path.Mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("cannot add path %s to report: invalid mode %q", path.Path, path.Mode)
+	}
+	mode := fs.FileMode(perm & 0777)
+	if perm&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	if strings.HasSuffix(path.Path, "/") {
+		mode |= fs.ModeDir
+	} else if path.Link != "" && path.Inode == 0 {
+		mode |= fs.ModeSymlink
+	}
+	entry := ReportEntry{
+		Path:        path.Path,
+		Mode:        mode,
+		SHA256:      path.SHA256,
+		Size:        int(path.Size),
+		Slices:      make(map[*setup.Slice]bool),
+		Link:        path.Link,
+		FinalSHA256: path.FinalSHA256,
+		Inode:       path.Inode,
+	}
+	for _, slice := range slices {
+		entry.Slices[slice] = true
+	}
+	r.Entries[path.Path] = entry
+	r.lastInode = max(r.lastInode, path.Inode)
+	return nil
+}
+
 // Mutate updates the FinalSHA256 and Size of an existing path entry.
 func (r *Report) Mutate(fsEntry *fsutil.Entry) error {
 	relPath, err := r.sanitizeAbsPath(fsEntry.Path, fsEntry.Mode.IsDir())
@@ -8,6 +8,7 @@ import (
 	"github.com/canonical/chisel/internal/fsutil"
 	"github.com/canonical/chisel/internal/manifestutil"
 	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
 )
 
 var oneSlice = &setup.Slice{
@@ -386,3 +387,66 @@ func (s *S) TestRootOnlySlash(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(report.Root, Equals, "/")
 }
+
+func (s *S) TestReportAddManifestPath(c *C) {
+	report, err := manifestutil.NewReport("/base/")
+	c.Assert(err, IsNil)
+	paths := []*manifest.Path{{
+		Path:   "/example-dir/",
+		Mode:   "01777",
+		Slices: []string{"base-files_my-slice"},
+	}, {
+		Path:        "/example-file",
+		Mode:        "0644",
+		SHA256:      "sha1",
+		FinalSHA256: "sha2",
+		Size:        5,
+		Inode:       2,
+		Slices:      []string{"base-files_my-slice"},
+	}, {
+		Path:   "/example-link",
+		Mode:   "0777",
+		Link:   "/example-file",
+		Slices: []string{"base-files_my-slice", "base-files_other-slice"},
+	}}
+	for _, path := range paths {
+		sliceList := []*setup.Slice{oneSlice}
+		if len(path.Slices) == 2 {
+			sliceList = append(sliceList, otherSlice)
+		}
+		err := report.AddManifestPath(path, sliceList)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(report.Entries, DeepEquals, map[string]manifestutil.ReportEntry{
+		"/example-dir/": {
+			Path:   "/example-dir/",
+			Mode:   fs.ModeDir | fs.ModeSticky | 0777,
+			Slices: map[*setup.Slice]bool{oneSlice: true},
+		},
+		"/example-file": {
+			Path:        "/example-file",
+			Mode:        0644,
+			SHA256:      "sha1",
+			FinalSHA256: "sha2",
+			Size:        5,
+			Inode:       2,
+			Slices:      map[*setup.Slice]bool{oneSlice: true},
+		},
+		"/example-link": {
+			Path:   "/example-link",
+			Mode:   fs.ModeSymlink | 0777,
+			Link:   "/example-file",
+			Slices: map[*setup.Slice]bool{oneSlice: true, otherSlice: true},
+		},
+	})
+
+	// New hard links do not reuse the inodes of previous cuts.
+	err = report.Add(oneSlice, &fsutil.Entry{Path: "/base/new-file", Mode: 0644, SHA256: "sha3", Size: 3})
+	c.Assert(err, IsNil)
+	err = report.Add(oneSlice, &fsutil.Entry{Path: "/base/new-link", Mode: 0644, Link: "/base/new-file"})
+	c.Assert(err, IsNil)
+	c.Assert(report.Entries["/new-link"].Inode, Equals, uint64(3))
+
+	err = report.AddManifestPath(&manifest.Path{Path: "/bad", Mode: "abc"}, nil)
+	c.Assert(err, ErrorMatches, `cannot add path /bad to report: invalid mode "abc"`)
+}
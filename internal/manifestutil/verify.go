@@ -0,0 +1,229 @@
+package manifestutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/canonical/chisel/public/manifest"
+)
+
+// Kinds of issues reported by Verify.
+const (
+	IssueMissing  = "missing"
+	IssueExtra    = "extra"
+	IssueModified = "modified"
+	IssueMode     = "mode"
+	IssueLink     = "link"
+)
+
+// Issue describes a difference between a path in the root filesystem and
+// the way it is recorded in the manifest.
+type Issue struct {
+	Kind     string
+	Path     string
+	Expected string
+	Found    string
+}
+
+// Verify compares the content of rootDir with the paths recorded in the
+// manifest, returning the issues found sorted by path. Directories which
+// are not listed in the manifest but hold listed paths are not reported as
+// extra, as they are created implicitly when cutting.
+func Verify(mfest *manifest.Manifest, rootDir string) ([]*Issue, error) {
+	rootDir = filepath.Clean(rootDir)
+	var issues []*Issue
+	paths := make(map[string]*manifest.Path)
+	parents := make(map[string]bool)
+	// Hard links are recorded with the same inode number in the manifest,
+	// and are expected to share an inode in the filesystem as well.
+	linkGroups := make(map[uint64]string)
+	inodes := make(map[string]uint64)
+	err := mfest.IteratePaths("", func(path *manifest.Path) error {
+		paths[path.Path] = path
+		for dir := filepath.Dir(strings.TrimSuffix(path.Path, "/")); dir != "/"; dir = filepath.Dir(dir) {
+			parents[dir+"/"] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	relPaths := make([]string, 0, len(paths))
+	for relPath := range paths {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	for _, relPath := range relPaths {
+		path := paths[relPath]
+		pathIssues, inode, err := verifyPath(rootDir, path)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, pathIssues...)
+		if path.Inode == 0 || inode == 0 {
+			continue
+		}
+		inodes[relPath] = inode
+		if first, ok := linkGroups[path.Inode]; !ok {
+			linkGroups[path.Inode] = relPath
+		} else if inodes[first] != inode {
+			issues = append(issues, &Issue{
+				Kind:     IssueLink,
+				Path:     relPath,
+				Expected: first,
+			})
+		}
+	}
+
+	err = filepath.WalkDir(rootDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath := "/" + strings.TrimPrefix(strings.TrimPrefix(path, rootDir), "/")
+		if relPath == "/" {
+			return nil
+		}
+		if entry.IsDir() {
+			relPath += "/"
+		}
+		if _, ok := paths[relPath]; ok || parents[relPath] {
+			return nil
+		}
+		issues = append(issues, &Issue{
+			Kind:  IssueExtra,
+			Path:  relPath,
+			Found: pathKind(entry.Type()),
+		})
+		// Content of extra directories is not reported separately.
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify %s: %w", rootDir, err)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Path < issues[j].Path
+	})
+	return issues, nil
+}
+
+// verifyPath checks a single path of the manifest, returning the issues
+// found and the inode of regular files.
+func verifyPath(rootDir string, path *manifest.Path) ([]*Issue, uint64, error) {
+	realPath := filepath.Join(rootDir, path.Path)
+	info, err := os.Lstat(realPath)
+	if os.IsNotExist(err) {
+		return []*Issue{{Kind: IssueMissing, Path: path.Path}}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot verify %s: %w", path.Path, err)
+	}
+
+	expectedKind := "file"
+	if strings.HasSuffix(path.Path, "/") {
+		expectedKind = "dir"
+	} else if path.Link != "" && path.Inode == 0 {
+		expectedKind = "symlink"
+	}
+	foundKind := pathKind(info.Mode().Type())
+	if foundKind != expectedKind {
+		return []*Issue{{
+			Kind:     IssueModified,
+			Path:     path.Path,
+			Expected: expectedKind,
+			Found:    foundKind,
+		}}, 0, nil
+	}
+
+	var issues []*Issue
+	mode := FormatMode(info.Mode())
+	if mode != path.Mode {
+		issues = append(issues, &Issue{
+			Kind:     IssueMode,
+			Path:     path.Path,
+			Expected: path.Mode,
+			Found:    mode,
+		})
+	}
+	var inode uint64
+	switch expectedKind {
+	case "symlink":
+		link, err := os.Readlink(realPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot verify %s: %w", path.Path, err)
+		}
+		if link != path.Link {
+			issues = append(issues, &Issue{
+				Kind:     IssueLink,
+				Path:     path.Path,
+				Expected: path.Link,
+				Found:    link,
+			})
+		}
+	case "file":
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			inode = stat.Ino
+		}
+		// The manifest lists itself without a digest.
+		if path.SHA256 == "" {
+			break
+		}
+		sum, err := FileSHA256(realPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot verify %s: %w", path.Path, err)
+		}
+		expected := path.SHA256
+		if path.FinalSHA256 != "" {
+			expected = path.FinalSHA256
+		}
+		if sum != expected {
+			issues = append(issues, &Issue{
+				Kind:     IssueModified,
+				Path:     path.Path,
+				Expected: expected,
+				Found:    sum,
+			})
+		}
+	}
+	return issues, inode, nil
+}
+
+func pathKind(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsRegular():
+		return "file"
+	default:
+		return "special"
+	}
+}
+
+// FileSHA256 returns the hex-encoded SHA256 digest of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,141 @@
+package manifestutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+const (
+	dataSHA256  = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	data2SHA256 = "d98cf53e0c8b77c14a96358d5b69584225b4bb9026423cbc2f7b0161894c402c"
+	otherSHA256 = "d9298a10d1b0735837dc4bd85dac641b0f3cef27a47e5d53a54f2f3f5b2fcffa"
+)
+
+var verifyManifest = `
+	{"jsonwall":"1.0","schema":"1.0","count":8}
+	{"kind":"path","path":"/dir/","mode":"0755","slices":["pkg1_myslice"]}
+	{"kind":"path","path":"/dir/file","mode":"0644","slices":["pkg1_myslice"],"sha256":"` + dataSHA256 + `","size":4}
+	{"kind":"path","path":"/dir/hard1","mode":"0644","slices":["pkg1_myslice"],"sha256":"` + dataSHA256 + `","size":4,"inode":1}
+	{"kind":"path","path":"/dir/hard2","mode":"0644","slices":["pkg1_myslice"],"sha256":"` + dataSHA256 + `","size":4,"link":"/dir/hard1","inode":1}
+	{"kind":"path","path":"/dir/link","mode":"0777","slices":["pkg1_myslice"],"link":"file"}
+	{"kind":"path","path":"/manifest.wall","mode":"0644","slices":["pkg1_manifest"]}
+	{"kind":"path","path":"/mutated","mode":"0644","slices":["pkg1_myslice"],"sha256":"` + dataSHA256 + `","final_sha256":"` + data2SHA256 + `","size":5}
+	{"kind":"path","path":"/other/nested/file","mode":"0644","slices":["pkg1_myslice"],"sha256":"` + dataSHA256 + `","size":4}
+`
+
+var verifyTests = []struct {
+	summary string
+	modify  func(c *C, rootDir string)
+	issues  []*manifestutil.Issue
+}{{
+	summary: "Root matching the manifest",
+}, {
+	summary: "Missing paths",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.Remove(filepath.Join(rootDir, "dir/file")), IsNil)
+		c.Assert(os.RemoveAll(filepath.Join(rootDir, "other")), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "missing", Path: "/dir/file"},
+		{Kind: "missing", Path: "/other/nested/file"},
+	},
+}, {
+	summary: "Extra paths",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "dir/extra"), nil, 0644), IsNil)
+		c.Assert(os.MkdirAll(filepath.Join(rootDir, "extra-dir/nested"), 0755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "extra-dir/nested/file"), nil, 0644), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "extra", Path: "/dir/extra", Found: "file"},
+		{Kind: "extra", Path: "/extra-dir/", Found: "dir"},
+	},
+}, {
+	summary: "Modified content",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "dir/file"), []byte("other"), 0644), IsNil)
+		// Mutated files are compared with their final content.
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "mutated"), []byte("data"), 0644), IsNil)
+		// The manifest has no digest recorded.
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "manifest.wall"), []byte("other"), 0644), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "modified", Path: "/dir/file", Expected: dataSHA256, Found: otherSHA256},
+		{Kind: "modified", Path: "/mutated", Expected: data2SHA256, Found: dataSHA256},
+	},
+}, {
+	summary: "Changed type",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.Remove(filepath.Join(rootDir, "dir/link")), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "dir/link"), []byte("data"), 0644), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "modified", Path: "/dir/link", Expected: "symlink", Found: "file"},
+	},
+}, {
+	summary: "Changed mode",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.Chmod(filepath.Join(rootDir, "dir"), 0700), IsNil)
+		c.Assert(os.Chmod(filepath.Join(rootDir, "dir/file"), 0600), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "mode", Path: "/dir/", Expected: "0755", Found: "0700"},
+		{Kind: "mode", Path: "/dir/file", Expected: "0644", Found: "0600"},
+	},
+}, {
+	summary: "Relinked paths",
+	modify: func(c *C, rootDir string) {
+		c.Assert(os.Remove(filepath.Join(rootDir, "dir/link")), IsNil)
+		c.Assert(os.Symlink("other", filepath.Join(rootDir, "dir/link")), IsNil)
+		c.Assert(os.Remove(filepath.Join(rootDir, "dir/hard2")), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(rootDir, "dir/hard2"), []byte("data"), 0644), IsNil)
+	},
+	issues: []*manifestutil.Issue{
+		{Kind: "link", Path: "/dir/hard2", Expected: "/dir/hard1"},
+		{Kind: "link", Path: "/dir/link", Expected: "file", Found: "other"},
+	},
+}}
+
+func (s *S) TestVerify(c *C) {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(verifyManifest), "\n") {
+		lines = append(lines, strings.TrimLeft(line, "\t"))
+	}
+	mfest, err := manifest.Read(strings.NewReader(strings.Join(lines, "\n")))
+	c.Assert(err, IsNil)
+
+	for _, test := range verifyTests {
+		c.Logf("Summary: %s", test.summary)
+		rootDir := c.MkDir()
+		for _, dir := range []string{"dir", "other", "other/nested"} {
+			c.Assert(os.Mkdir(filepath.Join(rootDir, dir), 0755), IsNil)
+			c.Assert(os.Chmod(filepath.Join(rootDir, dir), 0755), IsNil)
+		}
+		files := map[string]string{
+			"dir/file":          "data",
+			"dir/hard1":         "data",
+			"manifest.wall":     "",
+			"mutated":           "data2",
+			"other/nested/file": "data",
+		}
+		for path, data := range files {
+			c.Assert(os.WriteFile(filepath.Join(rootDir, path), []byte(data), 0644), IsNil)
+			c.Assert(os.Chmod(filepath.Join(rootDir, path), 0644), IsNil)
+		}
+		c.Assert(os.Link(filepath.Join(rootDir, "dir/hard1"), filepath.Join(rootDir, "dir/hard2")), IsNil)
+		c.Assert(os.Symlink("file", filepath.Join(rootDir, "dir/link")), IsNil)
+		if test.modify != nil {
+			test.modify(c, rootDir)
+		}
+
+		issues, err := manifestutil.Verify(mfest, rootDir)
+		c.Assert(err, IsNil)
+		c.Assert(issues, DeepEquals, test.issues)
+	}
+}
@@ -4,19 +4,31 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"time"
 
 	"golang.org/x/crypto/openpgp/armor"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
+// PublicKey is a public key along with the details found in the armored data
+// it was decoded from which decide whether it may still be trusted.
+type PublicKey struct {
+	*packet.PublicKey
+	validity keyValidity
+}
+
 // DecodeKeys decodes public and private key packets from armored data.
-func DecodeKeys(armoredData []byte) (pubKeys []*packet.PublicKey, privKeys []*packet.PrivateKey, err error) {
+func DecodeKeys(armoredData []byte) (pubKeys []*PublicKey, privKeys []*packet.PrivateKey, err error) {
 	block, err := armor.Decode(bytes.NewReader(armoredData))
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot decode armored data")
 	}
 
+	// Signatures apply to the last key and user id seen before them.
+	var primary *packet.PublicKey
+	var current *PublicKey
+	var userId string
 	reader := packet.NewReader(block.Body)
 	for {
 		p, err := reader.Next()
@@ -26,19 +38,115 @@ func DecodeKeys(armoredData []byte) (pubKeys []*packet.PublicKey, privKeys []*pa
 			}
 			return nil, nil, err
 		}
-		if privKey, ok := p.(*packet.PrivateKey); ok {
-			privKeys = append(privKeys, privKey)
-		}
-		if pubKey, ok := p.(*packet.PublicKey); ok {
-			pubKeys = append(pubKeys, pubKey)
+		switch p := p.(type) {
+		case *packet.PrivateKey:
+			privKeys = append(privKeys, p)
+			current = nil
+		case *packet.PublicKey:
+			current = &PublicKey{PublicKey: p}
+			pubKeys = append(pubKeys, current)
+			if !p.IsSubkey {
+				primary = p
+			}
+			userId = ""
+		case *packet.UserId:
+			userId = p.Id
+		case *packet.Signature:
+			if primary != nil && current != nil {
+				current.recordValidity(primary, userId, p)
+			}
 		}
 	}
 	return pubKeys, privKeys, nil
 }
 
+// keyValidity holds the details found in the self-signatures and revocations
+// of a public key.
+type keyValidity struct {
+	// selfSigned is the creation time of the self-signature in use.
+	selfSigned time.Time
+	// expires is the time the key expires, or zero if it never does.
+	expires time.Time
+	// revocation is the revocation signature of the key, if any.
+	revocation *packet.Signature
+}
+
+// recordValidity records the validity details found in sig, a signature
+// over key made by the primary key, so that VerifyAnySignature can take
+// them into account. Signatures which cannot be verified are ignored.
+func (key *PublicKey) recordValidity(primary *packet.PublicKey, userId string, sig *packet.Signature) {
+	var revocation bool
+	var err error
+	switch {
+	case sig.SigType == packet.SigTypeKeyRevocation && key.PublicKey == primary:
+		revocation = true
+		err = primary.VerifyRevocationSignature(sig)
+	case sig.SigType == packet.SigTypeSubkeyRevocation && key.PublicKey != primary:
+		revocation = true
+		err = primary.VerifyKeySignature(key.PublicKey, sig)
+	case sig.SigType == packet.SigTypeSubkeyBinding && key.PublicKey != primary:
+		err = primary.VerifyKeySignature(key.PublicKey, sig)
+	case sig.SigType >= packet.SigTypeGenericCert && sig.SigType <= packet.SigTypePositiveCert &&
+		key.PublicKey == primary && userId != "" && sig.IssuerKeyId != nil && *sig.IssuerKeyId == primary.KeyId:
+		err = primary.VerifyUserIdSignature(userId, primary, sig)
+	default:
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	validity := &key.validity
+	if revocation {
+		validity.revocation = sig
+		return
+	}
+	// The most recent self-signature decides when the key expires.
+	if sig.CreationTime.Before(validity.selfSigned) {
+		return
+	}
+	validity.selfSigned = sig.CreationTime
+	validity.expires = time.Time{}
+	if sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+		validity.expires = key.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+	}
+}
+
+// checkValidity returns an error if sig, which was verified to be made by
+// key, cannot be trusted because of the key being expired or revoked, or
+// because of the creation time of the signature.
+func checkValidity(key *PublicKey, sig *packet.Signature, now time.Time) error {
+	keyId := key.KeyIdString()
+	if sig.CreationTime.Before(key.CreationTime) {
+		return fmt.Errorf("signature made by key %s on %s predates the key", keyId, formatTime(sig.CreationTime))
+	}
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+		expires := sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+		if now.After(expires) {
+			return fmt.Errorf("signature made by key %s expired on %s", keyId, formatTime(expires))
+		}
+	}
+
+	validity := &key.validity
+	if validity.revocation != nil {
+		if validity.revocation.RevocationReasonText != "" {
+			return fmt.Errorf("key %s was revoked: %s", keyId, validity.revocation.RevocationReasonText)
+		}
+		return fmt.Errorf("key %s was revoked", keyId)
+	}
+	if !validity.expires.IsZero() && now.After(validity.expires) {
+		return fmt.Errorf("key %s expired on %s", keyId, formatTime(validity.expires))
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 MST")
+}
+
 // DecodePubKey decodes a single public key packet from armored data. The
 // data should contain exactly one public key packet and no private key packets.
-func DecodePubKey(armoredData []byte) (*packet.PublicKey, error) {
+func DecodePubKey(armoredData []byte) (*PublicKey, error) {
 	pubKeys, privKeys, err := DecodeKeys(armoredData)
 	if err != nil {
 		return nil, err
@@ -84,6 +192,33 @@ func DecodeClearSigned(clearData []byte) (sigs []*packet.Signature, canonicalBod
 	return sigs, block.Bytes, nil
 }
 
+// DecodeSignatures decodes the signatures in armored data, such as the
+// detached signature of a file.
+func DecodeSignatures(armoredData []byte) ([]*packet.Signature, error) {
+	block, err := armor.Decode(bytes.NewReader(armoredData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode armored data")
+	}
+	var sigs []*packet.Signature
+	reader := packet.NewReader(block.Body)
+	for {
+		p, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("cannot parse armored data: %w", err)
+		}
+		if sig, ok := p.(*packet.Signature); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("armored data contains no signatures")
+	}
+	return sigs, nil
+}
+
 // VerifySignature returns nil if sig is a valid signature from pubKey.
 func VerifySignature(pubKey *packet.PublicKey, sig *packet.Signature, body []byte) error {
 	hash := sig.Hash.New()
@@ -95,19 +230,46 @@ func VerifySignature(pubKey *packet.PublicKey, sig *packet.Signature, body []byt
 }
 
 // VerifyAnySignature returns nil if any signature in sigs is a valid signature
-// mady by any of the public keys in pubKeys.
-func VerifyAnySignature(pubKeys []*packet.PublicKey, sigs []*packet.Signature, body []byte) error {
-	var err error
+// mady by any of the public keys in pubKeys, and complies with DefaultPolicy.
+//
+// Besides the cryptographic check, a signature is only valid if it was made
+// after the key was created, it has not expired, and the key has neither
+// expired nor been revoked according to the armored data it was decoded
+// from. When a signature fails only these checks, the error explains why.
+func VerifyAnySignature(pubKeys []*PublicKey, sigs []*packet.Signature, body []byte) error {
+	_, err := DefaultPolicy.VerifyAnySignature(pubKeys, sigs, body)
+	return err
+}
+
+// VerifyAnySignature works as the VerifyAnySignature function, but requires
+// the signature to comply with the policy p, and returns the details of the
+// signature which verified body.
+func (p *Policy) VerifyAnySignature(pubKeys []*PublicKey, sigs []*packet.Signature, body []byte) (*Verified, error) {
+	now := time.Now()
+	var err, rejectErr error
 	for _, sig := range sigs {
 		for _, key := range pubKeys {
-			err = VerifySignature(key, sig, body)
+			err = VerifySignature(key.PublicKey, sig, body)
+			if err != nil {
+				continue
+			}
+			err = p.check(key.PublicKey, sig)
+			if err == nil {
+				err = checkValidity(key, sig, now)
+			}
 			if err == nil {
-				return nil
+				return &Verified{Key: key.PublicKey, Signature: sig}, nil
+			}
+			if rejectErr == nil {
+				rejectErr = err
 			}
 		}
 	}
+	if rejectErr != nil {
+		return nil, rejectErr
+	}
 	if len(sigs) == 1 && len(pubKeys) == 1 {
-		return err
+		return nil, err
 	}
-	return fmt.Errorf("cannot verify any signatures")
+	return nil, fmt.Errorf("cannot verify any signatures")
 }
@@ -1,7 +1,8 @@
 package pgputil_test
 
 import (
-	"golang.org/x/crypto/openpgp/packet"
+	"log"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/chisel/internal/pgputil"
@@ -11,13 +12,25 @@ import (
 var (
 	key1 = testutil.PGPKeys["key1"]
 	key2 = testutil.PGPKeys["key2"]
+
+	expiredKey = mustDecodePubKey(expiredPubKeyArmor)
+	revokedKey = mustDecodePubKey(revokedPubKeyArmor)
+	datedKey   = mustDecodePubKey(datedPubKeyArmor)
 )
 
+func mustDecodePubKey(armor string) *pgputil.PublicKey {
+	pubKey, err := pgputil.DecodePubKey([]byte(armor))
+	if err != nil {
+		log.Panicf("cannot decode public key: %v", err)
+	}
+	return pubKey
+}
+
 type archiveKeyTest struct {
 	summary  string
 	armor    string
 	relerror string
-	pubKey   *packet.PublicKey
+	pubKey   *pgputil.PublicKey
 }
 
 var archiveKeyTests = []archiveKeyTest{{
@@ -70,22 +83,22 @@ func (s *S) TestDecodeArchivePubKey(c *C) {
 type verifyClearSignTest struct {
 	summary   string
 	clearData string
-	pubKeys   []*packet.PublicKey
+	pubKeys   []*pgputil.PublicKey
 	relerror  string
 }
 
 var verifyClearSignTests = []verifyClearSignTest{{
 	summary:   "Good data with proper sign",
 	clearData: clearSignedData,
-	pubKeys:   []*packet.PublicKey{key1.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
 }, {
 	summary:   "Good data with multiple signatures",
 	clearData: clearSignedWithMultipleSigns,
-	pubKeys:   []*packet.PublicKey{key1.PubKey, key2.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey, key2.PubKey},
 }, {
 	summary:   "Multiple signatures: verify at least one signature",
 	clearData: clearSignedWithMultipleSigns,
-	pubKeys:   []*packet.PublicKey{key1.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
 }, {
 	summary:   "Multiple signatures: no valid public keys",
 	clearData: clearSignedWithMultipleSigns,
@@ -93,23 +106,52 @@ var verifyClearSignTests = []verifyClearSignTest{{
 }, {
 	summary:   "Invalid data: improper hash",
 	clearData: invalidClearSignedData,
-	pubKeys:   []*packet.PublicKey{key1.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
 	relerror:  "openpgp: .*invalid signature: hash tag doesn't match.*",
 }, {
 	summary:   "Invalid data: bad packets",
 	clearData: invalidClearSignedDataBadPackets,
-	pubKeys:   []*packet.PublicKey{key1.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
 	relerror:  "cannot parse armored data: openpgp: .*",
 }, {
 	summary:   "Invalid data: malformed clearsign text",
 	clearData: "foo\n",
-	pubKeys:   []*packet.PublicKey{key1.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
 	relerror:  "cannot decode clearsign text",
 }, {
 	summary:   "Wrong public key to verify with",
 	clearData: clearSignedData,
-	pubKeys:   []*packet.PublicKey{key2.PubKey},
+	pubKeys:   []*pgputil.PublicKey{key2.PubKey},
 	relerror:  "openpgp: .*invalid signature:.*verification failure",
+}, {
+	summary:   "Expired key",
+	clearData: clearSignedByExpiredKey,
+	pubKeys:   []*pgputil.PublicKey{expiredKey},
+	relerror:  "key 8F42796507E39574 expired on 2020-01-02 00:00:00 UTC",
+}, {
+	summary:   "Revoked key",
+	clearData: clearSignedByRevokedKey,
+	pubKeys:   []*pgputil.PublicKey{revokedKey},
+	relerror:  "key B11F53EA44505EC5 was revoked",
+}, {
+	summary:   "Signature older than the key",
+	clearData: clearSignedBeforeKeyCreation,
+	pubKeys:   []*pgputil.PublicKey{datedKey},
+	relerror:  "signature made by key 7CCCE4F7ACAEC40C on 2019-12-01 00:00:00 UTC predates the key",
+}, {
+	summary:   "Expired signature",
+	clearData: clearSignedWithExpiredSignature,
+	pubKeys:   []*pgputil.PublicKey{datedKey},
+	relerror:  "signature made by key 7CCCE4F7ACAEC40C expired on 2020-01-02 12:00:00 UTC",
+}, {
+	summary:   "Expired key among other keys",
+	clearData: clearSignedByExpiredKey,
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey, expiredKey},
+	relerror:  "key 8F42796507E39574 expired on 2020-01-02 00:00:00 UTC",
+}, {
+	summary:   "Valid key among expired keys",
+	clearData: clearSignedData,
+	pubKeys:   []*pgputil.PublicKey{expiredKey, key1.PubKey},
 }}
 
 func (s *S) TestVerifySignature(c *C) {
@@ -129,6 +171,55 @@ func (s *S) TestVerifySignature(c *C) {
 	}
 }
 
+var decodeSignaturesTests = []struct {
+	summary  string
+	armor    string
+	body     string
+	pubKeys  []*pgputil.PublicKey
+	relerror string
+}{{
+	summary: "Good detached signature",
+	armor:   detachedSignature,
+	body:    "foo\n",
+	pubKeys: []*pgputil.PublicKey{key1.PubKey},
+}, {
+	summary:  "Detached signature over other data",
+	armor:    detachedSignature,
+	body:     "bar\n",
+	pubKeys:  []*pgputil.PublicKey{key1.PubKey},
+	relerror: "openpgp: .*invalid signature: hash tag doesn't match.*",
+}, {
+	summary:  "Detached signature from another key",
+	armor:    detachedSignature,
+	body:     "foo\n",
+	pubKeys:  []*pgputil.PublicKey{key2.PubKey},
+	relerror: "openpgp: .*invalid signature:.*verification failure",
+}, {
+	summary:  "Armored data with no signatures",
+	armor:    twoPubKeysArmor,
+	relerror: "armored data contains no signatures",
+}, {
+	summary:  "Invalid armored data",
+	armor:    "foo\n",
+	relerror: "cannot decode armored data",
+}}
+
+func (s *S) TestDecodeSignatures(c *C) {
+	for _, test := range decodeSignaturesTests {
+		c.Logf("Summary: %s", test.summary)
+
+		sigs, err := pgputil.DecodeSignatures([]byte(test.armor))
+		if err == nil {
+			err = pgputil.VerifyAnySignature(test.pubKeys, sigs, []byte(test.body))
+		}
+		if test.relerror != "" {
+			c.Assert(err, ErrorMatches, test.relerror)
+		} else {
+			c.Assert(err, IsNil)
+		}
+	}
+}
+
 // twoPubKeysArmor contains two public keys:
 //   - 854BAF1AA9D76600 ("foo-bar <foo@bar>")
 //   - 871920D1991BC93C ("Ubuntu Archive Automatic Signing Key (2018) <ftpmaster@ubuntu.com>")
@@ -265,3 +356,173 @@ mI0EZXAwcgEEAMBQ4Qx6xam1k1hyjPrKQfCnGRBBm2+Lw9DHQcz0lreH51iZEVkS
 =U79/
 -----END PGP PUBLIC KEY BLOCK-----
 `
+
+// detachedSignature is the detached signature of "foo\n" made by key
+// 854BAF1AA9D76600 (foo@bar).
+const detachedSignature = `
+-----BEGIN PGP SIGNATURE-----
+
+iQEzBAABCgAdFiEEDp0LAdsRnT9gfhU5hUuvGqnXZgAFAmWSAIAACgkQhUuvGqnX
+ZgC3ggf/RgrSqp8o29Q0Ckr5c2CHpRGvXElBI8Y9nBerW3f0xDrbqL+sp7h9UJ0F
+LjwaaX0NcFkT5Gn77E+cJ6eUFDmWSHCdzvwrZRNC5NF7bsn8vtsiMQ8KqThta+9m
+chwsXB7SPzmucKbKw58NfDgGQvrLql4+7qAx1JoqOyvy23In2MoGAWnSeKch9iJg
+Ez4JQ6li7uLeSClG8qEBapeqgB4PRbditVErIn4p0DPTjli9nh9HBLgnl8yKoWhp
+oohKZ82dkh4UM/HcI7pLihPxH1OG/f8tkQd1JrE3z7pNAK+O1+/a63eUhjf1WcrV
+yB/M++upL9bb4jAYY3+7wYMZ4LR93w==
+=gKDp
+-----END PGP SIGNATURE-----
+`
+
+// expiredPubKeyArmor contains key 8F42796507E39574 ("expired <expired@key>"),
+// created on 2020-01-01 and valid for a single day.
+const expiredPubKeyArmor = `
+-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQENBF4L4QABCADZ0BAYovWpehT25a76cHD8hrHE+dvTCMF/ykDKc8TnxKMdfCjM
+1wiv8mfctcGt1dE2j8zjozps9Q+grmZofTfIW/PP8MpEbnnbCb1tB2xEB9y6z94B
+PbKgkFZT3W/ROvk9ErXQJ3fO307T7+aG/4o4aXDvdTzhAA3M+A5mCgynPSuPxtWh
+rq7z3WTPrw/g7lqR0PkPmxNRA49LxtAyJdMj+b3aJvrOLVroAjfFVNWspjg064aE
+TDkMFeezH90b2nQx2Q7yKZReuCAwEHQR/0+EoACVOAgU4bGRypgq0nJUgZQYv6Y/
+InliTWrNVksA1uuwTSCYPnCn4TPhFT8RbPQLABEBAAG0FWV4cGlyZWQgPGV4cGly
+ZWRAa2V5PokBVAQTAQoAPhYhBIGKzwjuXpe1RySK6I9CeWUH45V0BQJeC+EAAhsD
+BQkAAVGABQsJCAcCBhUKCQgLAgQWAgMBAh4BAheAAAoJEI9CeWUH45V0wXAH/3VD
+ds7CDTNO9uSf/MOop+aPopcMzV45K5Kxgs40daUzuHE7Na7jbZpDx8VT/+NeeWhz
+5uZMJ9kpU1vqdqODHP5uQDn3s4lO4ZMBgSscEUMWtFc2+CtbH6wy/vDJ5GGsj7p5
+BAMA+sun2+uugD5TPYoQTumkqgjcd5Ob+VsueqV8eeyN+zPodAfJvEtCPLlpF/Un
+MogqclemlOzp1LkDr/FKat+r8RMldALBjiC7AuFoW9ZyrPZ2A2jD0Yvpfd+xXTvs
+CVQpx83chzXjqI3YObngvD/ljCGhf7VJHyWZoadxJo5ZIiw7HngdO3a//Xb+YQGv
+F9QcacN+BsMIdl/EvAY=
+=RNs6
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// clearSignedByExpiredKey is signed with key 8F42796507E39574 while it
+// was still valid.
+const clearSignedByExpiredKey = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+foo
+-----BEGIN PGP SIGNATURE-----
+
+iQFABAEBCgAqFiEEgYrPCO5el7VHJIroj0J5ZQfjlXQFAl4MicAMHGV4cGlyZWRA
+a2V5AAoJEI9CeWUH45V0oqMH/i8BX/CPob6yCUwC5UOMR+RIyfwMLa6wBZjS2LOO
+DzWvDMOOEwnMzIvWDuRWKMa0AOu53RcNboRzboLMz+UnIyTswbTBFW/hpb261HJi
++HQJ/4DuQaQ/rLXgaAZw60GaSUOjCdLkcS5WANumWHXu+G3g4aVFp/2I8oOW36fv
+yhbXc8BTrMWj9iDa+u7ERwnILeDeq7IedIYEzepDLWmK/gqlPJ3E3UszCKAtZkUp
+M7yYKNXX04x5piiG6F/JmCDMgjNkIMmaXgBlVJJqQP3U5oeuUemS8oXDhdD9wCTk
+cvpo2tN7hjI/Ox/DxHkN4WXL6aJwBQEUqfVyV+iAdSr72FM=
+=TgJg
+-----END PGP SIGNATURE-----
+`
+
+// revokedPubKeyArmor contains key B11F53EA44505EC5 ("revoked <revoked@key>")
+// along with its revocation signature.
+const revokedPubKeyArmor = `
+-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQENBF4L4QABCADSnK8CzgDp1d+vZ2zz5GY0ta8BF0v5bopQ59+hcMF7wwqunbJ6
+C27Cme456614YR3XUJpbJQl8agj7pr1tpbHQcEoMtIfD0ukAmCSPZOe0jB+kkDwJ
+uXTZbjxPg2SI5gkyVntu1Q63BoWLQOMBD3XHnEyfy+CI4XpvavdApVyZlvcDcCfF
+mM4c/Kctw5OsaZ6Hia59chkfSBzJlDUJFpxowaCKhD2ikBuO8Qfw2uYjF/p/DWYj
+5pXSA9cUDuRfjswy2FpkiAK/N4xmsWaU/PbA1OSFpnng0MH9FTDwc/0Ii3UaKYpl
+devQVgZ8Zvlgnxk4SmUfiFtwmbtfvBP2AMJVABEBAAGJATYEIAEKACAWIQSOsZCU
+qH4x8abiviixH1PqRFBexQUCXgvhAAIdAAAKCRCxH1PqRFBexfzdB/98OBkV76/j
+y0z7b7M5Y0WID+ohdKEG2XpSKI/iqUCBrfh/V5k/ECGWBFZ+gFp5/JgNwaSsS8oF
+PtsbTpl/lKnlGkSTV0/UWVDjg2S2KM9Gzxmh60ZVXfvqoXibwfPyQ177JzQunMps
+rVLHJ5T8HtUPJdkK8s3j7HHLjUJEO+vUB25T2jERmbx+Js8XxcK2mo3aKWB1OP2H
+2dgCNqXb5vQ/blD1jiavdwPAfzD4LnrEdeQ6Z5wTE4awRFYrqLX1jBC0miwjgYHc
+Do1/y9B4timDy+UizLN2ALpbUuTI4ZX1D+M5jBplrV2wPktuKYJJ1sw/rLroKYB4
+2Yz0BQCYThdStBVyZXZva2VkIDxyZXZva2VkQGtleT6JAU4EEwEKADgWIQSOsZCU
+qH4x8abiviixH1PqRFBexQUCXgvhAAIbAwULCQgHAgYVCgkICwIEFgIDAQIeAQIX
+gAAKCRCxH1PqRFBexYjwB/oCCV5vCSamG9P179v14Y13NXp3vxGij40nPubFLErd
+Mnszi+mtEdMJByMGGy07Stl9QAHUYosXLmUrT42eBeICy8AgtXeBAHJ51sr2OaYB
+/NCgJaiGLEIjxrJOM6ok0G5KzR6lpVgbvIp+M/fOKkyfTCQ3VamiFf0BHz8v1vNd
+kJA2KEuwckdZEf3w4dD1sfVn3S1Q6EXDAPAbaph4UANuIaffKGzuF8K+K5nTVH67
+AKqF6YLIlaZokYdhoYMplqaFsfdC6L/0XaeOnsFCA0rw3sAMjY/A4TKPYLs+zxd6
++quIDuUyy/XYOrp8zdul6n/YSg8q8T8jB101nu140eB+
+=RclS
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// clearSignedByRevokedKey is signed with key B11F53EA44505EC5.
+const clearSignedByRevokedKey = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+foo
+-----BEGIN PGP SIGNATURE-----
+
+iQFABAEBCgAqFiEEjrGQlKh+MfGm4r4osR9T6kRQXsUFAl4MicAMHHJldm9rZWRA
+a2V5AAoJELEfU+pEUF7FkGEIALl+5bGzoX5ZWOg/Rs/TxN1V4yHrz/edZ+pr8ISy
+k+UeOvV97SYUXhjCLYf69zFw/HQiLvGiVm1JPBqPR+NTp1qVNiTAe7nJRKkcca5K
+Mg7ljjTKj36ZnIU+LsPScTqpmOLyLNKMrR92piGEbcKEaF1NdxYHeSsqmvw1hSMJ
+wia/9g3qvKw/qQ8PCXT5BjfTwwSgl7CcHRs8aNFApJUfwZj3ueJY7tUNcNvyzaiX
+HKprNPbtEJLlcMfEPn9hBVFxmH8Bq/x2rSg6B9XC/z196zsei7ME+DMLMbCniNKN
+3RLYHjj6FP2us5eQL36OSDy1fzRtiipt1ORVj6ME27gkhGU=
+=vt2W
+-----END PGP SIGNATURE-----
+`
+
+// datedPubKeyArmor contains key 7CCCE4F7ACAEC40C ("dated <dated@key>"),
+// created on 2020-01-01 and valid forever.
+const datedPubKeyArmor = `
+-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQENBF4L4QABCACiEXBctQpOl1TeMX6OktzblTHEoAZIuf95kABVndfiFr4gLy23
+G77P/SB7qyHHMr81+iNusoaJFGqohxSo3GgM8zxRJTquWoXyJynKkLmLi4ziLIAJ
+cgc0oqqclr+SJ1WYWek3QB7amRqJM9waFzxL+l2oJBXqHePEwffUuaR6wbanNZGV
+46535DAiiUkNuWMTnld0atC9tt6qApEUd41twuM/aPlbd26TWB07cyA9x2D9RIO9
+gDmAeyDp6vxIiWtUod9j9Biydxbrg63/qQbdswJ9pPwEE4+IsWF+1C2w+gojzkc+
+6gzZ2xGqdjGE9PVHnpGVNxp+SNMf3gjab/1NABEBAAG0EWRhdGVkIDxkYXRlZEBr
+ZXk+iQFOBBMBCgA4FiEEEmgWenlYovJJS0XSfMzk96yuxAwFAl4L4QACGwMFCwkI
+BwIGFQoJCAsCBBYCAwECHgECF4AACgkQfMzk96yuxAyilgf9GV4kbiG6LZLt2b2e
+f91ZZJaKNeda7ABRX7+y+c8Y44XBsOv9365MZo3NLayVmsvnrCwW7QxcfOI1Ficf
+aL29/erMC4ihxcWjF5/etQbRI8S82WakQiEuO9kibfkcGLbcKU4wVvMPCIhrHXXX
+EGwqNIJYQJsdtlirOUYLIKyLwz/p14roEfco9MFPCvSe6t/uoujcWclkwa2U0UVL
+nvNTmaOCUJOorGWt2CDSRleXnYSaK7d2eUq012wby4ZlGk5OpACMk92GGcqVk4SI
+f8Emugu0NwUjMIG+Miu6a23NRmHmcZaHybh3XIhGNVnzzD23JYrXL+NwIT/xSlvt
+A5OrKg==
+=4bfv
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// clearSignedBeforeKeyCreation is signed with key 7CCCE4F7ACAEC40C, with
+// a signature made before the key was created.
+const clearSignedBeforeKeyCreation = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+foo
+-----BEGIN PGP SIGNATURE-----
+
+iQE+BAEBCgAoFiEEEmgWenlYovJJS0XSfMzk96yuxAwFAl3jAoAKHGRhdGVkQGtl
+eQAKCRB8zOT3rK7EDGwcCACEAzqxk2lJUSkJx2zfVJgWRCH8V8j3Bv910J33Mwhs
+hNsMf96FR4HgBftdfMeLiRymu2HEJ47kXlegKi4cuhrt+thNv6WX5JClUFkFqah/
+KctL+1ZUoeS8OdAOUjAAcPtnyQ0U/kq2CIuy+Doxj+EwLKiKN+r+YLbTZQVOAMg8
+/QWu9ubRuv3q5eboJOuNOYLWmTwkSVf1puBiIIbeOXWLPqDNW5se+q8UpDdv0v5R
+WNSLWQO5v5YoOt+PowVz3WE3SmBZNYrjvA/QUEZbK2AsEzVSaGBlt56GFZHEELzk
+osl+4qjM71AQMAFOJLwzFwoALdWngI/mIxS/iFNS4z4e
+=5gR7
+-----END PGP SIGNATURE-----
+`
+
+// clearSignedWithExpiredSignature is signed with key 7CCCE4F7ACAEC40C,
+// with a signature which expired a day after being made.
+const clearSignedWithExpiredSignature = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+foo
+-----BEGIN PGP SIGNATURE-----
+
+iQFEBAEBCgAuFiEEEmgWenlYovJJS0XSfMzk96yuxAwFAl4MicAFgwABUYAKHGRh
+dGVkQGtleQAKCRB8zOT3rK7EDMIaB/43Tg6P48+tl8vDxUZqhuiXdmm2SlqVY67k
+/ncjzA75Efanf4I2SpNulloh/v3b8arnYF+0mVqXlmnM7s1xSSoc2BAcS+8/ccwm
+U3YLmLMo70V0MfdAMy5JW8Ib3VBq+SzdMBz9ZwlIJ0d4MFIDb0LZuWAXImF7cfIE
+oDg4W+NiCX/EVn9CSSk/TYEDqVZUXbNCyYqz6N+XafdLg2W78bfhxVuihNk236+1
+eLrwlK19/lXDNvXNcs7U4vKbVfTzE4i4/c8TgjUT/pGRsNz4PSgtgX+mp4+G0+Ue
+xuqPf1ZDlnLsLlXGFIArAVCnhBDLartWN2y0j8NMx6S6oBDJv194
+=T+WU
+-----END PGP SIGNATURE-----
+`
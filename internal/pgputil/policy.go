@@ -0,0 +1,133 @@
+package pgputil
+
+import (
+	"crypto"
+	"fmt"
+	"maps"
+	"slices"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Policy restricts the algorithms accepted when verifying signatures, so
+// that signatures relying on weak cryptography are rejected even when they
+// are otherwise valid.
+type Policy struct {
+	// MinKeySize is the minimum size in bits of RSA and DSA keys. Keys of
+	// any size are accepted if zero.
+	MinKeySize int
+	// Hashes lists the hash algorithms accepted in signatures, such as
+	// "sha256". All hash algorithms are accepted if empty.
+	Hashes []string
+	// KeyAlgorithms lists the public key algorithms accepted, such as
+	// "rsa". All key algorithms are accepted if empty.
+	KeyAlgorithms []string
+}
+
+// DefaultPolicy is used to verify signatures when no other policy is
+// provided. It rejects SHA-1 and older hash algorithms, as well as RSA and
+// DSA keys smaller than 2048 bits.
+var DefaultPolicy = &Policy{
+	MinKeySize: 2048,
+	Hashes:     []string{"sha224", "sha256", "sha384", "sha512"},
+}
+
+var hashNames = map[crypto.Hash]string{
+	crypto.MD5:       "md5",
+	crypto.SHA1:      "sha1",
+	crypto.RIPEMD160: "ripemd160",
+	crypto.SHA224:    "sha224",
+	crypto.SHA256:    "sha256",
+	crypto.SHA384:    "sha384",
+	crypto.SHA512:    "sha512",
+}
+
+var keyAlgorithmNames = map[packet.PublicKeyAlgorithm]string{
+	packet.PubKeyAlgoRSA:            "rsa",
+	packet.PubKeyAlgoRSAEncryptOnly: "rsa",
+	packet.PubKeyAlgoRSASignOnly:    "rsa",
+	packet.PubKeyAlgoDSA:            "dsa",
+	packet.PubKeyAlgoElGamal:        "elgamal",
+	packet.PubKeyAlgoECDH:           "ecdh",
+	packet.PubKeyAlgoECDSA:          "ecdsa",
+}
+
+func hashName(hash crypto.Hash) string {
+	if name, ok := hashNames[hash]; ok {
+		return name
+	}
+	return fmt.Sprintf("hash-%d", hash)
+}
+
+func keyAlgorithmName(algo packet.PublicKeyAlgorithm) string {
+	if name, ok := keyAlgorithmNames[algo]; ok {
+		return name
+	}
+	return fmt.Sprintf("algorithm-%d", algo)
+}
+
+// Validate returns an error if the policy refers to unknown algorithms.
+func (p *Policy) Validate() error {
+	if p.MinKeySize < 0 {
+		return fmt.Errorf("invalid minimum key size: %d", p.MinKeySize)
+	}
+	for _, name := range p.Hashes {
+		if !slices.Contains(slices.Collect(maps.Values(hashNames)), name) {
+			return fmt.Errorf("unknown hash algorithm: %q", name)
+		}
+	}
+	for _, name := range p.KeyAlgorithms {
+		if !slices.Contains(slices.Collect(maps.Values(keyAlgorithmNames)), name) {
+			return fmt.Errorf("unknown key algorithm: %q", name)
+		}
+	}
+	return nil
+}
+
+// check returns an error if sig, made by key, does not comply with the
+// policy.
+func (p *Policy) check(key *packet.PublicKey, sig *packet.Signature) error {
+	keyId := key.KeyIdString()
+	algo := keyAlgorithmName(key.PubKeyAlgo)
+	if len(p.KeyAlgorithms) > 0 && !slices.Contains(p.KeyAlgorithms, algo) {
+		return fmt.Errorf("key %s uses %s algorithm, not allowed by policy", keyId, algo)
+	}
+	if p.MinKeySize > 0 {
+		bits, err := key.BitLength()
+		if err == nil && int(bits) < p.MinKeySize {
+			return fmt.Errorf("key %s has %d bits, policy requires at least %d", keyId, bits, p.MinKeySize)
+		}
+	}
+	hash := hashName(sig.Hash)
+	if len(p.Hashes) > 0 && !slices.Contains(p.Hashes, hash) {
+		return fmt.Errorf("signature made by key %s uses %s hash, not allowed by policy", keyId, hash)
+	}
+	return nil
+}
+
+// Verified holds the details of the signature which verified some data.
+type Verified struct {
+	Key       *packet.PublicKey
+	Signature *packet.Signature
+}
+
+// KeyAlgorithm returns the public key algorithm of the key, along with its
+// size in bits when known, as in "rsa 4096".
+func (v *Verified) KeyAlgorithm() string {
+	algo := keyAlgorithmName(v.Key.PubKeyAlgo)
+	if bits, err := v.Key.BitLength(); err == nil {
+		algo = fmt.Sprintf("%s %d", algo, bits)
+	}
+	return algo
+}
+
+// Hash returns the name of the hash algorithm used in the signature.
+func (v *Verified) Hash() string {
+	return hashName(v.Signature.Hash)
+}
+
+// String returns a description of the key and algorithms used, as in
+// "key 871920D1991BC93C (rsa 4096) with sha512".
+func (v *Verified) String() string {
+	return fmt.Sprintf("key %s (%s) with %s", v.Key.KeyIdString(), v.KeyAlgorithm(), v.Hash())
+}
@@ -0,0 +1,128 @@
+package pgputil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/pgputil"
+)
+
+var policyTests = []struct {
+	summary   string
+	policy    *pgputil.Policy
+	clearData string
+	pubKeys   []*pgputil.PublicKey
+	verified  string
+	relerror  string
+}{{
+	summary:   "Default policy",
+	policy:    pgputil.DefaultPolicy,
+	clearData: clearSignedData,
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
+	verified:  "key 854BAF1AA9D76600 (rsa 2048) with sha512",
+}, {
+	summary:   "Default policy rejects SHA-1",
+	policy:    pgputil.DefaultPolicy,
+	clearData: clearSignedWithSHA1,
+	pubKeys:   []*pgputil.PublicKey{datedKey},
+	relerror:  "signature made by key 7CCCE4F7ACAEC40C uses sha1 hash, not allowed by policy",
+}, {
+	summary:   "Default policy rejects small keys",
+	policy:    pgputil.DefaultPolicy,
+	clearData: clearSignedWithMultipleSigns,
+	pubKeys:   []*pgputil.PublicKey{key2.PubKey},
+	relerror:  "key 9568570379BF1F43 has 1024 bits, policy requires at least 2048",
+}, {
+	summary:   "Empty policy accepts anything",
+	policy:    &pgputil.Policy{},
+	clearData: clearSignedWithMultipleSigns,
+	pubKeys:   []*pgputil.PublicKey{key2.PubKey},
+	verified:  "key 9568570379BF1F43 (rsa 1024) with sha512",
+}, {
+	summary:   "Minimum key size",
+	policy:    &pgputil.Policy{MinKeySize: 4096},
+	clearData: clearSignedData,
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
+	relerror:  "key 854BAF1AA9D76600 has 2048 bits, policy requires at least 4096",
+}, {
+	summary:   "Allowed hashes",
+	policy:    &pgputil.Policy{Hashes: []string{"sha256"}},
+	clearData: clearSignedData,
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
+	relerror:  "signature made by key 854BAF1AA9D76600 uses sha512 hash, not allowed by policy",
+}, {
+	summary:   "Allowed key algorithms",
+	policy:    &pgputil.Policy{KeyAlgorithms: []string{"ecdsa"}},
+	clearData: clearSignedData,
+	pubKeys:   []*pgputil.PublicKey{key1.PubKey},
+	relerror:  "key 854BAF1AA9D76600 uses rsa algorithm, not allowed by policy",
+}, {
+	summary:   "Any signature complying with the policy",
+	policy:    pgputil.DefaultPolicy,
+	clearData: clearSignedWithMultipleSigns,
+	pubKeys:   []*pgputil.PublicKey{key2.PubKey, key1.PubKey},
+	verified:  "key 854BAF1AA9D76600 (rsa 2048) with sha512",
+}}
+
+func (s *S) TestPolicy(c *C) {
+	for _, test := range policyTests {
+		c.Logf("Summary: %s", test.summary)
+
+		sigs, body, err := pgputil.DecodeClearSigned([]byte(test.clearData))
+		c.Assert(err, IsNil)
+		verified, err := test.policy.VerifyAnySignature(test.pubKeys, sigs, body)
+		if test.relerror != "" {
+			c.Assert(err, ErrorMatches, test.relerror)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(verified.String(), Equals, test.verified)
+	}
+}
+
+var policyValidateTests = []struct {
+	policy   *pgputil.Policy
+	relerror string
+}{{
+	policy: pgputil.DefaultPolicy,
+}, {
+	policy: &pgputil.Policy{KeyAlgorithms: []string{"rsa", "dsa", "ecdsa"}},
+}, {
+	policy:   &pgputil.Policy{MinKeySize: -1},
+	relerror: "invalid minimum key size: -1",
+}, {
+	policy:   &pgputil.Policy{Hashes: []string{"sha256", "sha3"}},
+	relerror: `unknown hash algorithm: "sha3"`,
+}, {
+	policy:   &pgputil.Policy{KeyAlgorithms: []string{"RSA"}},
+	relerror: `unknown key algorithm: "RSA"`,
+}}
+
+func (s *S) TestPolicyValidate(c *C) {
+	for _, test := range policyValidateTests {
+		err := test.policy.Validate()
+		if test.relerror != "" {
+			c.Assert(err, ErrorMatches, test.relerror)
+		} else {
+			c.Assert(err, IsNil)
+		}
+	}
+}
+
+// clearSignedWithSHA1 is signed with key 7CCCE4F7ACAEC40C using SHA-1.
+const clearSignedWithSHA1 = `
+-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA1
+
+foo
+-----BEGIN PGP SIGNATURE-----
+
+iQE+BAEBAgAoFiEEEmgWenlYovJJS0XSfMzk96yuxAwFAl4MicAKHGRhdGVkQGtl
+eQAKCRB8zOT3rK7EDDsMB/4q84C0IKQ3cGFvrfGV32PM+xbMhNaihlzW8voLHbIt
+/8Nd0pKL6n/jbDhm2Uab6dxbP55CdxcXrbbEmhQlusftHTzdywpZObJzhK6nPXyD
+8qn7GNhDIO74FJ699rV6LnoHr0vINrJspHK5+J2/4wps6Cy91SIKXDbONfG0LjXr
+L2WXVkn8+HsgfL2j/Kx/HA9+Ph0lZS4RAuhtEeNCr1O/Uud7wQkSg4VrIb4etfZg
+YorBHCt+afaz82somnd69naZbKb8YeGDQgZqAy6boGh66emf74zrk4MSYCcMDhc8
+is48YsE6f8hyvT1MEMQF/+JgfKGIXUHXpdtCXi9R2kIC
+=LQoD
+-----END PGP SIGNATURE-----
+`
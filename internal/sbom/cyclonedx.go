@@ -0,0 +1,146 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/canonical/chisel/public/manifest"
+)
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     cdxTools      `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string         `json:"type"`
+	BOMRef     string         `json:"bom-ref,omitempty"`
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	PURL       string         `json:"purl,omitempty"`
+	Hashes     []cdxHash      `json:"hashes,omitempty"`
+	Properties []cdxProperty  `json:"properties,omitempty"`
+	Components []cdxComponent `json:"components,omitempty"`
+
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// WriteCycloneDX writes to w a CycloneDX 1.5 document in JSON describing the
+// content of mfest. Packages are listed with their package URL, their
+// homepage when recorded in the manifest, and their slices as
+// sub-components, while files refer to the slices they belong to with the
+// "chisel:slice" property.
+func WriteCycloneDX(w io.Writer, mfest *manifest.Manifest, options *Options) error {
+	b, err := readBOM(mfest, options)
+	if err != nil {
+		return err
+	}
+	doc := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + options.UUID,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: options.Created.UTC().Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []cdxComponent{{
+					Type:    "application",
+					Name:    "chisel",
+					Version: options.ToolVersion,
+				}},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+	if options.Name != "" {
+		doc.Metadata.Component = &cdxComponent{
+			Type: "container",
+			Name: options.Name,
+		}
+	}
+
+	for _, bp := range b.packages {
+		component := cdxComponent{
+			Type:    "library",
+			BOMRef:  bp.purl,
+			Name:    bp.pkg.Name,
+			Version: bp.pkg.Version,
+			PURL:    bp.purl,
+			Hashes: []cdxHash{{
+				Alg:     "SHA-256",
+				Content: bp.pkg.Digest,
+			}},
+		}
+		if bp.pkg.Homepage != "" {
+			component.ExternalReferences = []cdxExternalReference{{
+				Type: "website",
+				URL:  bp.pkg.Homepage,
+			}}
+		}
+		for _, name := range bp.slices {
+			component.Components = append(component.Components, cdxComponent{
+				Type:   "library",
+				BOMRef: "slice:" + name,
+				Name:   name,
+			})
+		}
+		doc.Components = append(doc.Components, component)
+	}
+	for _, file := range b.files {
+		component := cdxComponent{
+			Type:   "file",
+			BOMRef: "file:" + file.path,
+			Name:   file.path,
+			Hashes: []cdxHash{{
+				Alg:     "SHA-256",
+				Content: file.sha256,
+			}},
+		}
+		for _, name := range file.slices {
+			component.Properties = append(component.Properties, cdxProperty{
+				Name:  "chisel:slice",
+				Value: name,
+			})
+		}
+		doc.Components = append(doc.Components, component)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("cannot write CycloneDX document: %w", err)
+	}
+	return nil
+}
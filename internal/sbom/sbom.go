@@ -0,0 +1,154 @@
+// Package sbom converts the manifest of a chiselled tree into a software
+// bill of materials, in the SPDX or CycloneDX formats.
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+type Options struct {
+	// Name identifies the tree described, such as an image name.
+	Name string
+	// UUID uniquely identifies the document.
+	UUID string
+	// Created is recorded as the time the document was created.
+	Created time.Time
+	// ToolVersion is the version of chisel creating the document.
+	ToolVersion string
+	// Distro names the release the packages come from, as in
+	// "ubuntu-22.04", and is added to their package URLs when set. The
+	// manifest does not record it, but scanners need it to match packages
+	// against the advisories of the release.
+	Distro string
+}
+
+type bomPackage struct {
+	pkg    *manifest.Package
+	purl   string
+	slices []string
+}
+
+type bomFile struct {
+	path   string
+	sha256 string
+	slices []string
+}
+
+// bom holds the content of a manifest relevant to the documents.
+type bom struct {
+	packages []*bomPackage
+	files    []*bomFile
+}
+
+// readBOM collects the packages, slices, and regular files of mfest. Files
+// without a digest, such as the manifest itself, are left out.
+func readBOM(mfest *manifest.Manifest, options *Options) (*bom, error) {
+	b := &bom{}
+	err := mfest.IteratePackages(func(pkg *manifest.Package) error {
+		b.packages = append(b.packages, &bomPackage{pkg: pkg, purl: purl(pkg, options.Distro)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type sliceRef struct {
+		name string
+		key  setup.SliceKey
+		arch string
+	}
+	var sliceRefs []sliceRef
+	foreignArchs := make(map[string]bool)
+	err = mfest.IterateSlices("", func(slice *manifest.Slice) error {
+		key, arch, err := setup.ParseQualifiedSliceName(slice.Name)
+		if err != nil {
+			return err
+		}
+		sliceRefs = append(sliceRefs, sliceRef{slice.Name, key, arch})
+		if arch != "" {
+			foreignArchs[arch] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range sliceRefs {
+		// Slices without an architecture belong to the package of the main
+		// architecture.
+		name, pkgName, arch := ref.name, ref.key.Package, ref.arch
+		var owner *bomPackage
+		for _, bp := range b.packages {
+			if bp.pkg.Name != pkgName {
+				continue
+			}
+			if arch != "" && bp.pkg.Arch != arch && bp.pkg.Arch != "all" {
+				continue
+			}
+			if arch == "" && foreignArchs[bp.pkg.Arch] {
+				continue
+			}
+			owner = bp
+			break
+		}
+		if owner == nil {
+			pkgRef := pkgName
+			if arch != "" {
+				pkgRef += ":" + arch
+			}
+			return nil, fmt.Errorf("slice %s refers to missing package %q", name, pkgRef)
+		}
+		owner.slices = append(owner.slices, name)
+	}
+
+	err = mfest.IteratePaths("", func(path *manifest.Path) error {
+		// Directories, symlinks, and generated files have no digest.
+		if path.SHA256 == "" {
+			return nil
+		}
+		digest := path.SHA256
+		if path.FinalSHA256 != "" {
+			digest = path.FinalSHA256
+		}
+		b.files = append(b.files, &bomFile{
+			path:   path.Path,
+			sha256: digest,
+			slices: slices.Clone(path.Slices),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// purl returns the package URL of a Debian package from the Ubuntu archive,
+// as in "pkg:deb/ubuntu/libc6@2.35-0ubuntu3.8?arch=amd64&upstream=glibc".
+// The distribution, as in "distro=ubuntu-22.04", is only named when set,
+// and the source package when known and different from the package itself.
+func purl(pkg *manifest.Package, distro string) string {
+	purl := fmt.Sprintf("pkg:deb/ubuntu/%s@%s?arch=%s", url.QueryEscape(pkg.Name), url.QueryEscape(pkg.Version), url.QueryEscape(pkg.Arch))
+	if distro != "" {
+		purl += "&distro=" + url.QueryEscape(distro)
+	}
+	// The source may be followed by its version, as in "glibc (2.35-0ubuntu3)".
+	if source, _, _ := strings.Cut(pkg.Source, " "); source != "" && source != pkg.Name {
+		purl += "&upstream=" + url.QueryEscape(source)
+	}
+	return purl
+}
+
+func toolName(options *Options) string {
+	if options.ToolVersion == "" {
+		return "chisel"
+	}
+	return "chisel-" + options.ToolVersion
+}
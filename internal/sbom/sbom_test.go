@@ -0,0 +1,175 @@
+package sbom_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/sbom"
+	"github.com/canonical/chisel/public/jsonwall"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+var sbomManifest = []any{
+	&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64"},
+	&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash2", Arch: "i386"},
+	&manifest.Package{Kind: "package", Name: "pkg2+extra", Version: "1:2.0", Digest: "hash3", Arch: "all", Source: "pkg2-src (2.0)", Homepage: "https://example.com/pkg2"},
+	&manifest.Slice{Kind: "slice", Name: "pkg1:i386_libs"},
+	&manifest.Slice{Kind: "slice", Name: "pkg1_libs"},
+	&manifest.Slice{Kind: "slice", Name: "pkg2+extra_bins"},
+	&manifest.Path{Kind: "path", Path: "/dir/", Mode: "0755", Slices: []string{"pkg1_libs"}},
+	&manifest.Path{Kind: "path", Path: "/dir/file", Mode: "0644", Slices: []string{"pkg1_libs"}, SHA256: "sha1"},
+	&manifest.Path{Kind: "path", Path: "/dir/file-i386", Mode: "0644", Slices: []string{"pkg1:i386_libs"}, SHA256: "sha2"},
+	&manifest.Path{Kind: "path", Path: "/link", Mode: "0777", Slices: []string{"pkg1_libs"}, Link: "/dir/file"},
+	&manifest.Path{Kind: "path", Path: "/manifest.wall", Mode: "0644", Slices: []string{"pkg1_libs"}},
+	&manifest.Path{Kind: "path", Path: "/mutated", Mode: "0644", Slices: []string{"pkg1_libs", "pkg2+extra_bins"}, SHA256: "sha3", FinalSHA256: "sha4"},
+}
+
+var sbomOptions = &sbom.Options{
+	Name:        "test-image",
+	UUID:        "f81d4fae-7dec-41d0-a765-00a0c91e6bf6",
+	Created:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	ToolVersion: "1.0",
+}
+
+const expectedSPDX = `
+{
+	"spdxVersion": "SPDX-2.3",
+	"dataLicense": "CC0-1.0",
+	"SPDXID": "SPDXRef-DOCUMENT",
+	"name": "test-image",
+	"documentNamespace": "https://github.com/canonical/chisel/spdx/test-image-f81d4fae-7dec-41d0-a765-00a0c91e6bf6",
+	"creationInfo": {"created": "2024-03-01T12:00:00Z", "creators": ["Tool: chisel-1.0"]},
+	"packages": [
+		{"SPDXID": "SPDXRef-Package-1", "name": "pkg1", "versionInfo": "v1", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "checksums": [{"algorithm": "SHA256", "checksumValue": "hash1"}], "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/ubuntu/pkg1@v1?arch=amd64"}]},
+		{"SPDXID": "SPDXRef-Slice-1", "name": "pkg1_libs", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "comment": "Chisel slice of package pkg1"},
+		{"SPDXID": "SPDXRef-Package-2", "name": "pkg1", "versionInfo": "v1", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "checksums": [{"algorithm": "SHA256", "checksumValue": "hash2"}], "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/ubuntu/pkg1@v1?arch=i386"}]},
+		{"SPDXID": "SPDXRef-Slice-2", "name": "pkg1:i386_libs", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "comment": "Chisel slice of package pkg1"},
+		{"SPDXID": "SPDXRef-Package-3", "name": "pkg2+extra", "versionInfo": "1:2.0", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "homepage": "https://example.com/pkg2", "sourceInfo": "built package from: pkg2-src (2.0)", "checksums": [{"algorithm": "SHA256", "checksumValue": "hash3"}], "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/ubuntu/pkg2%2Bextra@1%3A2.0?arch=all&upstream=pkg2-src"}]},
+		{"SPDXID": "SPDXRef-Slice-3", "name": "pkg2+extra_bins", "downloadLocation": "NOASSERTION", "filesAnalyzed": false, "comment": "Chisel slice of package pkg2+extra"}
+	],
+	"files": [
+		{"SPDXID": "SPDXRef-File-1", "fileName": "/dir/file", "checksums": [{"algorithm": "SHA256", "checksumValue": "sha1"}]},
+		{"SPDXID": "SPDXRef-File-2", "fileName": "/dir/file-i386", "checksums": [{"algorithm": "SHA256", "checksumValue": "sha2"}]},
+		{"SPDXID": "SPDXRef-File-3", "fileName": "/mutated", "checksums": [{"algorithm": "SHA256", "checksumValue": "sha4"}]}
+	],
+	"relationships": [
+		{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-1"},
+		{"spdxElementId": "SPDXRef-Package-1", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-1"},
+		{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-2"},
+		{"spdxElementId": "SPDXRef-Package-2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-2"},
+		{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-3"},
+		{"spdxElementId": "SPDXRef-Package-3", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Slice-3"},
+		{"spdxElementId": "SPDXRef-Slice-1", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-1"},
+		{"spdxElementId": "SPDXRef-Slice-2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-2"},
+		{"spdxElementId": "SPDXRef-Slice-1", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-3"},
+		{"spdxElementId": "SPDXRef-Slice-3", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-File-3"}
+	]
+}
+`
+
+func (s *S) TestWriteSPDX(c *C) {
+	var buf bytes.Buffer
+	err := sbom.WriteSPDX(&buf, makeManifest(c, sbomManifest), sbomOptions)
+	c.Assert(err, IsNil)
+	assertJSON(c, buf.Bytes(), expectedSPDX)
+}
+
+const expectedCycloneDX = `
+{
+	"bomFormat": "CycloneDX",
+	"specVersion": "1.5",
+	"serialNumber": "urn:uuid:f81d4fae-7dec-41d0-a765-00a0c91e6bf6",
+	"version": 1,
+	"metadata": {"timestamp": "2024-03-01T12:00:00Z", "tools": {"components": [{"type": "application", "name": "chisel", "version": "1.0"}]}, "component": {"type": "container", "name": "test-image"}},
+	"components": [
+		{"type": "library", "bom-ref": "pkg:deb/ubuntu/pkg1@v1?arch=amd64", "name": "pkg1", "version": "v1", "purl": "pkg:deb/ubuntu/pkg1@v1?arch=amd64", "hashes": [{"alg": "SHA-256", "content": "hash1"}], "components": [{"type": "library", "bom-ref": "slice:pkg1_libs", "name": "pkg1_libs"}]},
+		{"type": "library", "bom-ref": "pkg:deb/ubuntu/pkg1@v1?arch=i386", "name": "pkg1", "version": "v1", "purl": "pkg:deb/ubuntu/pkg1@v1?arch=i386", "hashes": [{"alg": "SHA-256", "content": "hash2"}], "components": [{"type": "library", "bom-ref": "slice:pkg1:i386_libs", "name": "pkg1:i386_libs"}]},
+		{"type": "library", "bom-ref": "pkg:deb/ubuntu/pkg2%2Bextra@1%3A2.0?arch=all&upstream=pkg2-src", "name": "pkg2+extra", "version": "1:2.0", "purl": "pkg:deb/ubuntu/pkg2%2Bextra@1%3A2.0?arch=all&upstream=pkg2-src", "hashes": [{"alg": "SHA-256", "content": "hash3"}], "components": [{"type": "library", "bom-ref": "slice:pkg2+extra_bins", "name": "pkg2+extra_bins"}], "externalReferences": [{"type": "website", "url": "https://example.com/pkg2"}]},
+		{"type": "file", "bom-ref": "file:/dir/file", "name": "/dir/file", "hashes": [{"alg": "SHA-256", "content": "sha1"}], "properties": [{"name": "chisel:slice", "value": "pkg1_libs"}]},
+		{"type": "file", "bom-ref": "file:/dir/file-i386", "name": "/dir/file-i386", "hashes": [{"alg": "SHA-256", "content": "sha2"}], "properties": [{"name": "chisel:slice", "value": "pkg1:i386_libs"}]},
+		{"type": "file", "bom-ref": "file:/mutated", "name": "/mutated", "hashes": [{"alg": "SHA-256", "content": "sha4"}], "properties": [{"name": "chisel:slice", "value": "pkg1_libs"}, {"name": "chisel:slice", "value": "pkg2+extra_bins"}]}
+	]
+}
+`
+
+func (s *S) TestWriteCycloneDX(c *C) {
+	var buf bytes.Buffer
+	err := sbom.WriteCycloneDX(&buf, makeManifest(c, sbomManifest), sbomOptions)
+	c.Assert(err, IsNil)
+	assertJSON(c, buf.Bytes(), expectedCycloneDX)
+}
+
+func (s *S) TestDistroAndPathName(c *C) {
+	mfest := makeManifest(c, []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64", Source: "pkg1-src"},
+	})
+	options := *sbomOptions
+	options.Name = "out/chisel.wall"
+	options.Distro = "ubuntu-22.04"
+
+	var buf bytes.Buffer
+	err := sbom.WriteSPDX(&buf, mfest, &options)
+	c.Assert(err, IsNil)
+	var spdx struct {
+		DocumentNamespace string `json:"documentNamespace"`
+		Packages          []struct {
+			ExternalRefs []struct {
+				ReferenceLocator string `json:"referenceLocator"`
+			} `json:"externalRefs"`
+		} `json:"packages"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &spdx)
+	c.Assert(err, IsNil)
+	c.Assert(spdx.DocumentNamespace, Equals, "https://github.com/canonical/chisel/spdx/out%2Fchisel.wall-f81d4fae-7dec-41d0-a765-00a0c91e6bf6")
+	c.Assert(spdx.Packages[0].ExternalRefs[0].ReferenceLocator, Equals, "pkg:deb/ubuntu/pkg1@v1?arch=amd64&distro=ubuntu-22.04&upstream=pkg1-src")
+
+	buf.Reset()
+	err = sbom.WriteCycloneDX(&buf, mfest, &options)
+	c.Assert(err, IsNil)
+	var cdx struct {
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &cdx)
+	c.Assert(err, IsNil)
+	c.Assert(cdx.Components[0].PURL, Equals, "pkg:deb/ubuntu/pkg1@v1?arch=amd64&distro=ubuntu-22.04&upstream=pkg1-src")
+}
+
+func (s *S) TestMissingPackage(c *C) {
+	mfest := makeManifest(c, []any{
+		&manifest.Package{Kind: "package", Name: "pkg1", Version: "v1", Digest: "hash1", Arch: "amd64"},
+		&manifest.Slice{Kind: "slice", Name: "pkg1:i386_libs"},
+	})
+	var buf bytes.Buffer
+	err := sbom.WriteSPDX(&buf, mfest, sbomOptions)
+	c.Assert(err, ErrorMatches, `slice pkg1:i386_libs refers to missing package "pkg1:i386"`)
+}
+
+// assertJSON checks that data holds the same JSON value as expected,
+// regardless of formatting.
+func assertJSON(c *C, data []byte, expected string) {
+	var obtainedValue, expectedValue any
+	err := json.Unmarshal(data, &obtainedValue)
+	c.Assert(err, IsNil)
+	err = json.Unmarshal([]byte(expected), &expectedValue)
+	c.Assert(err, IsNil)
+	c.Assert(obtainedValue, DeepEquals, expectedValue)
+}
+
+func makeManifest(c *C, values []any) *manifest.Manifest {
+	dbw := jsonwall.NewDBWriter(&jsonwall.DBWriterOptions{Schema: manifest.Schema})
+	for _, value := range values {
+		err := dbw.Add(value)
+		c.Assert(err, IsNil)
+	}
+	var buffer bytes.Buffer
+	_, err := dbw.WriteTo(&buffer)
+	c.Assert(err, IsNil)
+	mfest, err := manifest.Read(&buffer)
+	c.Assert(err, IsNil)
+	return mfest
+}
@@ -0,0 +1,163 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/canonical/chisel/public/manifest"
+)
+
+// spdxNamespace is the base of the unique URI identifying each document.
+const spdxNamespace = "https://github.com/canonical/chisel/spdx/"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Homepage         string            `json:"homepage,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxFile struct {
+	SPDXID    string         `json:"SPDXID"`
+	FileName  string         `json:"fileName"`
+	Checksums []spdxChecksum `json:"checksums"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// WriteSPDX writes to w an SPDX 2.3 document in JSON describing the content
+// of mfest. Packages are listed with their package URL and, when recorded
+// in the manifest, their homepage and source package. Slices are listed as
+// packages contained in them, and files as contained in their slices. Only
+// the SHA256 digests of files are known from the manifest.
+func WriteSPDX(w io.Writer, mfest *manifest.Manifest, options *Options) error {
+	b, err := readBOM(mfest, options)
+	if err != nil {
+		return err
+	}
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              options.Name,
+		DocumentNamespace: spdxNamespace + url.PathEscape(options.Name) + "-" + options.UUID,
+		CreationInfo: spdxCreationInfo{
+			Created:  options.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName(options)},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+	relate := func(element, kind, related string) {
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      element,
+			RelationshipType:   kind,
+			RelatedSPDXElement: related,
+		})
+	}
+
+	// Identifiers are numbered as names may hold characters not allowed in
+	// them, such as "+" and "_".
+	sliceIDs := make(map[string]string)
+	for i, bp := range b.packages {
+		pkgID := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		var sourceInfo string
+		if bp.pkg.Source != "" {
+			sourceInfo = "built package from: " + bp.pkg.Source
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           pkgID,
+			Name:             bp.pkg.Name,
+			VersionInfo:      bp.pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			Homepage:         bp.pkg.Homepage,
+			SourceInfo:       sourceInfo,
+			Checksums: []spdxChecksum{{
+				Algorithm:     "SHA256",
+				ChecksumValue: bp.pkg.Digest,
+			}},
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  bp.purl,
+			}},
+		})
+		relate("SPDXRef-DOCUMENT", "DESCRIBES", pkgID)
+		for _, name := range bp.slices {
+			sliceID := fmt.Sprintf("SPDXRef-Slice-%d", len(sliceIDs)+1)
+			sliceIDs[name] = sliceID
+			doc.Packages = append(doc.Packages, spdxPackage{
+				SPDXID:           sliceID,
+				Name:             name,
+				DownloadLocation: "NOASSERTION",
+				Comment:          fmt.Sprintf("Chisel slice of package %s", bp.pkg.Name),
+			})
+			relate(pkgID, "CONTAINS", sliceID)
+		}
+	}
+	for i, file := range b.files {
+		fileID := fmt.Sprintf("SPDXRef-File-%d", i+1)
+		doc.Files = append(doc.Files, spdxFile{
+			SPDXID:   fileID,
+			FileName: file.path,
+			Checksums: []spdxChecksum{{
+				Algorithm:     "SHA256",
+				ChecksumValue: file.sha256,
+			}},
+		})
+		for _, name := range file.slices {
+			if sliceID, ok := sliceIDs[name]; ok {
+				relate(sliceID, "CONTAINS", fileID)
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("cannot write SPDX document: %w", err)
+	}
+	return nil
+}
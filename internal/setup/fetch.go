@@ -15,23 +15,21 @@ import (
 
 	"github.com/canonical/chisel/internal/cache"
 	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/httputil"
 )
 
 type FetchOptions struct {
 	Label    string
 	Version  string
 	CacheDir string
-}
-
-var bulkClient = &http.Client{
-	Timeout: 5 * time.Minute,
+	// Offline is set to use the release previously stored in the cache
+	// without consulting the release repository.
+	Offline bool
 }
 
 const baseURL = "https://codeload.github.com/canonical/chisel-releases/tar.gz/refs/heads/"
 
 func FetchRelease(options *FetchOptions) (*Release, error) {
-	logf("Consulting release repository...")
-
 	cacheDir := options.CacheDir
 	if cacheDir == "" {
 		cacheDir = cache.DefaultDir("chisel")
@@ -51,20 +49,61 @@ func FetchRelease(options *FetchOptions) (*Release, error) {
 	}
 
 	tagName := filepath.Join(dirName, ".etag")
+	if options.Offline {
+		_, err := os.Stat(filepath.Join(dirName, "chisel.yaml"))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no cached information for %s-%s release", options.Label, options.Version)
+		} else if err != nil {
+			return nil, err
+		}
+		logf("Using cached %s-%s release.", options.Label, options.Version)
+	} else {
+		err := updateRelease(options, dirName, tagName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := ReadRelease(dirName)
+	if err != nil {
+		return nil, err
+	}
+	// Use the directory mtime as last use time.
+	now := time.Now()
+	if err := os.Chtimes(dirName, now, now); err != nil && !os.IsPermission(err) {
+		return nil, fmt.Errorf("cannot update cached release timestamp: %v", err)
+	}
 	tagData, err := os.ReadFile(tagName)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
+	release.ETag = string(tagData)
+	return release, nil
+}
+
+// updateRelease refreshes the release cached in dirName from the release
+// repository, unless the cached content is still current.
+func updateRelease(options *FetchOptions, dirName, tagName string) error {
+	logf("Consulting release repository...")
+
+	tagData, err := os.ReadFile(tagName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
 	req, err := http.NewRequest("GET", baseURL+options.Label+"-"+options.Version, nil)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create request for release information: %w", err)
+		return fmt.Errorf("cannot create request for release information: %w", err)
 	}
 	req.Header.Add("If-None-Match", string(tagData))
 
-	resp, err := bulkClient.Do(req)
+	client, err := httputil.NewClient(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot talk to release repository: %w", err)
+		return fmt.Errorf("cannot talk to release repository: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -75,9 +114,9 @@ func FetchRelease(options *FetchOptions) (*Release, error) {
 	case 304:
 		cacheIsValid = true
 	case 401, 404:
-		return nil, fmt.Errorf("no information for %s-%s release", options.Label, options.Version)
+		return fmt.Errorf("no information for %s-%s release", options.Label, options.Version)
 	default:
-		return nil, fmt.Errorf("error from release repository: %v", resp.Status)
+		return fmt.Errorf("error from release repository: %v", resp.Status)
 	}
 
 	if cacheIsValid {
@@ -86,26 +125,92 @@ func FetchRelease(options *FetchOptions) (*Release, error) {
 		logf("Fetching current %s-%s release...", options.Label, options.Version)
 		if !strings.Contains(dirName, "/releases/") {
 			// Better safe than sorry.
-			return nil, fmt.Errorf("internal error: will not remove something unexpected: %s", dirName)
+			return fmt.Errorf("internal error: will not remove something unexpected: %s", dirName)
 		}
 		err = os.RemoveAll(dirName)
 		if err != nil {
-			return nil, fmt.Errorf("cannot remove previously cached release: %w", err)
+			return fmt.Errorf("cannot remove previously cached release: %w", err)
 		}
 		err = extractTarGz(resp.Body, dirName)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		tag := resp.Header.Get("ETag")
 		if tag != "" {
 			err := os.WriteFile(tagName, []byte(tag), 0644)
 			if err != nil {
-				return nil, fmt.Errorf("cannot write remote release tag file: %v", err)
+				return fmt.Errorf("cannot write remote release tag file: %v", err)
 			}
 		}
 	}
+	return nil
+}
+
+// CachedReleases returns the names of the releases cached in cacheDir by
+// FetchRelease, in the "<label>-<version>" form.
+func CachedReleases(cacheDir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(cacheDir, "releases"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot list cached releases: %v", err)
+	}
+	var names []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(cacheDir, "releases", dirEntry.Name(), "chisel.yaml"))
+		if err == nil {
+			names = append(names, dirEntry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ExpireReleases removes the releases cached in cacheDir by FetchRelease
+// which were not used within the timeout, along with the leftovers of
+// fetches that did not complete. It returns the names of the directories
+// removed.
+func ExpireReleases(cacheDir string, timeout time.Duration) ([]string, error) {
+	releasesDir := filepath.Join(cacheDir, "releases")
+	dirEntries, err := os.ReadDir(releasesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot list cached releases: %v", err)
+	}
 
-	return ReadRelease(dirName)
+	lockFile := fslock.New(filepath.Join(releasesDir, ".lock"))
+	err = lockFile.LockWithTimeout(10 * time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock cached releases: %w", err)
+	}
+	defer lockFile.Unlock()
+
+	expired := time.Now().Add(-timeout)
+	var removed []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		dirName := filepath.Join(releasesDir, dirEntry.Name())
+		finfo, err := os.Stat(dirName)
+		if err != nil {
+			return removed, fmt.Errorf("cannot stat cached release: %v", err)
+		}
+		_, err = os.Stat(filepath.Join(dirName, "chisel.yaml"))
+		complete := err == nil
+		if complete && finfo.ModTime().After(expired) {
+			continue
+		}
+		err = os.RemoveAll(dirName)
+		if err != nil {
+			return removed, fmt.Errorf("cannot remove cached release: %v", err)
+		}
+		removed = append(removed, dirEntry.Name())
+	}
+	return removed, nil
 }
 
 func extractTarGz(dataReader io.Reader, targetDir string) error {
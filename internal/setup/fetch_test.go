@@ -5,8 +5,10 @@ import (
 
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/testutil"
 )
 
 // TODO Implement local test server instead of using live repository.
@@ -48,3 +50,72 @@ func (s *S) TestFetch(c *C) {
 		}
 	}
 }
+
+func (s *S) TestFetchOffline(c *C) {
+	options := &setup.FetchOptions{
+		Label:    "ubuntu",
+		Version:  "22.04",
+		CacheDir: c.MkDir(),
+		Offline:  true,
+	}
+
+	_, err := setup.FetchRelease(options)
+	c.Assert(err, ErrorMatches, `no cached information for ubuntu-22.04 release`)
+
+	releaseDir := filepath.Join(options.CacheDir, "releases", "ubuntu-22.04")
+	err = os.WriteFile(filepath.Join(releaseDir, "chisel.yaml"), testutil.Reindent(testutil.DefaultChiselYaml), 0644)
+	c.Assert(err, IsNil)
+	err = os.Mkdir(filepath.Join(releaseDir, "slices"), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(releaseDir, ".etag"), []byte(`"abc"`), 0644)
+	c.Assert(err, IsNil)
+
+	release, err := setup.FetchRelease(options)
+	c.Assert(err, IsNil)
+	c.Assert(release.Path, Equals, releaseDir)
+	c.Assert(release.ETag, Equals, `"abc"`)
+	c.Assert(release.Archives["ubuntu"].Version, Equals, "22.04")
+}
+
+func (s *S) TestExpireReleases(c *C) {
+	cacheDir := c.MkDir()
+	now := time.Now()
+	for _, name := range []string{"ubuntu-22.04", "ubuntu-24.04", "ubuntu-24.10"} {
+		releaseDir := filepath.Join(cacheDir, "releases", name)
+		err := os.MkdirAll(releaseDir, 0755)
+		c.Assert(err, IsNil)
+		if name == "ubuntu-24.10" {
+			// Left behind by a failed fetch.
+			continue
+		}
+		err = os.WriteFile(filepath.Join(releaseDir, "chisel.yaml"), nil, 0644)
+		c.Assert(err, IsNil)
+	}
+	old := now.Add(-48 * time.Hour)
+	err := os.Chtimes(filepath.Join(cacheDir, "releases", "ubuntu-22.04"), old, old)
+	c.Assert(err, IsNil)
+
+	names, err := setup.CachedReleases(cacheDir)
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"ubuntu-22.04", "ubuntu-24.04"})
+
+	removed, err := setup.ExpireReleases(cacheDir, 24*time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(removed, DeepEquals, []string{"ubuntu-22.04", "ubuntu-24.10"})
+
+	names, err = setup.CachedReleases(cacheDir)
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"ubuntu-24.04"})
+
+	removed, err = setup.ExpireReleases(cacheDir, 0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, DeepEquals, []string{"ubuntu-24.04"})
+
+	// Nothing cached.
+	names, err = setup.CachedReleases(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(names, HasLen, 0)
+	removed, err = setup.ExpireReleases(c.MkDir(), 0)
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 0)
+}
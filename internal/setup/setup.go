@@ -9,10 +9,9 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/openpgp/packet"
-
 	"github.com/canonical/chisel/internal/apacheutil"
 	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/pgputil"
 	"github.com/canonical/chisel/internal/strdist"
 )
 
@@ -24,6 +23,9 @@ type Release struct {
 	Packages    map[string]*Package
 	Archives    map[string]*Archive
 	Maintenance *Maintenance
+	// ETag identifies the revision of a release fetched from the release
+	// repository. It is empty for releases read from a local directory.
+	ETag string
 }
 
 type Maintenance struct {
@@ -41,12 +43,30 @@ type Archive struct {
 	Components []string
 	Priority   int
 	Pro        string
-	PubKeys    []*packet.PublicKey
+	PubKeys    []*pgputil.PublicKey
 	// Maintained is set when the archive is still being updated.
 	Maintained bool
 	// OldRelease is set for Ubuntu releases which are moved from the regular
 	// archive which happens after the release's end of life date.
 	OldRelease bool
+	// Dir is set when the archive is served from a local directory instead
+	// of the network. Relative paths are resolved against the release
+	// directory.
+	Dir string
+	// URL and PortsURL replace the default location of the archive, such
+	// as with a mirror. PortsURL is used for architectures other than
+	// amd64 and i386 when set.
+	URL      string
+	PortsURL string
+	// ReleaseLabel is the Label expected in the archive InRelease file,
+	// which allows using archives other than the Ubuntu ones.
+	ReleaseLabel string
+	// Snapshot pins the archive to its state at the given timestamp, so
+	// that the same package versions are always selected.
+	Snapshot string
+	// SignaturePolicy restricts the algorithms accepted when verifying the
+	// archive signatures. The default policy is used if nil.
+	SignaturePolicy *pgputil.Policy
 }
 
 // Package holds a collection of slices that represent parts of themselves.
@@ -99,8 +119,9 @@ const (
 type GenerateKind string
 
 const (
-	GenerateNone     GenerateKind = ""
-	GenerateManifest GenerateKind = "manifest"
+	GenerateNone       GenerateKind = ""
+	GenerateManifest   GenerateKind = "manifest"
+	GenerateDpkgStatus GenerateKind = "dpkg-status"
 )
 
 type PathInfo struct {
@@ -135,6 +156,20 @@ func ParseSliceKey(sliceKey string) (SliceKey, error) {
 
 func (s *Slice) String() string { return s.Package + "_" + s.Name }
 
+// ParseQualifiedSliceName parses the name of a slice as recorded in the
+// manifest, where the package of a slice of a foreign architecture is
+// qualified with that architecture, as in "libc6:i386_libs". The returned
+// architecture is empty for the slices of the main architecture.
+func ParseQualifiedSliceName(name string) (key SliceKey, arch string, err error) {
+	pkgRef, sliceName, _ := strings.Cut(name, "_")
+	pkgName, arch, qualified := strings.Cut(pkgRef, ":")
+	key, err = ParseSliceKey(pkgName + "_" + sliceName)
+	if err != nil || qualified && arch == "" {
+		return SliceKey{}, "", fmt.Errorf("invalid slice reference: %q", name)
+	}
+	return key, arch, nil
+}
+
 // Selection holds the required configuration to create a Build for a selection
 // of slices from a Release. It's still an abstract proposal in the sense that
 // the real information coming from packages is still unknown, so referenced
@@ -142,6 +177,8 @@ func (s *Slice) String() string { return s.Package + "_" + s.Name }
 type Selection struct {
 	Release *Release
 	Slices  []*Slice
+	// Arch is the architecture the slices were selected for.
+	Arch string
 }
 
 // Prefers uses the prefer relationships and returns a map from each path to
@@ -480,6 +517,7 @@ func Select(release *Release, slices []SliceKey, arch string) (*Selection, error
 
 	selection := &Selection{
 		Release: release,
+		Arch:    arch,
 	}
 
 	sorted, err := order(release.Packages, slices, arch)
@@ -496,7 +534,7 @@ func Select(release *Release, slices []SliceKey, arch string) (*Selection, error
 			// An invalid "generate" value should only throw an error if that
 			// particular slice is selected. Hence, the check is here.
 			switch newInfo.Generate {
-			case GenerateNone, GenerateManifest:
+			case GenerateNone, GenerateManifest, GenerateDpkgStatus:
 			default:
 				return nil, fmt.Errorf("slice %s has invalid 'generate' for path %s: %q",
 					new, newPath, newInfo.Generate)
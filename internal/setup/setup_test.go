@@ -6,11 +6,11 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/openpgp/packet"
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
 
 	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/pgputil"
 	"github.com/canonical/chisel/internal/setup"
 	"github.com/canonical/chisel/internal/testutil"
 )
@@ -86,7 +86,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy", "jammy-security"},
 				Components: []string{"main", "other"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -102,6 +102,397 @@ var setupTests = []setupTest{{
 			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
 		},
 	},
+}, {
+	summary: "Archive with local directory",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			maintenance:
+				standard: 2025-01-01
+				end-of-life: 2100-01-01
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					public-keys: [test-key]
+					dir: /srv/mirror
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "other"},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
+				Maintained: true,
+				Dir:        "/srv/mirror",
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name:   "mypkg",
+				Path:   "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+}, {
+	summary: "Archive with mirror URLs",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			maintenance:
+				standard: 2025-01-01
+				end-of-life: 2100-01-01
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					public-keys: [test-key]
+					url: https://mirror.example.com/ubuntu/
+					ports-url: https://mirror.example.com/ubuntu-ports/
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "other"},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
+				Maintained: true,
+				URL:        "https://mirror.example.com/ubuntu/",
+				PortsURL:   "https://mirror.example.com/ubuntu-ports/",
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name:   "mypkg",
+				Path:   "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+}, {
+	summary: "Archive with invalid URL",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					public-keys: [test-key]
+					url: ftp://mirror.example.com/ubuntu/
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid URL: "ftp://mirror.example.com/ubuntu/"`,
+}, {
+	summary: "Archive with ports-url but no url",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main, other]
+					suites: [jammy]
+					public-keys: [test-key]
+					ports-url: http://mirror.example.com/ubuntu-ports/
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has ports-url field without url`,
+}, {
+	summary: "Archive with custom label",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			maintenance:
+				standard: 2025-01-01
+				end-of-life: 2100-01-01
+			archives:
+				debian:
+					version: 12
+					components: [main]
+					suites: [bookworm]
+					public-keys: [test-key]
+					url: http://deb.debian.org/debian/
+					label: Debian
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"debian": {
+				Name:         "debian",
+				Version:      "12",
+				Suites:       []string{"bookworm"},
+				Components:   []string{"main"},
+				PubKeys:      []*pgputil.PublicKey{testKey.PubKey},
+				Maintained:   true,
+				URL:          "http://deb.debian.org/debian/",
+				ReleaseLabel: "Debian",
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name:   "mypkg",
+				Path:   "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+}, {
+	summary: "Archive with custom label requires url",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				debian:
+					version: 12
+					components: [main]
+					suites: [bookworm]
+					public-keys: [test-key]
+					label: Debian
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "debian" with label "Debian" missing url field`,
+}, {
+	summary: "Archive cannot have both pro and label",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				debian:
+					version: 12
+					components: [main]
+					suites: [bookworm]
+					public-keys: [test-key]
+					label: Debian
+					pro: fips
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "debian" cannot have both pro and label fields`,
+}, {
+	summary: "Archive with snapshot",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			maintenance:
+				standard: 2025-01-01
+				end-of-life: 2100-01-01
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					public-keys: [test-key]
+					snapshot: 20240301T120000Z
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main"},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
+				Maintained: true,
+				Snapshot:   "20240301T120000Z",
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name:   "mypkg",
+				Path:   "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+}, {
+	summary: "Archive with invalid snapshot",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					public-keys: [test-key]
+					snapshot: 2024-03-01
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid snapshot: "2024-03-01"`,
+}, {
+	summary: "Pro archive with snapshot",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					public-keys: [test-key]
+					snapshot: 20240301T120000Z
+					pro: fips
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" cannot have snapshot with pro or dir fields`,
+}, {
+	summary: "Archive with signature policy",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			maintenance:
+				standard: 2025-01-01
+				end-of-life: 2100-01-01
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					public-keys: [test-key]
+					signature-policy:
+						min-key-size: 4096
+						key-algorithms: [rsa]
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main"},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
+				Maintained: true,
+				SignaturePolicy: &pgputil.Policy{
+					MinKeySize:    4096,
+					Hashes:        pgputil.DefaultPolicy.Hashes,
+					KeyAlgorithms: []string{"rsa"},
+				},
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name:   "mypkg",
+				Path:   "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+}, {
+	summary: "Archive with invalid signature policy",
+	input: map[string]string{
+		"chisel.yaml": `
+			format: v1
+			archives:
+				ubuntu:
+					version: 22.04
+					components: [main]
+					suites: [jammy]
+					public-keys: [test-key]
+					signature-policy:
+						hashes: [sha256, md4]
+			public-keys:
+				test-key:
+					id: ` + testKey.ID + `
+					armor: |` + "\n" + testutil.PrefixEachLine(testKey.PubKeyArmor, "\t\t\t\t\t\t") + `
+		`,
+	},
+	relerror: `chisel.yaml: archive "ubuntu" has invalid signature-policy: unknown hash algorithm: "md4"`,
 }, {
 	summary: "Coverage of multiple path kinds",
 	input: map[string]string{
@@ -133,7 +524,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -198,7 +589,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -263,7 +654,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"focal"},
 				Components: []string{"main"},
 				Priority:   10,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: false,
 				OldRelease: true,
 			},
@@ -320,7 +711,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"focal"},
 				Components: []string{"main"},
 				Priority:   1,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: false,
 				OldRelease: true,
 			},
@@ -576,7 +967,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -794,7 +1185,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -837,7 +1228,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -881,7 +1272,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -945,7 +1336,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
 				Priority:   20,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"bar": {
@@ -954,7 +1345,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"universe"},
 				Priority:   -10,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1160,7 +1551,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy", "jammy-security"},
 				Components: []string{"main", "other"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1226,7 +1617,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
 				Priority:   20,
-				PubKeys:    []*packet.PublicKey{extraTestKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{extraTestKey.PubKey},
 				Maintained: true,
 			},
 			"bar": {
@@ -1235,7 +1626,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"universe"},
 				Priority:   10,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey, extraTestKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey, extraTestKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1348,7 +1739,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1459,7 +1850,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1532,7 +1923,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1715,7 +2106,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1749,6 +2140,59 @@ var setupTests = []setupTest{{
 			},
 		}},
 	},
+}, {
+	summary: "Specify generate: dpkg-status",
+	input: map[string]string{
+		"slices/mydir/mypkg.yaml": `
+			package: mypkg
+			slices:
+				myslice:
+					contents:
+						/dir/**: {generate: "dpkg-status"}
+		`,
+	},
+	release: &setup.Release{
+		Format: "v1",
+		Archives: map[string]*setup.Archive{
+			"ubuntu": {
+				Name:       "ubuntu",
+				Version:    "22.04",
+				Suites:     []string{"jammy"},
+				Components: []string{"main", "universe"},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
+				Maintained: true,
+			},
+		},
+		Packages: map[string]*setup.Package{
+			"mypkg": {
+				Name: "mypkg",
+				Path: "slices/mydir/mypkg.yaml",
+				Slices: map[string]*setup.Slice{
+					"myslice": {
+						Package: "mypkg",
+						Name:    "myslice",
+						Contents: map[string]setup.PathInfo{
+							"/dir/**": {Kind: "generate", Generate: "dpkg-status"},
+						},
+					},
+				},
+			},
+		},
+		Maintenance: &setup.Maintenance{
+			Standard:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			EndOfLife: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	},
+	selslices: []setup.SliceKey{{"mypkg", "myslice"}},
+	selection: &setup.Selection{
+		Slices: []*setup.Slice{{
+			Package: "mypkg",
+			Name:    "myslice",
+			Contents: map[string]setup.PathInfo{
+				"/dir/**": {Kind: "generate", Generate: "dpkg-status"},
+			},
+		}},
+	},
 }, {
 	summary: "Can specify generate with bogus value but cannot select those slices",
 	input: map[string]string{
@@ -1768,7 +2212,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -1863,7 +2307,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -2015,7 +2459,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 				Priority:   1,
 			},
@@ -2024,7 +2468,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 				Priority:   -2,
 			},
@@ -2033,7 +2477,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 				Priority:   -3,
 			},
@@ -2120,7 +2564,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"focal"},
 				Components: []string{"main"},
 				Priority:   10,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"fips": {
@@ -2130,7 +2574,7 @@ var setupTests = []setupTest{{
 				Components: []string{"main"},
 				Pro:        "fips",
 				Priority:   20,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"fips-updates": {
@@ -2140,7 +2584,7 @@ var setupTests = []setupTest{{
 				Components: []string{"main"},
 				Pro:        "fips-updates",
 				Priority:   21,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"esm-apps": {
@@ -2150,7 +2594,7 @@ var setupTests = []setupTest{{
 				Components: []string{"main"},
 				Pro:        "esm-apps",
 				Priority:   16,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"esm-infra": {
@@ -2160,7 +2604,7 @@ var setupTests = []setupTest{{
 				Components: []string{"main"},
 				Pro:        "esm-infra",
 				Priority:   15,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -2217,7 +2661,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 				Priority:   10,
 			},
@@ -2226,7 +2670,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 				Priority:   20,
 			},
@@ -2312,7 +2756,7 @@ var setupTests = []setupTest{{
 				Suites:     []string{"focal"},
 				Components: []string{"main"},
 				Priority:   10,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 			"fips": {
@@ -2322,7 +2766,7 @@ var setupTests = []setupTest{{
 				Components: []string{"main"},
 				Pro:        "fips",
 				Priority:   20,
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -2448,7 +2892,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -2882,7 +3326,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: false,
 				OldRelease: true,
 			},
@@ -2932,7 +3376,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: false,
 				OldRelease: true,
 			},
@@ -3080,7 +3524,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   3,
 				Maintained: true,
 				OldRelease: false,
@@ -3091,7 +3535,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-apps-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   2,
 				Maintained: true,
 			},
@@ -3101,7 +3545,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-infra-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   1,
 				Maintained: true,
 			},
@@ -3111,7 +3555,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   20,
 				Maintained: true,
 			},
@@ -3121,7 +3565,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   21,
 				Maintained: true,
 			},
@@ -3202,7 +3646,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   3,
 				Maintained: false,
 				OldRelease: false,
@@ -3213,7 +3657,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-apps-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   2,
 				Maintained: true,
 			},
@@ -3223,7 +3667,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-infra-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   1,
 				Maintained: true,
 			},
@@ -3233,7 +3677,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   20,
 				Maintained: true,
 			},
@@ -3243,7 +3687,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   21,
 				Maintained: true,
 			},
@@ -3324,7 +3768,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   3,
 				Maintained: false,
 				OldRelease: false,
@@ -3335,7 +3779,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-apps-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   2,
 				Maintained: false,
 			},
@@ -3345,7 +3789,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-infra-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   1,
 				Maintained: false,
 			},
@@ -3355,7 +3799,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   20,
 				Maintained: true,
 			},
@@ -3365,7 +3809,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   21,
 				Maintained: true,
 			},
@@ -3446,7 +3890,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   3,
 				Maintained: false,
 				OldRelease: true,
@@ -3457,7 +3901,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-apps-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   2,
 				Maintained: false,
 			},
@@ -3467,7 +3911,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-infra-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   1,
 				Maintained: false,
 			},
@@ -3477,7 +3921,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   20,
 				Maintained: false,
 			},
@@ -3487,7 +3931,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   21,
 				Maintained: false,
 			},
@@ -3566,7 +4010,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   3,
 				Maintained: true,
 				OldRelease: false,
@@ -3577,7 +4021,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-apps-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   2,
 				Maintained: true,
 			},
@@ -3587,7 +4031,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-infra-security"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   1,
 				Maintained: true,
 			},
@@ -3597,7 +4041,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   20,
 				Maintained: true,
 			},
@@ -3607,7 +4051,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy-updates"},
 				Components: []string{"main"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Priority:   21,
 				Maintained: true,
 			},
@@ -3651,7 +4095,7 @@ var setupTests = []setupTest{{
 				Version:    "22.04",
 				Suites:     []string{"jammy"},
 				Components: []string{"main", "universe"},
-				PubKeys:    []*packet.PublicKey{testKey.PubKey},
+				PubKeys:    []*pgputil.PublicKey{testKey.PubKey},
 				Maintained: true,
 			},
 		},
@@ -4037,7 +4481,9 @@ func runParseReleaseTests(c *C, tests []setupTest) {
 				prefers[path] = pkg.Name
 			}
 			c.Assert(prefers, DeepEquals, test.prefers)
+			c.Assert(selection.Arch, Equals, "amd64")
 			selection.Release = nil
+			selection.Arch = ""
 			if test.selection != nil {
 				c.Assert(selection, DeepEquals, test.selection)
 			}
@@ -4409,3 +4855,62 @@ func oldEssentialToV3(c *C, input []byte) (out string, skip bool) {
 	// Maintenance dates get marshaled as <date>T00:00:00Z by default.
 	return strings.ReplaceAll(string(bs), "T00:00:00Z", ""), false
 }
+
+func (s *S) TestArchiveRelativeDir(c *C) {
+	chiselYAML := strings.Replace(string(testutil.DefaultChiselYaml),
+		"suites: [jammy]", "suites: [jammy]\n\t\t\tdir: mirror", 1)
+	input := map[string]string{
+		"chisel.yaml":             chiselYAML,
+		"slices/mydir/mypkg.yaml": "package: mypkg\n",
+	}
+
+	dir := c.MkDir()
+	for path, data := range input {
+		fpath := filepath.Join(dir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0o644)
+		c.Assert(err, IsNil)
+	}
+
+	release, err := setup.ReadRelease(dir)
+	c.Assert(err, IsNil)
+	c.Assert(release.Archives["ubuntu"].Dir, Equals, filepath.Join(dir, "mirror"))
+}
+
+var parseQualifiedSliceNameTests = []struct {
+	name string
+	key  setup.SliceKey
+	arch string
+	err  string
+}{{
+	name: "libc6_libs",
+	key:  setup.SliceKey{Package: "libc6", Slice: "libs"},
+}, {
+	name: "libc6:i386_libs",
+	key:  setup.SliceKey{Package: "libc6", Slice: "libs"},
+	arch: "i386",
+}, {
+	name: "libc6:_libs",
+	err:  `invalid slice reference: "libc6:_libs"`,
+}, {
+	name: "libc6:i386_libs-",
+	err:  `invalid slice reference: "libc6:i386_libs-"`,
+}, {
+	name: "libc6",
+	err:  `invalid slice reference: "libc6"`,
+}}
+
+func (s *S) TestParseQualifiedSliceName(c *C) {
+	for _, test := range parseQualifiedSliceNameTests {
+		c.Logf("Name: %s", test.name)
+		key, arch, err := setup.ParseQualifiedSliceName(test.name)
+		if test.err != "" {
+			c.Assert(err, ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(key, DeepEquals, test.key)
+		c.Assert(arch, Equals, test.arch)
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/url"
 	"path"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 	"unicode"
 
-	"golang.org/x/crypto/openpgp/packet"
 	"gopkg.in/yaml.v3"
 
 	"github.com/canonical/chisel/internal/apacheutil"
@@ -50,6 +51,20 @@ type yamlArchive struct {
 	Pro        string   `yaml:"pro"`
 	Default    bool     `yaml:"default"`
 	PubKeys    []string `yaml:"public-keys"`
+	Dir        string   `yaml:"dir"`
+	URL        string   `yaml:"url"`
+	PortsURL   string   `yaml:"ports-url"`
+	Label      string   `yaml:"label"`
+	Snapshot   string   `yaml:"snapshot"`
+	// SignaturePolicy restricts the algorithms accepted when verifying
+	// the archive. Unset fields keep the defaults.
+	SignaturePolicy *yamlSignaturePolicy `yaml:"signature-policy"`
+}
+
+type yamlSignaturePolicy struct {
+	MinKeySize    *int     `yaml:"min-key-size"`
+	Hashes        []string `yaml:"hashes"`
+	KeyAlgorithms []string `yaml:"key-algorithms"`
 }
 
 type yamlPackage struct {
@@ -268,7 +283,7 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 	}
 
 	// Decode the public keys and match against provided IDs.
-	pubKeys := make(map[string]*packet.PublicKey, len(yamlVar.PubKeys))
+	pubKeys := make(map[string]*pgputil.PublicKey, len(yamlVar.PubKeys))
 	for keyName, yamlPubKey := range yamlVar.PubKeys {
 		key, err := pgputil.DecodePubKey([]byte(yamlPubKey.Armor))
 		if err != nil {
@@ -331,7 +346,7 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 		if len(details.PubKeys) == 0 {
 			return nil, fmt.Errorf("%s: archive %q missing public-keys field", fileName, archiveName)
 		}
-		var archiveKeys []*packet.PublicKey
+		var archiveKeys []*pgputil.PublicKey
 		for _, keyName := range details.PubKeys {
 			key, ok := pubKeys[keyName]
 			if !ok {
@@ -354,14 +369,76 @@ func parseRelease(baseDir, filePath string, data []byte) (*Release, error) {
 			}
 		}
 
+		if details.PortsURL != "" && details.URL == "" {
+			return nil, fmt.Errorf("%s: archive %q has ports-url field without url", fileName, archiveName)
+		}
+		for _, archiveURL := range []string{details.URL, details.PortsURL} {
+			if archiveURL == "" {
+				continue
+			}
+			u, err := url.Parse(archiveURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("%s: archive %q has invalid URL: %q", fileName, archiveName, archiveURL)
+			}
+		}
+
+		if details.Label != "" && details.Pro != "" {
+			return nil, fmt.Errorf("%s: archive %q cannot have both pro and label fields", fileName, archiveName)
+		}
+		if details.Label != "" && details.Label != "Ubuntu" && details.URL == "" && details.Dir == "" {
+			return nil, fmt.Errorf("%s: archive %q with label %q missing url field", fileName, archiveName, details.Label)
+		}
+
+		if details.Snapshot != "" {
+			if _, err := time.Parse(archive.SnapshotFormat, details.Snapshot); err != nil {
+				return nil, fmt.Errorf("%s: archive %q has invalid snapshot: %q", fileName, archiveName, details.Snapshot)
+			}
+			if details.Pro != "" || details.Dir != "" {
+				return nil, fmt.Errorf("%s: archive %q cannot have snapshot with pro or dir fields", fileName, archiveName)
+			}
+		}
+
+		var policy *pgputil.Policy
+		if details.SignaturePolicy != nil {
+			yamlPolicy := details.SignaturePolicy
+			policy = &pgputil.Policy{
+				MinKeySize:    pgputil.DefaultPolicy.MinKeySize,
+				Hashes:        pgputil.DefaultPolicy.Hashes,
+				KeyAlgorithms: pgputil.DefaultPolicy.KeyAlgorithms,
+			}
+			if yamlPolicy.MinKeySize != nil {
+				policy.MinKeySize = *yamlPolicy.MinKeySize
+			}
+			if yamlPolicy.Hashes != nil {
+				policy.Hashes = yamlPolicy.Hashes
+			}
+			if yamlPolicy.KeyAlgorithms != nil {
+				policy.KeyAlgorithms = yamlPolicy.KeyAlgorithms
+			}
+			if err := policy.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: archive %q has invalid signature-policy: %v", fileName, archiveName, err)
+			}
+		}
+
+		archiveDir := details.Dir
+		if archiveDir != "" && !filepath.IsAbs(archiveDir) {
+			archiveDir = filepath.Join(baseDir, archiveDir)
+		}
+
 		release.Archives[archiveName] = &Archive{
-			Name:       archiveName,
-			Version:    details.Version,
-			Suites:     details.Suites,
-			Components: details.Components,
-			Pro:        details.Pro,
-			Priority:   priority,
-			PubKeys:    archiveKeys,
+			Name:            archiveName,
+			Version:         details.Version,
+			Suites:          details.Suites,
+			Components:      details.Components,
+			Pro:             details.Pro,
+			Priority:        priority,
+			PubKeys:         archiveKeys,
+			Dir:             archiveDir,
+			URL:             details.URL,
+			PortsURL:        details.PortsURL,
+			ReleaseLabel:    details.Label,
+			Snapshot:        details.Snapshot,
+			SignaturePolicy: policy,
 		}
 	}
 	if (hasPriority && archiveNoPriority != "") ||
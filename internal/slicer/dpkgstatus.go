@@ -0,0 +1,150 @@
+package slicer
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/deb"
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/internal/setup"
+)
+
+const dpkgStatusMode fs.FileMode = 0644
+
+// dpkgStatusDirs finds the paths marked with "generate: dpkg-status" and
+// returns a map from the status directory to all the slices that declare it.
+func dpkgStatusDirs(slices []*setup.Slice) map[string][]*setup.Slice {
+	statusSlices := make(map[string][]*setup.Slice)
+	for _, slice := range slices {
+		for path, info := range slice.Contents {
+			if info.Generate == setup.GenerateDpkgStatus {
+				dir := strings.TrimSuffix(path, "**")
+				statusSlices[dir] = append(statusSlices[dir], slice)
+			}
+		}
+	}
+	return statusSlices
+}
+
+// inDpkgStatusDir returns whether relPath is an entry of one of the status
+// directories.
+func inDpkgStatusDir(statusDirs map[string][]*setup.Slice, relPath string) bool {
+	for dir := range statusDirs {
+		if strings.HasPrefix(relPath, dir) && relPath != dir {
+			return true
+		}
+	}
+	return false
+}
+
+// generateDpkgStatus writes into every status directory one file per package,
+// in the format of the dpkg status database, so that tools inspecting the
+// root find the packages it holds. Each file holds the control stanza of the
+// package for every architecture installed. The stanzas of packages not
+// fetched in this cut are kept from the files written previously.
+func generateDpkgStatus(targetDir string, selection []*setup.Slice, report *manifestutil.Report,
+	pkgInfos []*archive.PackageInfo, controls map[string]*deb.PackageControl, installed *installedRoot) error {
+	statusDirs := dpkgStatusDirs(selection)
+	if len(statusDirs) == 0 {
+		// Nothing to do.
+		return nil
+	}
+	byName := make(map[string][]*archive.PackageInfo)
+	for _, info := range pkgInfos {
+		byName[info.Name] = append(byName[info.Name], info)
+	}
+	for _, dir := range slices.Sorted(maps.Keys(statusDirs)) {
+		logf("Generating dpkg status at %s...", dir)
+		written := make(map[string]bool)
+		for _, name := range slices.Sorted(maps.Keys(byName)) {
+			relPath := filepath.Join(dir, name)
+			existing, err := os.ReadFile(filepath.Join(targetDir, relPath))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("cannot read dpkg status %s: %w", relPath, err)
+			}
+			var stanzas []string
+			for _, info := range byName[name] {
+				var stanza string
+				if pkgControl, ok := controls[info.Name+":"+info.Arch]; ok {
+					stanza = statusStanza(pkgControl.Control)
+				} else {
+					stanza = findStanza(string(existing), info.Arch)
+				}
+				if stanza == "" {
+					logf("Warning: No control data for package %s, writing minimal dpkg status", info.Name)
+					stanza = fmt.Sprintf("Package: %s\nStatus: install ok installed\nVersion: %s\nArchitecture: %s\n",
+						info.Name, info.Version, info.Arch)
+				}
+				stanzas = append(stanzas, stanza)
+			}
+			entry, err := fsutil.Create(&fsutil.CreateOptions{
+				Root:         targetDir,
+				Path:         relPath,
+				Mode:         dpkgStatusMode,
+				Data:         bytes.NewBufferString(strings.Join(stanzas, "\n")),
+				MakeParents:  true,
+				OverrideMode: true,
+			})
+			if err != nil {
+				return err
+			}
+			for _, slice := range statusDirs[dir] {
+				err := report.Add(slice, entry)
+				if err != nil {
+					return err
+				}
+			}
+			written[relPath] = true
+		}
+		// Drop the files of packages no longer installed.
+		if installed == nil {
+			continue
+		}
+		for _, relPath := range slices.Sorted(maps.Keys(installed.paths)) {
+			if !strings.HasPrefix(relPath, dir) || relPath == dir || written[relPath] {
+				continue
+			}
+			err := removePath(targetDir, relPath, installed.paths[relPath])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// statusStanza returns the stanza of the status database for the package
+// described in control, which is the control stanza with the status field
+// added after the package name.
+func statusStanza(control string) string {
+	control = strings.TrimRight(control, "\n") + "\n"
+	const status = "Status: install ok installed\n"
+	if !strings.HasPrefix(control, "Package:") {
+		return status + control
+	}
+	first, rest, _ := strings.Cut(control, "\n")
+	return first + "\n" + status + rest
+}
+
+// findStanza returns the stanza for the given architecture in the content
+// of a status file, or the empty string if it is not found.
+func findStanza(content string, arch string) string {
+	for _, stanza := range strings.Split(content, "\n\n") {
+		stanza = strings.Trim(stanza, "\n")
+		for _, line := range strings.Split(stanza, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if ok && key == "Architecture" && strings.TrimSpace(value) == arch {
+				return stanza + "\n"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package slicer_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var testPackageControl = []testutil.TarEntry{
+	testutil.Dir(0755, "./"),
+	testutil.Reg(0644, "./control", `Package: test-package
+Version: version
+Architecture: amd64
+Description: Test package
+`),
+}
+
+var otherPackageControl = []testutil.TarEntry{
+	testutil.Dir(0755, "./"),
+	testutil.Reg(0644, "./control", `Package: other-package
+Version: version
+Architecture: all
+Description: Other package
+`),
+}
+
+const testPackageStatus = `Package: test-package
+Status: install ok installed
+Version: version
+Architecture: amd64
+Description: Test package
+`
+
+const otherPackageStatus = `Package: other-package
+Status: install ok installed
+Version: version
+Architecture: all
+Description: Other package
+`
+
+var dpkgStatusTests = []struct {
+	summary string
+	cuts    [][]setup.SliceKey
+	remove  []string
+	noData  bool
+	status  map[string]string
+	error   string
+}{{
+	summary: "Status for every package",
+	cuts: [][]setup.SliceKey{{
+		{"test-package", "myslice"},
+		{"other-package", "myslice"},
+	}},
+	status: map[string]string{
+		"/var/lib/dpkg/status.d/other-package": otherPackageStatus,
+		"/var/lib/dpkg/status.d/test-package":  testPackageStatus,
+	},
+}, {
+	summary: "Status of packages installed previously is kept",
+	cuts: [][]setup.SliceKey{{
+		{"test-package", "myslice"},
+	}, {
+		{"other-package", "myslice"},
+	}},
+	status: map[string]string{
+		"/var/lib/dpkg/status.d/other-package": otherPackageStatus,
+		"/var/lib/dpkg/status.d/test-package":  testPackageStatus,
+	},
+}, {
+	summary: "Status of removed packages is dropped",
+	cuts: [][]setup.SliceKey{{
+		{"test-package", "myslice"},
+		{"other-package", "myslice"},
+	}},
+	remove: []string{"other-package_myslice"},
+	status: map[string]string{
+		"/var/lib/dpkg/status.d/test-package": testPackageStatus,
+	},
+}, {
+	summary: "Packages must have control data",
+	cuts: [][]setup.SliceKey{{
+		{"test-package", "myslice"},
+	}},
+	noData: true,
+	error:  `package "test-package": cannot read package control: no control payload`,
+}}
+
+func (s *S) TestRunDpkgStatus(c *C) {
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					essential:
+						- test-package_status
+					contents:
+						/dir/file:
+				status:
+					essential:
+						- test-package_manifest
+					contents:
+						/var/lib/dpkg/status.d/**: {generate: dpkg-status}
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					essential:
+						- test-package_status
+					contents:
+						/file:
+		`,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	for _, test := range dpkgStatusTests {
+		c.Logf("Summary: %s", test.summary)
+
+		testData := testutil.MustMakeDebWithControl(testPackageControl, testutil.TestPackageEntries)
+		otherData := testutil.MustMakeDebWithControl(otherPackageControl, testutil.OtherPackageEntries)
+		if test.noData {
+			testData = testutil.PackageData["test-package"]
+			otherData = testutil.PackageData["other-package"]
+		}
+		archives := map[string]archive.Archive{}
+		for name, setupArchive := range release.Archives {
+			archives[name] = &testutil.TestArchive{
+				Opts: archive.Options{
+					Label:      setupArchive.Name,
+					Version:    setupArchive.Version,
+					Suites:     setupArchive.Suites,
+					Components: setupArchive.Components,
+					Arch:       "amd64",
+				},
+				Packages: map[string]*testutil.TestPackage{
+					"test-package": {
+						Name:    "test-package",
+						Version: "version",
+						Arch:    "amd64",
+						Hash:    "hash",
+						Data:    testData,
+					},
+					"other-package": {
+						Name:    "other-package",
+						Version: "version",
+						Arch:    "all",
+						Hash:    "hash",
+						Data:    otherData,
+					},
+				},
+			}
+		}
+
+		targetDir := c.MkDir()
+		for _, sliceKeys := range test.cuts {
+			selection, err := setup.Select(release, sliceKeys, "amd64")
+			c.Assert(err, IsNil)
+			err = slicer.Run(&slicer.RunOptions{
+				Selection: selection,
+				Archives:  archives,
+				TargetDir: targetDir,
+			})
+			if test.error != "" {
+				c.Assert(err, ErrorMatches, test.error)
+				break
+			}
+			c.Assert(err, IsNil)
+		}
+		if test.error != "" {
+			continue
+		}
+		if test.remove != nil {
+			err := slicer.Remove(&slicer.RemoveOptions{
+				Release:   release,
+				TargetDir: targetDir,
+				Slices:    test.remove,
+			})
+			c.Assert(err, IsNil)
+		}
+
+		statusDir := "/var/lib/dpkg/status.d/"
+		entries, err := os.ReadDir(filepath.Join(targetDir, statusDir))
+		c.Assert(err, IsNil)
+		status := make(map[string]string)
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(targetDir, statusDir, entry.Name()))
+			c.Assert(err, IsNil)
+			status[statusDir+entry.Name()] = string(data)
+		}
+		c.Assert(status, DeepEquals, test.status)
+
+		// The status files are listed in the manifest.
+		mfest := readManifest(c, targetDir, "/chisel-data/manifest.wall")
+		pathsDump, err := treeDumpManifestPaths(mfest)
+		c.Assert(err, IsNil)
+		for relPath := range pathsDump {
+			if !strings.HasPrefix(relPath, statusDir) {
+				delete(pathsDump, relPath)
+			}
+		}
+		c.Assert(pathsDump, HasLen, len(test.status))
+		for relPath := range test.status {
+			c.Assert(pathsDump[relPath], Matches, `file 0644 [0-9a-f]{8} \{test-package_status\}`)
+		}
+	}
+}
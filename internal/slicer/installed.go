@@ -0,0 +1,396 @@
+package slicer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/canonical/chisel/internal/archive"
+	"github.com/canonical/chisel/internal/fsutil"
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+// installedRoot holds the content recorded in the manifest left by a
+// previous cut into the same root.
+type installedRoot struct {
+	packages map[string][]*manifest.Package
+	slices   map[string]bool
+	paths    map[string]*manifest.Path
+	// forgotten holds the paths that only forgotten slices referred to,
+	// pending deletion.
+	forgotten map[string]*manifest.Path
+}
+
+// FindManifest reads the manifest left by a previous cut into rootDir,
+// looking for it at every manifest location defined in the release. It
+// returns the manifest along with its location, or a nil manifest if none
+// is found.
+func FindManifest(rootDir string, release *setup.Release) (*manifest.Manifest, string, error) {
+	var releaseSlices []*setup.Slice
+	for _, pkg := range release.Packages {
+		for _, slice := range pkg.Slices {
+			releaseSlices = append(releaseSlices, slice)
+		}
+	}
+	manifestPaths := slices.Sorted(maps.Keys(manifestutil.FindPaths(releaseSlices)))
+	for _, relPath := range manifestPaths {
+		mfest, err := manifestutil.ReadFile(filepath.Join(rootDir, relPath))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read installed manifest %s: %w", relPath, err)
+		}
+		return mfest, relPath, nil
+	}
+	return nil, "", nil
+}
+
+// readInstalled reads the content installed by a previous cut into rootDir,
+// returning nil if no manifest is found.
+func readInstalled(rootDir string, release *setup.Release) (*installedRoot, error) {
+	mfest, relPath, err := FindManifest(rootDir, release)
+	if err != nil || mfest == nil {
+		return nil, err
+	}
+	logf("Found installed content listed at %s...", relPath)
+	installed := &installedRoot{
+		packages: make(map[string][]*manifest.Package),
+		slices:   make(map[string]bool),
+		paths:    make(map[string]*manifest.Path),
+	}
+	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+		installed.packages[pkg.Name] = append(installed.packages[pkg.Name], pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IterateSlices("", func(slice *manifest.Slice) error {
+		installed.slices[slice.Name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mfest.IteratePaths("", func(path *manifest.Path) error {
+		installed.paths[path.Path] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+// skipInstalled removes from the run the slices that are already installed,
+// and then checks that the packages of the slices left are the same ones
+// installed. Packages only referred to by installed slices are not checked,
+// as nothing more is extracted from them.
+func (r *installedRoot) skipInstalled(run *archRun, pins map[string]string) error {
+	var selected, reported []*setup.Slice
+	for i, slice := range run.selection.Slices {
+		if r.slices[run.reported[i].String()] {
+			continue
+		}
+		selected = append(selected, slice)
+		reported = append(reported, run.reported[i])
+	}
+	run.selection = &setup.Selection{
+		Release: run.selection.Release,
+		Slices:  selected,
+		Arch:    run.selection.Arch,
+	}
+	run.reported = reported
+
+	for _, pkgName := range selectionPackages(run.selection) {
+		installedPkgs := r.packages[pkgName]
+		if len(installedPkgs) == 0 {
+			continue
+		}
+		info, err := run.pkgArchive[pkgName].Info(pkgName, pins[pkgName])
+		if err != nil {
+			return err
+		}
+		for _, pkg := range installedPkgs {
+			if pkg.Arch != info.Arch {
+				continue
+			}
+			if pkg.Version != info.Version {
+				return fmt.Errorf("package %q is installed at version %s, cannot cut version %s", pkgName, pkg.Version, info.Version)
+			}
+			if pkg.Digest != info.SHA256 {
+				return fmt.Errorf("package %q version %s does not match the installed one", pkgName, pkg.Version)
+			}
+		}
+	}
+	return nil
+}
+
+// forget drops the given slices from the installed content, recording the
+// paths that only those slices referred to for deletion.
+func (r *installedRoot) forget(names map[string]bool) {
+	if r.forgotten == nil {
+		r.forgotten = make(map[string]*manifest.Path)
+	}
+	for name := range names {
+		delete(r.slices, name)
+	}
+	for relPath, path := range r.paths {
+		var pathSlices []string
+		for _, name := range path.Slices {
+			if !names[name] {
+				pathSlices = append(pathSlices, name)
+			}
+		}
+		if len(pathSlices) > 0 {
+			path.Slices = pathSlices
+			continue
+		}
+		delete(r.paths, relPath)
+		r.forgotten[relPath] = path
+	}
+}
+
+// deleteForgotten deletes from rootDir the paths recorded by forget, except
+// for files modified since they were installed. Directories left empty,
+// including parents not listed in the manifest, are deleted as well.
+func (r *installedRoot) deleteForgotten(rootDir string) error {
+	if r == nil {
+		return nil
+	}
+	dirs := make(map[string]bool)
+	for _, relPath := range slices.Sorted(maps.Keys(r.forgotten)) {
+		for dir := filepath.Dir(strings.TrimSuffix(relPath, "/")); dir != "/"; dir = filepath.Dir(dir) {
+			if _, ok := r.paths[dir+"/"]; ok {
+				break
+			}
+			dirs[dir+"/"] = true
+		}
+		if strings.HasSuffix(relPath, "/") {
+			dirs[relPath] = true
+			continue
+		}
+		err := removePath(rootDir, relPath, r.forgotten[relPath])
+		if err != nil {
+			return err
+		}
+	}
+	r.forgotten = nil
+	var sortedDirs []string
+	for dir := range dirs {
+		if _, ok := r.paths[dir]; !ok {
+			sortedDirs = append(sortedDirs, dir)
+		}
+	}
+	// Order the directories so the deepest ones appear first.
+	sort.Sort(sort.Reverse(sort.StringSlice(sortedDirs)))
+	for _, dir := range sortedDirs {
+		err := os.Remove(filepath.Join(rootDir, dir))
+		// The non-empty directory error is caught by IsExist as well.
+		if err != nil && !os.IsExist(err) && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove directory %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// manifestSlices returns the slices to list in the new manifest, which are
+// the ones selected in this cut followed by the ones installed previously.
+func (r *installedRoot) manifestSlices(release *setup.Release, selected []*setup.Slice) []*setup.Slice {
+	if r == nil {
+		return selected
+	}
+	known := make(map[string]bool)
+	for _, slice := range selected {
+		known[slice.String()] = true
+	}
+	result := slices.Clone(selected)
+	for _, name := range slices.Sorted(maps.Keys(r.slices)) {
+		if known[name] {
+			continue
+		}
+		// The names were validated when reading the manifest.
+		key, arch, _ := setup.ParseQualifiedSliceName(name)
+		pkgRef := key.Package
+		if arch != "" {
+			pkgRef += ":" + arch
+		}
+		slice := &setup.Slice{Package: pkgRef, Name: key.Slice}
+		if pkg, ok := release.Packages[key.Package]; ok {
+			if releaseSlice, ok := pkg.Slices[key.Slice]; ok {
+				slice = new(setup.Slice)
+				*slice = *releaseSlice
+				slice.Package = pkgRef
+			}
+		}
+		result = append(result, slice)
+	}
+	return result
+}
+
+// essentialNames returns the sorted names of the slices that slice depends
+// on, as listed in the manifest. Slices of foreign architectures also depend
+// on slices of that architecture.
+func essentialNames(slice *setup.Slice) []string {
+	_, arch, _ := strings.Cut(slice.Package, ":")
+	var names []string
+	for key := range slice.Essential {
+		name := key.String()
+		if arch != "" {
+			name = key.Package + ":" + arch + "_" + key.Slice
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addToReport adds the installed paths to the report, attributed to the
+// given slices, except for the manifests and the dpkg status files which are
+// generated again.
+func (r *installedRoot) addToReport(report *manifestutil.Report, manifestSlices []*setup.Slice) error {
+	if r == nil {
+		return nil
+	}
+	bySliceName := make(map[string]*setup.Slice)
+	for _, slice := range manifestSlices {
+		bySliceName[slice.String()] = slice
+	}
+	manifestPaths := manifestutil.FindPaths(manifestSlices)
+	statusDirs := dpkgStatusDirs(manifestSlices)
+	for relPath, path := range r.paths {
+		if _, ok := manifestPaths[relPath]; ok || inDpkgStatusDir(statusDirs, relPath) {
+			continue
+		}
+		var pathSlices []*setup.Slice
+		for _, name := range path.Slices {
+			pathSlices = append(pathSlices, bySliceName[name])
+		}
+		err := report.AddManifestPath(path, pathSlices)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPackages returns the package information to list in the new manifest,
+// which includes the installed packages that were not fetched again.
+func (r *installedRoot) addPackages(pkgInfos []*archive.PackageInfo) []*archive.PackageInfo {
+	if r == nil {
+		return pkgInfos
+	}
+	fetched := make(map[string]bool)
+	for _, info := range pkgInfos {
+		fetched[info.Name+":"+info.Arch] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.packages)) {
+		for _, pkg := range r.packages[name] {
+			if fetched[pkg.Name+":"+pkg.Arch] {
+				continue
+			}
+			pkgInfos = append(pkgInfos, &archive.PackageInfo{
+				Name:          pkg.Name,
+				Version:       pkg.Version,
+				Arch:          pkg.Arch,
+				SHA256:        pkg.Digest,
+				Source:        pkg.Source,
+				InstalledSize: pkg.InstalledSize,
+				Depends:       pkg.Depends,
+				Homepage:      pkg.Homepage,
+			})
+		}
+	}
+	return pkgInfos
+}
+
+// create creates the filesystem entry described by o, unless the same
+// content was installed at the path by a previous cut, in which case the
+// existing entry is returned untouched so that mutations are preserved. It
+// fails if the path holds different content, or content not created by
+// chisel. Forgotten content is replaced and no longer deleted later.
+func (r *installedRoot) create(o *fsutil.CreateOptions) (*fsutil.Entry, error) {
+	if r == nil {
+		return fsutil.Create(o)
+	}
+	path := filepath.Join(o.Root, o.Path)
+	relPath := filepath.Clean("/" + o.Path)
+	if o.Mode.IsDir() {
+		relPath += "/"
+	}
+	if forgottenPath, ok := r.forgotten[relPath]; ok {
+		// Content being replaced is overwritten, unless it was modified.
+		modified, err := pathModified(o.Root, relPath, forgottenPath)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			return nil, fmt.Errorf("cannot create %s: path exists and was modified since installed", relPath)
+		}
+		delete(r.forgotten, relPath)
+		if !o.Mode.IsDir() {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		return fsutil.Create(o)
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) || (err == nil && info.IsDir() && o.Mode.IsDir()) {
+		return fsutil.Create(o)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	installedPath, ok := r.paths[relPath]
+	if !ok {
+		return nil, fmt.Errorf("cannot create %s: path exists and was not created by chisel", relPath)
+	}
+	if manifestutil.FormatMode(o.Mode) != installedPath.Mode {
+		return nil, fmt.Errorf("cannot create %s: path differs from installed content", relPath)
+	}
+	entry := &fsutil.Entry{
+		Path: path,
+		Mode: o.Mode,
+		Link: o.Link,
+	}
+	switch {
+	case o.Mode.IsRegular() && o.Link == "":
+		h := sha256.New()
+		size, err := io.Copy(h, o.Data)
+		if err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != installedPath.SHA256 {
+			return nil, fmt.Errorf("cannot create %s: path differs from installed content", relPath)
+		}
+		entry.SHA256 = installedPath.SHA256
+		entry.Size = int(size)
+		if installedPath.FinalSHA256 != "" {
+			// The report records the size after mutation.
+			entry.Size = int(installedPath.Size)
+		}
+	case o.Mode.IsRegular():
+		// Hard link, checked against its target when added to the report.
+		if installedPath.Inode == 0 {
+			return nil, fmt.Errorf("cannot create %s: path differs from installed content", relPath)
+		}
+	default:
+		if o.Link != installedPath.Link {
+			return nil, fmt.Errorf("cannot create %s: path differs from installed content", relPath)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,178 @@
+package slicer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/canonical/chisel/internal/manifestutil"
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+type RemoveOptions struct {
+	Release   *setup.Release
+	TargetDir string
+	// Slices holds the names of the installed slices to remove, as listed
+	// in the manifest.
+	Slices []string
+}
+
+// Remove removes slices installed by previous cuts into the target
+// directory. Paths are deleted only when no remaining slice refers to
+// them and they were not modified since, and the manifest is updated to
+// list the remaining slices.
+func Remove(options *RemoveOptions) error {
+	oldUmask := syscall.Umask(0)
+	defer func() {
+		syscall.Umask(oldUmask)
+	}()
+
+	targetDir, err := absTargetDir(options.TargetDir)
+	if err != nil {
+		return err
+	}
+
+	installed, err := readInstalled(targetDir, options.Release)
+	if err != nil {
+		return err
+	}
+	if installed == nil {
+		return fmt.Errorf("cannot find manifest of installed slices in %s", options.TargetDir)
+	}
+
+	removed := make(map[string]bool)
+	for _, name := range options.Slices {
+		if !installed.slices[name] {
+			return fmt.Errorf("slice %s is not installed", name)
+		}
+		removed[name] = true
+	}
+	foreign := make(map[string]bool)
+	var remaining []*setup.Slice
+	for _, slice := range installed.manifestSlices(options.Release, nil) {
+		_, arch, err := setup.ParseQualifiedSliceName(slice.String())
+		if err != nil {
+			return err
+		}
+		if arch != "" {
+			foreign[arch] = true
+		}
+		if !removed[slice.String()] {
+			remaining = append(remaining, slice)
+		}
+	}
+	for _, slice := range remaining {
+		for _, name := range essentialNames(slice) {
+			if removed[name] {
+				return fmt.Errorf("cannot remove slice %s: required by %s", name, slice)
+			}
+		}
+	}
+	if len(manifestutil.FindPaths(remaining)) == 0 {
+		return fmt.Errorf("cannot remove slices: no remaining slice generates the manifest")
+	}
+
+	installed.forget(removed)
+	err = installed.deleteForgotten(targetDir)
+	if err != nil {
+		return err
+	}
+
+	// Packages are kept while a remaining slice of the same architecture
+	// refers to them. Architectures not named by any slice are native.
+	used := make(map[string]bool)
+	for _, slice := range remaining {
+		key, arch, err := setup.ParseQualifiedSliceName(slice.String())
+		if err != nil {
+			return err
+		}
+		used[key.Package+":"+arch] = true
+		used[key.Package+":all"] = true
+	}
+	for name, pkgs := range installed.packages {
+		var kept []*manifest.Package
+		for _, pkg := range pkgs {
+			arch := pkg.Arch
+			if arch != "all" && !foreign[arch] {
+				arch = ""
+			}
+			if used[pkg.Name+":"+arch] {
+				kept = append(kept, pkg)
+			}
+		}
+		if len(kept) == 0 {
+			delete(installed.packages, name)
+		} else {
+			installed.packages[name] = kept
+		}
+	}
+
+	report, err := manifestutil.NewReport(targetDir)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot create report: %w", err)
+	}
+	err = installed.addToReport(report, remaining)
+	if err != nil {
+		return err
+	}
+	pkgInfos := installed.addPackages(nil)
+	err = generateDpkgStatus(targetDir, remaining, report, pkgInfos, nil, installed)
+	if err != nil {
+		return err
+	}
+	return generateManifests(targetDir, remaining, report, pkgInfos)
+}
+
+// removePath removes the file at relPath unless its content differs from
+// the one recorded in the manifest, in which case it is left in place.
+func removePath(targetDir, relPath string, path *manifest.Path) error {
+	modified, err := pathModified(targetDir, relPath, path)
+	if err != nil {
+		return fmt.Errorf("cannot remove %s: %w", relPath, err)
+	}
+	if modified {
+		logf("Warning: Path %s was modified, leaving it in place", relPath)
+		return nil
+	}
+	err = os.Remove(filepath.Join(targetDir, relPath))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove %s: %w", relPath, err)
+	}
+	return nil
+}
+
+// pathModified returns whether the file at relPath differs from the one
+// recorded in the manifest. Missing files are not reported as modified.
+func pathModified(targetDir, relPath string, path *manifest.Path) (bool, error) {
+	realPath := filepath.Join(targetDir, relPath)
+	info, err := os.Lstat(realPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(realPath)
+		if err != nil {
+			return false, err
+		}
+		return link != path.Link, nil
+	case path.SHA256 == "":
+		// Generated files, such as the manifest, have no digest recorded.
+		return false, nil
+	default:
+		sum, err := manifestutil.FileSHA256(realPath)
+		if err != nil {
+			return false, err
+		}
+		expected := path.SHA256
+		if path.FinalSHA256 != "" {
+			expected = path.FinalSHA256
+		}
+		return sum != expected, nil
+	}
+}
@@ -0,0 +1,253 @@
+package slicer_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/testutil"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+var removeTests = []struct {
+	summary    string
+	remove     []string
+	prepare    func(c *C, targetDir string)
+	filesystem map[string]string
+	paths      map[string]string
+	pkgs       map[string]string
+	error      string
+}{{
+	summary: "Remove slice sharing paths with others",
+	remove:  []string{"test-package_otherslice"},
+	filesystem: map[string]string{
+		"/dir/":          "dir 0755",
+		"/dir/file":      "file 0644 cc55e2ec",
+		"/dir/text-file": "file 0644 d98cf53e",
+		"/file":          "file 0644 fc02ca0e",
+	},
+	paths: map[string]string{
+		"/dir/file":      "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/text-file": "file 0644 5b41362b d98cf53e {test-package_myslice}",
+		"/file":          "file 0644 fc02ca0e {other-package_myslice}",
+	},
+	pkgs: map[string]string{
+		"other-package": "other-package version all hash",
+		"test-package":  "test-package version amd64 hash",
+	},
+}, {
+	summary: "Remove mutated path and all slices of a package",
+	remove:  []string{"test-package_myslice", "other-package_myslice"},
+	filesystem: map[string]string{
+		"/dir/":                  "dir 0755",
+		"/dir/file":              "file 0644 cc55e2ec",
+		"/dir/nested/":           "dir 0755",
+		"/dir/nested/other-file": "file 0644 6b86b273",
+	},
+	paths: map[string]string{
+		"/dir/file":              "file 0644 cc55e2ec {test-package_otherslice}",
+		"/dir/nested/other-file": "file 0644 6b86b273 {test-package_otherslice}",
+	},
+	pkgs: map[string]string{
+		"test-package": "test-package version amd64 hash",
+	},
+}, {
+	summary: "Modified paths are left in place",
+	remove:  []string{"test-package_otherslice"},
+	prepare: func(c *C, targetDir string) {
+		err := os.WriteFile(filepath.Join(targetDir, "dir/nested/other-file"), []byte("modified"), 0644)
+		c.Assert(err, IsNil)
+	},
+	filesystem: map[string]string{
+		"/dir/":                  "dir 0755",
+		"/dir/file":              "file 0644 cc55e2ec",
+		"/dir/nested/":           "dir 0755",
+		"/dir/nested/other-file": "file 0644 b8001285",
+		"/dir/text-file":         "file 0644 d98cf53e",
+		"/file":                  "file 0644 fc02ca0e",
+	},
+	paths: map[string]string{
+		"/dir/file":      "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/text-file": "file 0644 5b41362b d98cf53e {test-package_myslice}",
+		"/file":          "file 0644 fc02ca0e {other-package_myslice}",
+	},
+	pkgs: map[string]string{
+		"other-package": "other-package version all hash",
+		"test-package":  "test-package version amd64 hash",
+	},
+}, {
+	summary: "Slice not installed",
+	remove:  []string{"test-package_foo"},
+	error:   `slice test-package_foo is not installed`,
+}, {
+	summary: "Slice required by remaining slices",
+	remove:  []string{"test-package_manifest"},
+	error:   `cannot remove slice test-package_manifest: required by other-package_myslice`,
+}}
+
+func (s *S) TestRemove(c *C) {
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/dir/file:
+						/dir/text-file: {text: data1, mutable: true}
+					mutate: |
+						content.write("/dir/text-file", "data2")
+				otherslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/dir/file:
+						/dir/nested/other-file:
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/file:
+		`,
+	}
+	release := readTestRelease(c, files)
+	keys := []setup.SliceKey{
+		{"test-package", "myslice"},
+		{"test-package", "otherslice"},
+		{"other-package", "myslice"},
+	}
+	pkgs := []*testutil.TestPackage{{
+		Name:    "test-package",
+		Version: "version",
+		Arch:    "amd64",
+		Hash:    "hash",
+		Data:    testutil.PackageData["test-package"],
+	}, {
+		Name:    "other-package",
+		Version: "version",
+		Arch:    "all",
+		Hash:    "hash",
+		Data:    testutil.PackageData["other-package"],
+	}}
+
+	for _, test := range removeTests {
+		c.Logf("Summary: %s", test.summary)
+		targetDir := c.MkDir()
+		err := slicer.Run(testRunOptions(c, release, targetDir, keys, "amd64", pkgs...))
+		c.Assert(err, IsNil)
+		if test.prepare != nil {
+			test.prepare(c, targetDir)
+		}
+
+		err = slicer.Remove(&slicer.RemoveOptions{
+			Release:   release,
+			TargetDir: targetDir,
+			Slices:    test.remove,
+		})
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+
+		manifestPath := "/chisel-data/manifest.wall"
+		filesystem := testutil.TreeDump(targetDir)
+		delete(filesystem, "/chisel-data/")
+		delete(filesystem, manifestPath)
+		c.Assert(filesystem, DeepEquals, test.filesystem)
+
+		mfest := readManifest(c, targetDir, manifestPath)
+		pathsDump, err := treeDumpManifestPaths(mfest)
+		c.Assert(err, IsNil)
+		delete(pathsDump, manifestPath)
+		c.Assert(pathsDump, DeepEquals, test.paths)
+		pkgsDump, err := dumpManifestPkgs(mfest)
+		c.Assert(err, IsNil)
+		c.Assert(pkgsDump, DeepEquals, test.pkgs)
+	}
+}
+
+func (s *S) TestRemoveForeignArchs(c *C) {
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file:
+		`,
+	}
+	release := readTestRelease(c, files)
+	packages := func(arch string) []*testutil.TestPackage {
+		return []*testutil.TestPackage{{
+			Name:    "test-package",
+			Version: "version",
+			Arch:    arch,
+			Hash:    "hash-" + arch,
+			Data:    testutil.PackageData["test-package"],
+		}, {
+			Name:    "other-package",
+			Version: "version",
+			Arch:    "all",
+			Hash:    "hash-all",
+			Data:    testutil.PackageData["other-package"],
+		}}
+	}
+	keys := []setup.SliceKey{{"test-package", "myslice"}, {"other-package", "myslice"}}
+	foreignSelection, err := setup.Select(release, keys, "i386")
+	c.Assert(err, IsNil)
+
+	targetDir := c.MkDir()
+	options := testRunOptions(c, release, targetDir, append(keys, setup.SliceKey{"test-package", "manifest"}), "amd64", packages("amd64")...)
+	options.ForeignArchs = []*slicer.ArchOptions{{
+		Selection: foreignSelection,
+		Archives:  testArchives(release, "i386", packages("i386")...),
+	}}
+	err = slicer.Run(options)
+	c.Assert(err, IsNil)
+
+	// The package of the removed architecture is dropped even though
+	// the same package remains installed for another one.
+	err = slicer.Remove(&slicer.RemoveOptions{
+		Release:   release,
+		TargetDir: targetDir,
+		Slices:    []string{"test-package:i386_myslice", "other-package:i386_myslice"},
+	})
+	c.Assert(err, IsNil)
+
+	mfest := readManifest(c, targetDir, "/chisel-data/manifest.wall")
+	var pkgs []string
+	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+		pkgs = append(pkgs, fmt.Sprintf("%s %s %s %s", pkg.Name, pkg.Version, pkg.Arch, pkg.Digest))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(pkgs, DeepEquals, []string{
+		"other-package version all hash-all",
+		"test-package version amd64 hash-amd64",
+	})
+}
@@ -3,6 +3,7 @@ package slicer
 import (
 	"archive/tar"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -10,7 +11,10 @@ import (
 	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/klauspost/compress/zstd"
@@ -29,6 +33,71 @@ type RunOptions struct {
 	Selection *setup.Selection
 	Archives  map[string]archive.Archive
 	TargetDir string
+	// Jobs is the maximum number of packages fetched concurrently. Packages
+	// are fetched one at a time if unset.
+	Jobs int
+	// Pins maps package names to the exact version to be fetched. Packages
+	// without a pin use the newest version available.
+	Pins map[string]string
+	// ForeignArchs holds the selection and archives of each additional
+	// architecture cut into the same tree. Slices selected for these are
+	// reported qualified with their architecture, as in "libc6:i386_libs".
+	ForeignArchs []*ArchOptions
+}
+
+// ArchOptions holds the selection of slices for one architecture and the
+// archives opened for it.
+type ArchOptions struct {
+	Selection *setup.Selection
+	Archives  map[string]archive.Archive
+}
+
+// archRun holds the state of the cut for a single architecture.
+type archRun struct {
+	selection  *setup.Selection
+	pkgArchive map[string]archive.Archive
+	prefers    map[string]*setup.Package
+	extract    map[string]map[string][]deb.ExtractInfo
+	packages   map[string]io.ReadSeekCloser
+	// reported holds the slices as reported in the manifest, in the same
+	// order as in the selection.
+	reported []*setup.Slice
+}
+
+// newArchRuns returns the state for each architecture in the cut, starting
+// with the one of the main selection.
+func newArchRuns(options *RunOptions) ([]*archRun, error) {
+	archOptions := append([]*ArchOptions{{
+		Selection: options.Selection,
+		Archives:  options.Archives,
+	}}, options.ForeignArchs...)
+	var runs []*archRun
+	for i, opts := range archOptions {
+		pkgArchive, err := selectPkgArchives(opts.Archives, opts.Selection)
+		if err != nil {
+			return nil, err
+		}
+		prefers, err := opts.Selection.Prefers()
+		if err != nil {
+			return nil, err
+		}
+		run := &archRun{
+			selection:  opts.Selection,
+			pkgArchive: pkgArchive,
+			prefers:    prefers,
+			reported:   opts.Selection.Slices,
+		}
+		if i > 0 {
+			run.reported = make([]*setup.Slice, len(opts.Selection.Slices))
+			for j, slice := range opts.Selection.Slices {
+				qualified := *slice
+				qualified.Package = slice.Package + ":" + opts.Selection.Arch
+				run.reported[j] = &qualified
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
 }
 
 type pathData struct {
@@ -81,84 +150,152 @@ func Run(options *RunOptions) error {
 		syscall.Umask(oldUmask)
 	}()
 
-	targetDir := filepath.Clean(options.TargetDir)
+	targetDir, err := absTargetDir(options.TargetDir)
+	if err != nil {
+		return err
+	}
+
+	// When cutting into a root with content installed by a previous cut,
+	// only the slices not yet installed are added.
+	installed, err := readInstalled(targetDir, options.Selection.Release)
+	if err != nil {
+		return err
+	}
+	return cut(options, targetDir, installed)
+}
+
+func absTargetDir(targetDir string) (string, error) {
+	targetDir = filepath.Clean(targetDir)
 	if !filepath.IsAbs(targetDir) {
 		dir, err := os.Getwd()
 		if err != nil {
-			return fmt.Errorf("cannot obtain current directory: %w", err)
+			return "", fmt.Errorf("cannot obtain current directory: %w", err)
 		}
 		targetDir = filepath.Join(dir, targetDir)
 	}
+	return targetDir, nil
+}
 
-	pkgArchive, err := selectPkgArchives(options.Archives, options.Selection)
+// cut performs the cut described by options into targetDir, which may hold
+// content installed previously.
+func cut(options *RunOptions, targetDir string, installed *installedRoot) error {
+	runs, err := newArchRuns(options)
 	if err != nil {
 		return err
 	}
+	var selected []*setup.Slice
+	for _, run := range runs {
+		selected = append(selected, run.reported...)
+	}
 
-	prefers, err := options.Selection.Prefers()
-	if err != nil {
-		return err
+	if installed != nil {
+		for _, run := range runs {
+			err := installed.skipInstalled(run, options.Pins)
+			if err != nil {
+				return err
+			}
+		}
 	}
+	manifestSlices := installed.manifestSlices(options.Selection.Release, selected)
 
 	// Build information to process the selection.
-	extract := make(map[string]map[string][]deb.ExtractInfo)
-	for _, slice := range options.Selection.Slices {
-		extractPackage := extract[slice.Package]
-		if extractPackage == nil {
-			extractPackage = make(map[string][]deb.ExtractInfo)
-			extract[slice.Package] = extractPackage
-		}
-		arch := pkgArchive[slice.Package].Options().Arch
-		for targetPath, pathInfo := range slice.Contents {
-			if targetPath == "" {
-				continue
+	for _, run := range runs {
+		run.extract = make(map[string]map[string][]deb.ExtractInfo)
+		for i, slice := range run.selection.Slices {
+			extractPackage := run.extract[slice.Package]
+			if extractPackage == nil {
+				extractPackage = make(map[string][]deb.ExtractInfo)
+				run.extract[slice.Package] = extractPackage
 			}
-			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
-				continue
-			}
-			if preferredPkg, ok := prefers[targetPath]; ok && preferredPkg.Name != slice.Package {
-				continue
-			}
-
-			if pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath {
-				sourcePath := pathInfo.Info
-				if sourcePath == "" {
-					sourcePath = targetPath
+			arch := run.pkgArchive[slice.Package].Options().Arch
+			for targetPath, pathInfo := range slice.Contents {
+				if targetPath == "" {
+					continue
 				}
-				extractPackage[sourcePath] = append(extractPackage[sourcePath], deb.ExtractInfo{
-					Path:    targetPath,
-					Context: slice,
-				})
-			} else {
-				// When the content is not extracted from the package (i.e. path is
-				// not glob or copy), we add a ExtractInfo for the parent directory
-				// to preserve the permissions from the tarball where possible.
-				targetDir := filepath.Dir(strings.TrimRight(targetPath, "/")) + "/"
-				if targetDir == "" || targetDir == "/" {
+				if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
+					continue
+				}
+				if preferredPkg, ok := run.prefers[targetPath]; ok && preferredPkg.Name != slice.Package {
 					continue
 				}
-				extractPackage[targetDir] = append(extractPackage[targetDir], deb.ExtractInfo{
-					Path:     targetDir,
-					Optional: true,
-				})
+
+				if pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath {
+					sourcePath := pathInfo.Info
+					if sourcePath == "" {
+						sourcePath = targetPath
+					}
+					extractPackage[sourcePath] = append(extractPackage[sourcePath], deb.ExtractInfo{
+						Path:    targetPath,
+						Context: run.reported[i],
+					})
+				} else {
+					// When the content is not extracted from the package (i.e. path is
+					// not glob or copy), we add a ExtractInfo for the parent directory
+					// to preserve the permissions from the tarball where possible.
+					targetDir := filepath.Dir(strings.TrimRight(targetPath, "/")) + "/"
+					if targetDir == "" || targetDir == "/" {
+						continue
+					}
+					extractPackage[targetDir] = append(extractPackage[targetDir], deb.ExtractInfo{
+						Path:     targetDir,
+						Optional: true,
+					})
+				}
 			}
 		}
 	}
 
-	// Fetch all packages, using the selection order.
-	packages := make(map[string]io.ReadSeekCloser)
+	// Fetch all packages, using the selection order, and read their control
+	// data. It may only be missing when not generating the dpkg status,
+	// whose entries are derived from it.
 	var pkgInfos []*archive.PackageInfo
-	for _, slice := range options.Selection.Slices {
-		if packages[slice.Package] != nil {
+	var fetchErrs []error
+	needControl := len(dpkgStatusDirs(manifestSlices)) > 0
+	controls := make(map[string]*deb.PackageControl)
+	for _, run := range runs {
+		pkgNames := selectionPackages(run.selection)
+		readers, infos, err := fetchPackages(pkgNames, run.pkgArchive, options.Pins, options.Jobs)
+		if err != nil {
+			if _, ok := err.(*archive.MissingError); !ok {
+				return err
+			}
+			// Report what is missing for all architectures together.
+			fetchErrs = append(fetchErrs, err)
 			continue
 		}
-		reader, info, err := pkgArchive[slice.Package].Fetch(slice.Package)
-		if err != nil {
-			return err
+		run.packages = make(map[string]io.ReadSeekCloser)
+		for i, pkgName := range pkgNames {
+			defer readers[i].Close()
+			run.packages[pkgName] = readers[i]
+			pkgControl, err := readControl(readers[i], infos[i])
+			if err != nil {
+				if needControl {
+					return fmt.Errorf("package %q: %w", pkgName, err)
+				}
+				// Packages without control data have no metadata to lose,
+				// while a failure to read it is otherwise worth reporting.
+				if errors.Is(err, deb.ErrNoControl) {
+					debugf("Package %q: %v", pkgName, err)
+				} else {
+					logf("Warning: Cannot read control data of package %q, its metadata is left out of the manifest: %v", pkgName, err)
+				}
+				continue
+			}
+			key := infos[i].Name + ":" + infos[i].Arch
+			if _, ok := controls[key]; !ok && !pkgControl.TrivialScript("postinst") {
+				logf("Warning: Package %q has a postinst script which is not run when cutting", pkgName)
+			}
+			controls[key] = pkgControl
+		}
+		for _, info := range infos {
+			// Packages for all architectures are fetched by every run.
+			if !slices.ContainsFunc(pkgInfos, func(p *archive.PackageInfo) bool { return *p == *info }) {
+				pkgInfos = append(pkgInfos, info)
+			}
 		}
-		defer reader.Close()
-		packages[slice.Package] = reader
-		pkgInfos = append(pkgInfos, info)
+	}
+	if err := archive.JoinMissing(fetchErrs); err != nil {
+		return err
 	}
 
 	// When creating content, record if a path is known and whether they are
@@ -169,6 +306,15 @@ func Run(options *RunOptions) error {
 	if err != nil {
 		return fmt.Errorf("internal error: cannot create report: %w", err)
 	}
+	err = installed.addToReport(report, manifestSlices)
+	if err != nil {
+		return err
+	}
+	for relPath, entry := range report.Entries {
+		addKnownPath(knownPaths, relPath, pathData{
+			hardLink: entry.Mode.IsRegular() && entry.Inode != 0,
+		})
+	}
 
 	// Record directories which are created but where not listed in the slice
 	// contents.
@@ -178,7 +324,7 @@ func Run(options *RunOptions) error {
 	// Creates the filesystem entry and adds it to the report. It also updates
 	// knownPaths with the files created.
 	create := func(extractInfos []deb.ExtractInfo, o *fsutil.CreateOptions) error {
-		entry, err := fsutil.Create(o)
+		entry, err := installed.create(o)
 		if err != nil {
 			return err
 		}
@@ -233,21 +379,23 @@ func Run(options *RunOptions) error {
 	}
 
 	// Extract all packages, also using the selection order.
-	for _, slice := range options.Selection.Slices {
-		reader := packages[slice.Package]
-		if reader == nil {
-			continue
-		}
-		err := deb.Extract(reader, &deb.ExtractOptions{
-			Package:   slice.Package,
-			Extract:   extract[slice.Package],
-			TargetDir: targetDir,
-			Create:    create,
-		})
-		reader.Close()
-		packages[slice.Package] = nil
-		if err != nil {
-			return err
+	for _, run := range runs {
+		for _, slice := range run.selection.Slices {
+			reader := run.packages[slice.Package]
+			if reader == nil {
+				continue
+			}
+			err := deb.Extract(reader, &deb.ExtractOptions{
+				Package:   slice.Package,
+				Extract:   run.extract[slice.Package],
+				TargetDir: targetDir,
+				Create:    create,
+			})
+			reader.Close()
+			run.packages[slice.Package] = nil
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -268,20 +416,22 @@ func Run(options *RunOptions) error {
 	// First group them by their relative path. Then create them and attribute
 	// them to the appropriate slices.
 	relPaths := map[string][]*setup.Slice{}
-	for _, slice := range options.Selection.Slices {
-		arch := pkgArchive[slice.Package].Options().Arch
-		for relPath, pathInfo := range slice.Contents {
-			if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
-				continue
-			}
-			if pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath ||
-				pathInfo.Kind == setup.GeneratePath {
-				continue
-			}
-			if preferredPkg, ok := prefers[relPath]; ok && preferredPkg.Name != slice.Package {
-				continue
+	for _, run := range runs {
+		for i, slice := range run.selection.Slices {
+			arch := run.pkgArchive[slice.Package].Options().Arch
+			for relPath, pathInfo := range slice.Contents {
+				if len(pathInfo.Arch) > 0 && !slices.Contains(pathInfo.Arch, arch) {
+					continue
+				}
+				if pathInfo.Kind == setup.CopyPath || pathInfo.Kind == setup.GlobPath ||
+					pathInfo.Kind == setup.GeneratePath {
+					continue
+				}
+				if preferredPkg, ok := run.prefers[relPath]; ok && preferredPkg.Name != slice.Package {
+					continue
+				}
+				relPaths[relPath] = append(relPaths[relPath], run.reported[i])
 			}
-			relPaths[relPath] = append(relPaths[relPath], slice)
 		}
 	}
 	for relPath, slices := range relPaths {
@@ -303,7 +453,7 @@ func Run(options *RunOptions) error {
 			mutable: pathInfo.Mutable,
 		}
 		addKnownPath(knownPaths, relPath, data)
-		entry, err := createFile(targetDir, relPath, pathInfo)
+		entry, err := createFile(targetDir, relPath, pathInfo, installed)
 		if err != nil {
 			return err
 		}
@@ -328,7 +478,12 @@ func Run(options *RunOptions) error {
 		CheckRead:  checker.checkKnown,
 		OnWrite:    report.Mutate,
 	}
-	for _, slice := range options.Selection.Slices {
+	var reported []*setup.Slice
+	for _, run := range runs {
+		reported = append(reported, run.reported...)
+	}
+	// Slices installed previously already had their scripts run.
+	for _, slice := range reported {
 		opts := scripts.RunOptions{
 			Label:  "mutate",
 			Script: slice.Scripts.Mutate,
@@ -347,12 +502,24 @@ func Run(options *RunOptions) error {
 		return err
 	}
 
-	return generateManifests(targetDir, options.Selection, report, pkgInfos)
+	// Content no longer installed is only deleted once the content
+	// replacing it was extracted and mutated.
+	err = installed.deleteForgotten(targetDir)
+	if err != nil {
+		return err
+	}
+
+	pkgInfos = installed.addPackages(pkgInfos)
+	err = generateDpkgStatus(targetDir, manifestSlices, report, pkgInfos, controls, installed)
+	if err != nil {
+		return err
+	}
+	return generateManifests(targetDir, manifestSlices, report, pkgInfos)
 }
 
-func generateManifests(targetDir string, selection *setup.Selection,
+func generateManifests(targetDir string, selection []*setup.Slice,
 	report *manifestutil.Report, pkgInfos []*archive.PackageInfo) error {
-	manifestSlices := manifestutil.FindPaths(selection.Slices)
+	manifestSlices := manifestutil.FindPaths(selection)
 	if len(manifestSlices) == 0 {
 		// Nothing to do.
 		return nil
@@ -386,13 +553,37 @@ func generateManifests(targetDir string, selection *setup.Selection,
 	defer w.Close()
 	writeOptions := &manifestutil.WriteOptions{
 		PackageInfo: pkgInfos,
-		Selection:   selection.Slices,
+		Selection:   selection,
 		Report:      report,
 	}
 	err = manifestutil.Write(writeOptions, w)
 	return err
 }
 
+// readControl reads the control data of the package and records its
+// metadata in info. The reader is left at the start of the package.
+func readControl(reader io.ReadSeeker, info *archive.PackageInfo) (*deb.PackageControl, error) {
+	pkgControl, err := deb.ReadControl(reader)
+	_, seekErr := reader.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	if seekErr != nil {
+		return nil, seekErr
+	}
+	info.Source = pkgControl.Field("Source")
+	info.Depends = pkgControl.Field("Depends")
+	info.Homepage = pkgControl.Field("Homepage")
+	if size := pkgControl.Field("Installed-Size"); size != "" {
+		installedSize, err := strconv.ParseUint(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Installed-Size: %q", size)
+		}
+		info.InstalledSize = installedSize
+	}
+	return pkgControl, nil
+}
+
 // removeAfterMutate removes entries marked with until: mutate. A path is marked
 // only when all slices that refer to the path mark it with until: mutate.
 func removeAfterMutate(rootDir string, knownPaths map[string]pathData) error {
@@ -452,7 +643,7 @@ func addKnownPath(knownPaths map[string]pathData, path string, data pathData) {
 	}
 }
 
-func createFile(targetDir, relPath string, pathInfo setup.PathInfo) (*fsutil.Entry, error) {
+func createFile(targetDir, relPath string, pathInfo setup.PathInfo, installed *installedRoot) (*fsutil.Entry, error) {
 	targetMode := pathInfo.Mode
 	if targetMode == 0 {
 		if pathInfo.Kind == setup.DirPath {
@@ -479,7 +670,7 @@ func createFile(targetDir, relPath string, pathInfo setup.PathInfo) (*fsutil.Ent
 		return nil, fmt.Errorf("internal error: cannot extract path of kind %q", pathInfo.Kind)
 	}
 
-	return fsutil.Create(&fsutil.CreateOptions{
+	return installed.create(&fsutil.CreateOptions{
 		Root:        targetDir,
 		Path:        relPath,
 		Mode:        tarHeader.FileInfo().Mode(),
@@ -489,6 +680,51 @@ func createFile(targetDir, relPath string, pathInfo setup.PathInfo) (*fsutil.Ent
 	})
 }
 
+// ResolvedPackage holds the package chosen for a selection and the name of
+// the archive it comes from.
+type ResolvedPackage struct {
+	Archive string
+	Info    *archive.PackageInfo
+}
+
+// Resolve returns the packages that Run would fetch for the selection, in
+// the selection order, without downloading them.
+func Resolve(options *RunOptions) ([]*ResolvedPackage, error) {
+	runs, err := newArchRuns(options)
+	if err != nil {
+		return nil, err
+	}
+	var resolved []*ResolvedPackage
+	for _, run := range runs {
+		for _, pkgName := range selectionPackages(run.selection) {
+			info, err := run.pkgArchive[pkgName].Info(pkgName, options.Pins[pkgName])
+			if err != nil {
+				return nil, err
+			}
+			if slices.ContainsFunc(resolved, func(r *ResolvedPackage) bool { return *r.Info == *info }) {
+				continue
+			}
+			resolved = append(resolved, &ResolvedPackage{
+				Archive: run.pkgArchive[pkgName].Options().Label,
+				Info:    info,
+			})
+		}
+	}
+	return resolved, nil
+}
+
+// selectionPackages returns the names of the packages in the selection,
+// in the selection order.
+func selectionPackages(selection *setup.Selection) []string {
+	var pkgNames []string
+	for _, slice := range selection.Slices {
+		if !slices.Contains(pkgNames, slice.Package) {
+			pkgNames = append(pkgNames, slice.Package)
+		}
+	}
+	return pkgNames
+}
+
 // selectPkgArchives selects the highest priority archive containing the package
 // unless a particular archive is pinned within the slice definition file. It
 // returns a map of archives indexed by package names.
@@ -537,3 +773,52 @@ func selectPkgArchives(archives map[string]archive.Archive, selection *setup.Sel
 	}
 	return pkgArchive, nil
 }
+
+// fetchPackages fetches the named packages from their archives, in the
+// pinned version if any, running up to jobs fetches concurrently. The
+// results are in the same order as pkgNames. If any fetch fails, the first
+// error in that order is returned and all readers obtained are closed.
+// Packages missing from the cache when working offline are all reported
+// together.
+func fetchPackages(pkgNames []string, pkgArchive map[string]archive.Archive, pins map[string]string, jobs int) ([]io.ReadSeekCloser, []*archive.PackageInfo, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	readers := make([]io.ReadSeekCloser, len(pkgNames))
+	infos := make([]*archive.PackageInfo, len(pkgNames))
+	errs := make([]error, len(pkgNames))
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	sem := make(chan struct{}, jobs)
+	for i, pkgName := range pkgNames {
+		sem <- struct{}{}
+		if failed.Load() {
+			// Do not start new fetches once one has failed.
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			readers[i], infos[i], errs[i] = pkgArchive[pkgName].Fetch(pkgName, pins[pkgName])
+			if _, ok := errs[i].(*archive.MissingError); errs[i] != nil && !ok {
+				failed.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := archive.JoinMissing(errs); err != nil {
+		for _, reader := range readers {
+			if reader != nil {
+				reader.Close()
+			}
+		}
+		return nil, nil, err
+	}
+	return readers, infos, nil
+}
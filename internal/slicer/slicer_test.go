@@ -930,6 +930,121 @@ var slicerTests = []slicerTest{{
 	manifestPkgs: map[string]string{
 		"test-package": "test-package v2 a2 h2",
 	},
+}, {
+	summary: "Fetch packages concurrently",
+	slices: []setup.SliceKey{
+		{"test-package", "myslice"},
+		{"other-package", "myslice"},
+		{"third-package", "myslice"},
+	},
+	pkgs: []*testutil.TestPackage{{
+		Name:    "test-package",
+		Hash:    "h1",
+		Version: "v1",
+		Arch:    "a1",
+		Data: testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./file1", "data1"),
+		}),
+	}, {
+		Name:    "other-package",
+		Hash:    "h2",
+		Version: "v2",
+		Arch:    "a2",
+		Data: testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./file2", "data2"),
+		}),
+	}, {
+		Name:    "third-package",
+		Hash:    "h3",
+		Version: "v3",
+		Arch:    "a3",
+		Data: testutil.MustMakeDeb([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./file3", "data3"),
+		}),
+	}},
+	hackopt: func(c *C, opts *slicer.RunOptions) {
+		opts.Jobs = 2
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/file1:
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file2:
+		`,
+		"slices/mydir/third-package.yaml": `
+			package: third-package
+			slices:
+				myslice:
+					contents:
+						/file3:
+		`,
+	},
+	filesystem: map[string]string{
+		"/file1": "file 0644 5b41362b",
+		"/file2": "file 0644 d98cf53e",
+		"/file3": "file 0644 f60f2d65",
+	},
+	manifestPkgs: map[string]string{
+		"test-package":  "test-package v1 a1 h1",
+		"other-package": "other-package v2 a2 h2",
+		"third-package": "third-package v3 a3 h3",
+	},
+}, {
+	summary: "Pinned package version",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	pkgs: []*testutil.TestPackage{{
+		Name:    "test-package",
+		Hash:    "h1",
+		Version: "v1",
+		Arch:    "a1",
+		Data:    testutil.PackageData["test-package"],
+	}},
+	hackopt: func(c *C, opts *slicer.RunOptions) {
+		opts.Pins = map[string]string{"test-package": "v1"}
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+		`,
+	},
+	manifestPkgs: map[string]string{
+		"test-package": "test-package v1 a1 h1",
+	},
+}, {
+	summary: "Pinned package version is not available",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	pkgs: []*testutil.TestPackage{{
+		Name:    "test-package",
+		Version: "v1",
+		Data:    testutil.PackageData["test-package"],
+	}},
+	hackopt: func(c *C, opts *slicer.RunOptions) {
+		opts.Pins = map[string]string{"test-package": "v2"}
+	},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+		`,
+	},
+	error: `cannot find package "test-package" version v2 in archive`,
 }, {
 	summary: "Pinned archive does not have the package",
 	slices:  []setup.SliceKey{{"test-package", "myslice"}},
@@ -1908,6 +2023,71 @@ var slicerTests = []slicerTest{{
 		`,
 	},
 	logOutput: `(?s).*Warning: Path "/parent/" has diverging modes in different packages\. Please report\..*`,
+}, {
+	summary: "Warn about packages with postinst logic",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	pkgs: []*testutil.TestPackage{{
+		Name: "test-package",
+		Data: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./control", "Package: test-package\n"),
+			testutil.Reg(0755, "./postinst", "#!/bin/sh\nset -e\nldconfig\n"),
+		}, testutil.TestPackageEntries),
+	}},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+	},
+	logOutput: `(?s).*Warning: Package "test-package" has a postinst script which is not run when cutting.*`,
+}, {
+	summary: "Warning for packages with unreadable control data",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	pkgs: []*testutil.TestPackage{{
+		Name: "test-package",
+		Data: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./control", "Package: test-package\nInstalled-Size: many\n"),
+		}, testutil.TestPackageEntries),
+	}},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+	},
+	logOutput: `(?s).*Warning: Cannot read control data of package "test-package", its metadata is left out of the manifest: invalid Installed-Size: "many".*`,
+}, {
+	summary: "No warning for packages with trivial postinst",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	pkgs: []*testutil.TestPackage{{
+		Name: "test-package",
+		Data: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+			testutil.Dir(0755, "./"),
+			testutil.Reg(0644, "./control", "Package: test-package\n"),
+			testutil.Reg(0755, "./postinst", "#!/bin/sh\nset -e\n\n#DEBHELPER#\n\nexit 0\n"),
+		}, testutil.TestPackageEntries),
+	}},
+	release: map[string]string{
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+	},
+	filesystem: map[string]string{
+		"/dir/":     "dir 0755",
+		"/dir/file": "file 0644 cc55e2ec",
+	},
 }, {
 	summary: "Arch specific slice is not installed when it does not match requested arch",
 	slices:  []setup.SliceKey{{"test-package", "myslice"}},
@@ -2238,3 +2418,516 @@ func readManifest(c *C, targetDir, manifestPath string) *manifest.Manifest {
 
 	return mfest
 }
+
+func (s *S) TestResolve(c *C) {
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice1:
+					contents:
+				myslice2:
+					contents:
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+		`,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	selection, err := setup.Select(release, []setup.SliceKey{
+		{"test-package", "myslice1"},
+		{"other-package", "myslice"},
+		{"test-package", "myslice2"},
+	}, "")
+	c.Assert(err, IsNil)
+
+	archives := map[string]archive.Archive{
+		"ubuntu": &testutil.TestArchive{
+			Opts: archive.Options{Label: "ubuntu"},
+			Packages: map[string]*testutil.TestPackage{
+				"test-package":  {Name: "test-package", Version: "v1", Arch: "a1", Hash: "h1"},
+				"other-package": {Name: "other-package", Version: "v2", Arch: "a2", Hash: "h2"},
+			},
+		},
+	}
+	resolved, err := slicer.Resolve(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  archives,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(resolved, DeepEquals, []*slicer.ResolvedPackage{{
+		Archive: "ubuntu",
+		Info:    &archive.PackageInfo{Name: "other-package", Version: "v2", Arch: "a2", SHA256: "h2"},
+	}, {
+		Archive: "ubuntu",
+		Info:    &archive.PackageInfo{Name: "test-package", Version: "v1", Arch: "a1", SHA256: "h1"},
+	}})
+
+	_, err = slicer.Resolve(&slicer.RunOptions{
+		Selection: selection,
+		Archives:  archives,
+		Pins:      map[string]string{"test-package": "v9"},
+	})
+	c.Assert(err, ErrorMatches, `cannot find package "test-package" version v9 in archive`)
+}
+
+func (s *S) TestRunForeignArchs(c *C) {
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+						/dir/amd64-file: {text: data1, arch: amd64}
+						/dir/i386-file:  {text: data2, arch: i386}
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file:
+		`,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	archives := func(arch string) map[string]archive.Archive {
+		archives := map[string]archive.Archive{}
+		for name, setupArchive := range release.Archives {
+			archives[name] = &testutil.TestArchive{
+				Opts: archive.Options{
+					Label:      setupArchive.Name,
+					Version:    setupArchive.Version,
+					Suites:     setupArchive.Suites,
+					Components: setupArchive.Components,
+					Arch:       arch,
+				},
+				Packages: map[string]*testutil.TestPackage{
+					"test-package": {
+						Name:    "test-package",
+						Version: "version",
+						Arch:    arch,
+						Hash:    "hash-" + arch,
+						Data:    testutil.PackageData["test-package"],
+					},
+					"other-package": {
+						Name:    "other-package",
+						Version: "version",
+						Arch:    "all",
+						Hash:    "hash-all",
+						Data:    testutil.PackageData["other-package"],
+					},
+				},
+			}
+		}
+		return archives
+	}
+
+	selection, err := setup.Select(release, []setup.SliceKey{
+		{"test-package", "myslice"},
+		{"test-package", "manifest"},
+		{"other-package", "myslice"},
+	}, "amd64")
+	c.Assert(err, IsNil)
+	foreignSelection, err := setup.Select(release, []setup.SliceKey{
+		{"test-package", "myslice"},
+		{"other-package", "myslice"},
+	}, "i386")
+	c.Assert(err, IsNil)
+
+	options := slicer.RunOptions{
+		Selection: selection,
+		Archives:  archives("amd64"),
+		TargetDir: c.MkDir(),
+		ForeignArchs: []*slicer.ArchOptions{{
+			Selection: foreignSelection,
+			Archives:  archives("i386"),
+		}},
+	}
+	err = slicer.Run(&options)
+	c.Assert(err, IsNil)
+
+	manifestPath := "/chisel-data/manifest.wall"
+	mfest := readManifest(c, options.TargetDir, manifestPath)
+	pathsDump, err := treeDumpManifestPaths(mfest)
+	c.Assert(err, IsNil)
+	delete(pathsDump, manifestPath)
+	c.Assert(pathsDump, DeepEquals, map[string]string{
+		"/dir/file":       "file 0644 cc55e2ec {test-package:i386_myslice,test-package_myslice}",
+		"/dir/amd64-file": "file 0644 5b41362b {test-package_myslice}",
+		"/dir/i386-file":  "file 0644 d98cf53e {test-package:i386_myslice}",
+		"/file":           "file 0644 fc02ca0e {other-package:i386_myslice,other-package_myslice}",
+	})
+
+	var pkgs []string
+	err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+		pkgs = append(pkgs, fmt.Sprintf("%s %s %s %s", pkg.Name, pkg.Version, pkg.Arch, pkg.Digest))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	// Packages for all architectures are listed once.
+	c.Assert(pkgs, DeepEquals, []string{
+		"other-package version all hash-all",
+		"test-package version amd64 hash-amd64",
+		"test-package version i386 hash-i386",
+	})
+
+	resolved, err := slicer.Resolve(&options)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, HasLen, 3)
+	c.Assert(resolved[0].Info.Arch, Equals, "all")
+	c.Assert(resolved[1].Info.Arch, Equals, "amd64")
+	c.Assert(resolved[2].Info.Arch, Equals, "i386")
+}
+
+var incrementalTests = []struct {
+	summary string
+	slices  []setup.SliceKey
+	version string
+	data    []byte
+	prepare func(c *C, targetDir string)
+	paths   map[string]string
+	error   string
+}{{
+	summary: "New slices are added to the installed ones",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}, {"test-package", "otherslice"}},
+	paths: map[string]string{
+		"/dir/file":              "file 0644 cc55e2ec {test-package_myslice,test-package_otherslice}",
+		"/dir/text-file":         "file 0644 5b41362b d98cf53e {test-package_myslice}",
+		"/dir/nested/other-file": "file 0644 6b86b273 {test-package_otherslice}",
+	},
+}, {
+	summary: "Installed slices only",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	paths: map[string]string{
+		"/dir/file":      "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/text-file": "file 0644 5b41362b d98cf53e {test-package_myslice}",
+	},
+}, {
+	summary: "Package of installed slices only may move forward",
+	slices:  []setup.SliceKey{{"test-package", "myslice"}},
+	version: "version2",
+	paths: map[string]string{
+		"/dir/file":      "file 0644 cc55e2ec {test-package_myslice}",
+		"/dir/text-file": "file 0644 5b41362b d98cf53e {test-package_myslice}",
+	},
+}, {
+	summary: "Content not created by chisel",
+	slices:  []setup.SliceKey{{"test-package", "otherslice"}},
+	prepare: func(c *C, targetDir string) {
+		err := os.MkdirAll(filepath.Join(targetDir, "dir/nested"), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(filepath.Join(targetDir, "dir/nested/other-file"), []byte("foo"), 0644)
+		c.Assert(err, IsNil)
+	},
+	error: `cannot extract from package "test-package": cannot create /dir/nested/other-file: path exists and was not created by chisel`,
+}, {
+	summary: "Content differs from installed one",
+	slices:  []setup.SliceKey{{"test-package", "otherslice"}},
+	data: testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./dir/"),
+		testutil.Reg(0644, "./dir/file", "other data"),
+		testutil.Dir(0755, "./dir/nested/"),
+		testutil.Reg(0644, "./dir/nested/other-file", "other data"),
+	}),
+	error: `cannot extract from package "test-package": cannot create /dir/file: path differs from installed content`,
+}, {
+	summary: "Mode differs from installed one",
+	slices:  []setup.SliceKey{{"test-package", "otherslice"}},
+	data: testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./dir/"),
+		testutil.Reg(0755, "./dir/file", "12u3q0wej	ajsd"),
+		testutil.Dir(0755, "./dir/nested/"),
+		testutil.Reg(0644, "./dir/nested/other-file", "1"),
+	}),
+	error: `cannot extract from package "test-package": cannot create /dir/file: path differs from installed content`,
+}, {
+	summary: "Installed package version differs",
+	slices:  []setup.SliceKey{{"test-package", "otherslice"}},
+	version: "version2",
+	error:   `package "test-package" is installed at version version, cannot cut version version2`,
+}}
+
+func (s *S) TestRunIncremental(c *C) {
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/dir/file:
+						/dir/text-file: {text: data1, mutable: true}
+					mutate: |
+						content.write("/dir/text-file", "data2")
+				otherslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/dir/file:
+						/dir/nested/other-file:
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	runOptions := func(targetDir string, keys []setup.SliceKey, version string, data []byte) *slicer.RunOptions {
+		selection, err := setup.Select(release, keys, "amd64")
+		c.Assert(err, IsNil)
+		archives := map[string]archive.Archive{}
+		for name, setupArchive := range release.Archives {
+			archives[name] = &testutil.TestArchive{
+				Opts: archive.Options{
+					Label:      setupArchive.Name,
+					Version:    setupArchive.Version,
+					Suites:     setupArchive.Suites,
+					Components: setupArchive.Components,
+					Arch:       "amd64",
+				},
+				Packages: map[string]*testutil.TestPackage{
+					"test-package": {
+						Name:    "test-package",
+						Version: version,
+						Arch:    "amd64",
+						Hash:    "hash-" + version,
+						Data:    data,
+					},
+				},
+			}
+		}
+		return &slicer.RunOptions{
+			Selection: selection,
+			Archives:  archives,
+			TargetDir: targetDir,
+		}
+	}
+
+	for _, test := range incrementalTests {
+		c.Logf("Summary: %s", test.summary)
+		targetDir := c.MkDir()
+		err := slicer.Run(runOptions(targetDir, []setup.SliceKey{{"test-package", "myslice"}}, "version", testutil.PackageData["test-package"]))
+		c.Assert(err, IsNil)
+		if test.prepare != nil {
+			test.prepare(c, targetDir)
+		}
+
+		version := test.version
+		if version == "" {
+			version = "version"
+		}
+		data := test.data
+		if data == nil {
+			data = testutil.PackageData["test-package"]
+		}
+		err = slicer.Run(runOptions(targetDir, test.slices, version, data))
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			continue
+		}
+		c.Assert(err, IsNil)
+
+		// The mutation of the installed slice is preserved.
+		data, err = os.ReadFile(filepath.Join(targetDir, "dir/text-file"))
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "data2")
+
+		manifestPath := "/chisel-data/manifest.wall"
+		mfest := readManifest(c, targetDir, manifestPath)
+		pathsDump, err := treeDumpManifestPaths(mfest)
+		c.Assert(err, IsNil)
+		delete(pathsDump, manifestPath)
+		c.Assert(pathsDump, DeepEquals, test.paths)
+		pkgsDump, err := dumpManifestPkgs(mfest)
+		c.Assert(err, IsNil)
+		c.Assert(pkgsDump, DeepEquals, map[string]string{
+			"test-package": "test-package version amd64 hash-version",
+		})
+	}
+}
+
+func (s *S) TestRunPackageMetadata(c *C) {
+	releaseDir := c.MkDir()
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+	}
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+
+	archives := map[string]archive.Archive{}
+	for name, setupArchive := range release.Archives {
+		archives[name] = &testutil.TestArchive{
+			Opts: archive.Options{
+				Label:      setupArchive.Name,
+				Version:    setupArchive.Version,
+				Suites:     setupArchive.Suites,
+				Components: setupArchive.Components,
+				Arch:       "amd64",
+			},
+			Packages: map[string]*testutil.TestPackage{
+				"test-package": {
+					Name:    "test-package",
+					Version: "version",
+					Arch:    "amd64",
+					Hash:    "hash",
+					Data: testutil.MustMakeDebWithControl([]testutil.TarEntry{
+						testutil.Dir(0755, "./"),
+						testutil.Reg(0644, "./control", `Package: test-package
+Source: test-source (1.0)
+Version: version
+Architecture: amd64
+Installed-Size: 42
+Depends: libc6 (>= 2.34), other-package
+Homepage: https://example.com/test
+Description: Test package
+`),
+					}, testutil.TestPackageEntries),
+				},
+			},
+		}
+	}
+
+	// The second cut fetches nothing, and keeps the metadata of the package
+	// installed previously.
+	targetDir := c.MkDir()
+	cuts := [][]setup.SliceKey{
+		{{"test-package", "myslice"}, {"test-package", "manifest"}},
+		{{"test-package", "manifest"}},
+	}
+	for _, sliceKeys := range cuts {
+		selection, err := setup.Select(release, sliceKeys, "amd64")
+		c.Assert(err, IsNil)
+		err = slicer.Run(&slicer.RunOptions{
+			Selection: selection,
+			Archives:  archives,
+			TargetDir: targetDir,
+		})
+		c.Assert(err, IsNil)
+
+		mfest := readManifest(c, targetDir, "/chisel-data/manifest.wall")
+		var pkgs []*manifest.Package
+		err = mfest.IteratePackages(func(pkg *manifest.Package) error {
+			pkgs = append(pkgs, pkg)
+			return nil
+		})
+		c.Assert(err, IsNil)
+		c.Assert(pkgs, DeepEquals, []*manifest.Package{{
+			Kind:          "package",
+			Name:          "test-package",
+			Version:       "version",
+			Digest:        "hash",
+			Arch:          "amd64",
+			Source:        "test-source (1.0)",
+			InstalledSize: 42,
+			Depends:       "libc6 (>= 2.34), other-package",
+			Homepage:      "https://example.com/test",
+		}})
+	}
+}
+
+// readTestRelease writes files into a new release directory and reads it.
+func readTestRelease(c *C, files map[string]string) *setup.Release {
+	releaseDir := c.MkDir()
+	for path, data := range files {
+		fpath := filepath.Join(releaseDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(fpath, testutil.Reindent(data), 0644)
+		c.Assert(err, IsNil)
+	}
+	release, err := setup.ReadRelease(releaseDir)
+	c.Assert(err, IsNil)
+	return release
+}
+
+// testArchives returns a test archive for each archive in the release,
+// all of them providing pkgs for arch.
+func testArchives(release *setup.Release, arch string, pkgs ...*testutil.TestPackage) map[string]archive.Archive {
+	packages := make(map[string]*testutil.TestPackage)
+	for _, pkg := range pkgs {
+		packages[pkg.Name] = pkg
+	}
+	archives := map[string]archive.Archive{}
+	for name, setupArchive := range release.Archives {
+		archives[name] = &testutil.TestArchive{
+			Opts: archive.Options{
+				Label:      setupArchive.Name,
+				Version:    setupArchive.Version,
+				Suites:     setupArchive.Suites,
+				Components: setupArchive.Components,
+				Arch:       arch,
+			},
+			Packages: packages,
+		}
+	}
+	return archives
+}
+
+// testRunOptions returns the options to cut keys from the release into
+// targetDir for arch, with pkgs provided by every archive.
+func testRunOptions(c *C, release *setup.Release, targetDir string, keys []setup.SliceKey, arch string, pkgs ...*testutil.TestPackage) *slicer.RunOptions {
+	selection, err := setup.Select(release, keys, arch)
+	c.Assert(err, IsNil)
+	return &slicer.RunOptions{
+		Selection: selection,
+		Archives:  testArchives(release, arch, pkgs...),
+		TargetDir: targetDir,
+	}
+}
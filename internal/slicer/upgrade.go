@@ -0,0 +1,194 @@
+package slicer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"syscall"
+
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/public/manifest"
+)
+
+// PackageUpgrade describes an installed package for which a different
+// version is now selected.
+type PackageUpgrade struct {
+	Name       string
+	Arch       string
+	OldVersion string
+	NewVersion string
+}
+
+// InstalledSlices returns the slices installed by previous cuts into
+// targetDir, by architecture. The first architecture returned is the one of
+// the slices not qualified with an architecture, and is empty if it cannot
+// be told from the installed packages.
+func InstalledSlices(targetDir string, release *setup.Release) ([]string, map[string][]setup.SliceKey, error) {
+	targetDir, err := absTargetDir(targetDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	installed, err := readInstalled(targetDir, release)
+	if err != nil {
+		return nil, nil, err
+	}
+	if installed == nil {
+		return nil, nil, fmt.Errorf("cannot find manifest of installed slices in %s", targetDir)
+	}
+
+	archs := []string{""}
+	keys := make(map[string][]setup.SliceKey)
+	var mainPkgs []string
+	for _, name := range slices.Sorted(maps.Keys(installed.slices)) {
+		sliceKey, arch, err := setup.ParseQualifiedSliceName(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if arch == "" {
+			mainPkgs = append(mainPkgs, sliceKey.Package)
+		} else if !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+		keys[arch] = append(keys[arch], sliceKey)
+	}
+	for _, pkgName := range mainPkgs {
+		for _, pkg := range installed.packages[pkgName] {
+			if pkg.Arch != "all" && !slices.Contains(archs[1:], pkg.Arch) {
+				archs[0] = pkg.Arch
+				break
+			}
+		}
+		if archs[0] != "" {
+			break
+		}
+	}
+	keys[archs[0]] = keys[""]
+	if archs[0] != "" {
+		delete(keys, "")
+	}
+	return archs, keys, nil
+}
+
+// Upgrade brings the content installed by previous cuts into the target
+// directory up to date with the packages selected now. The slices of the
+// packages that changed are cut again, running their mutation scripts,
+// along with the slices with mutation scripts which depend on them. All
+// other content is left untouched. It returns the packages that changed,
+// if any.
+func Upgrade(options *RunOptions) ([]*PackageUpgrade, error) {
+	oldUmask := syscall.Umask(0)
+	defer func() {
+		syscall.Umask(oldUmask)
+	}()
+
+	targetDir, err := absTargetDir(options.TargetDir)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := readInstalled(targetDir, options.Selection.Release)
+	if err != nil {
+		return nil, err
+	}
+	if installed == nil {
+		return nil, fmt.Errorf("cannot find manifest of installed slices in %s", options.TargetDir)
+	}
+
+	runs, err := newArchRuns(options)
+	if err != nil {
+		return nil, err
+	}
+	var upgrades []*PackageUpgrade
+	var stale []*manifest.Package
+	outdated := make(map[string]bool)
+	selected := make(map[string]bool)
+	for _, run := range runs {
+		for _, slice := range run.reported {
+			selected[slice.String()] = true
+		}
+		for _, pkgName := range selectionPackages(run.selection) {
+			installedPkgs := installed.packages[pkgName]
+			if len(installedPkgs) == 0 {
+				continue
+			}
+			info, err := run.pkgArchive[pkgName].Info(pkgName, options.Pins[pkgName])
+			if err != nil {
+				return nil, err
+			}
+			var old *manifest.Package
+			for _, pkg := range installedPkgs {
+				if pkg.Arch == info.Arch || pkg.Arch == "all" {
+					old = pkg
+					break
+				}
+			}
+			if old == nil {
+				// Not installed for this architecture.
+				continue
+			}
+			if old.Version == info.Version && old.Digest == info.SHA256 {
+				continue
+			}
+			for i, slice := range run.selection.Slices {
+				if slice.Package == pkgName {
+					outdated[run.reported[i].String()] = true
+				}
+			}
+			// Packages for all architectures are selected by every run.
+			if slices.Contains(stale, old) {
+				continue
+			}
+			stale = append(stale, old)
+			upgrades = append(upgrades, &PackageUpgrade{
+				Name:       pkgName,
+				Arch:       info.Arch,
+				OldVersion: old.Version,
+				NewVersion: info.Version,
+			})
+		}
+	}
+	if len(upgrades) == 0 {
+		return nil, nil
+	}
+	installed.addDependents(options.Selection.Release, selected, outdated)
+
+	installed.forget(outdated)
+	for _, pkg := range stale {
+		installed.packages[pkg.Name] = slices.DeleteFunc(installed.packages[pkg.Name], func(p *manifest.Package) bool {
+			return p == pkg
+		})
+	}
+	err = cut(options, targetDir, installed)
+	if err != nil {
+		return nil, err
+	}
+	return upgrades, nil
+}
+
+// addDependents adds to outdated the selected slices with mutation scripts
+// which depend on an outdated slice, directly or not, as their scripts may
+// read or modify the content being upgraded.
+func (r *installedRoot) addDependents(release *setup.Release, selected, outdated map[string]bool) {
+	installedSlices := r.manifestSlices(release, nil)
+	affected := maps.Clone(outdated)
+	for changed := true; changed; {
+		changed = false
+		for _, slice := range installedSlices {
+			name := slice.String()
+			if affected[name] {
+				continue
+			}
+			for _, essential := range essentialNames(slice) {
+				if !affected[essential] {
+					continue
+				}
+				affected[name] = true
+				changed = true
+				if slice.Scripts.Mutate != "" && selected[name] {
+					logf("Slice %s depends on upgraded content, cutting it again...", name)
+					outdated[name] = true
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package slicer_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/chisel/internal/setup"
+	"github.com/canonical/chisel/internal/slicer"
+	"github.com/canonical/chisel/internal/testutil"
+)
+
+var upgradeTests = []struct {
+	summary    string
+	version    string
+	data       []byte
+	prepare    func(c *C, targetDir string)
+	upgrades   []*slicer.PackageUpgrade
+	filesystem map[string]string
+	paths      map[string]string
+	pkgs       map[string]string
+	error      string
+}{{
+	summary: "Nothing to upgrade",
+	version: "version",
+	data:    testutil.PackageData["test-package"],
+	filesystem: map[string]string{
+		"/dir/":                  "dir 0755",
+		"/dir/copy":              "file 0644 cc55e2ec",
+		"/dir/file":              "file 0644 cc55e2ec",
+		"/dir/nested/":           "dir 0755",
+		"/dir/nested/file":       "file 0644 84237a05",
+		"/dir/nested/other-file": "file 0644 6b86b273",
+		"/file":                  "file 0644 fc02ca0e",
+		"/other-copy":            "file 0644 cc55e2ec",
+	},
+}, {
+	summary: "Upgrade changed package",
+	version: "version2",
+	data: testutil.MustMakeDeb([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Dir(0755, "./dir/"),
+		testutil.Reg(0644, "./dir/file", "new content"),
+		testutil.Dir(0755, "./dir/nested/"),
+		testutil.Reg(0644, "./dir/nested/new-file", "2"),
+	}),
+	prepare: func(c *C, targetDir string) {
+		// Content of packages not upgraded is left untouched.
+		err := os.WriteFile(filepath.Join(targetDir, "file"), []byte("modified"), 0644)
+		c.Assert(err, IsNil)
+	},
+	upgrades: []*slicer.PackageUpgrade{{
+		Name:       "test-package",
+		Arch:       "amd64",
+		OldVersion: "version",
+		NewVersion: "version2",
+	}},
+	filesystem: map[string]string{
+		"/dir/":                "dir 0755",
+		"/dir/copy":            "file 0644 fe32608c",
+		"/dir/file":            "file 0644 fe32608c",
+		"/dir/nested/":         "dir 0755",
+		"/dir/nested/new-file": "file 0644 d4735e3a",
+		"/file":                "file 0644 b8001285",
+		// Slices whose scripts depend on upgraded content are cut again.
+		"/other-copy": "file 0644 fe32608c",
+	},
+	paths: map[string]string{
+		"/dir/copy":            "file 0644 5b41362b fe32608c {test-package_myslice}",
+		"/dir/file":            "file 0644 fe32608c {test-package_myslice}",
+		"/dir/nested/":         "dir 0755 {test-package_myslice}",
+		"/dir/nested/new-file": "file 0644 d4735e3a {test-package_myslice}",
+		"/file":                "file 0644 fc02ca0e {other-package_myslice}",
+		"/other-copy":          "file 0644 5b41362b fe32608c {other-package_copy}",
+	},
+	pkgs: map[string]string{
+		"other-package": "other-package version all hash",
+		"test-package":  "test-package version2 amd64 hash-version2",
+	},
+}, {
+	summary: "Failed upgrade leaves installed content in place",
+	version: "version2",
+	data:    []byte("invalid package data"),
+	filesystem: map[string]string{
+		"/dir/":                  "dir 0755",
+		"/dir/copy":              "file 0644 cc55e2ec",
+		"/dir/file":              "file 0644 cc55e2ec",
+		"/dir/nested/":           "dir 0755",
+		"/dir/nested/file":       "file 0644 84237a05",
+		"/dir/nested/other-file": "file 0644 6b86b273",
+		"/file":                  "file 0644 fc02ca0e",
+		"/other-copy":            "file 0644 cc55e2ec",
+	},
+	error: `cannot extract from package "test-package": .*`,
+}, {
+	summary: "Root without manifest",
+	version: "version2",
+	data:    testutil.PackageData["test-package"],
+	prepare: func(c *C, targetDir string) {
+		err := os.Remove(filepath.Join(targetDir, "chisel-data/manifest.wall"))
+		c.Assert(err, IsNil)
+	},
+	error: `cannot find manifest of installed slices in .*`,
+}}
+
+func (s *S) TestUpgrade(c *C) {
+	files := map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/dir/file:
+						/dir/nested/**:
+						/dir/copy: {text: data1, mutable: true}
+					mutate: |
+						content.write("/dir/copy", content.read("/dir/file"))
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					essential:
+						- test-package_manifest
+					contents:
+						/file:
+				copy:
+					essential:
+						- test-package_myslice
+					contents:
+						/other-copy: {text: data1, mutable: true}
+					mutate: |
+						content.write("/other-copy", content.read("/dir/file"))
+		`,
+	}
+	release := readTestRelease(c, files)
+	keys := []setup.SliceKey{
+		{"test-package", "myslice"},
+		{"other-package", "myslice"},
+		{"other-package", "copy"},
+	}
+
+	runOptions := func(targetDir, version string, data []byte) *slicer.RunOptions {
+		return testRunOptions(c, release, targetDir, keys, "amd64", &testutil.TestPackage{
+			Name:    "test-package",
+			Version: version,
+			Arch:    "amd64",
+			Hash:    "hash-" + version,
+			Data:    data,
+		}, &testutil.TestPackage{
+			Name:    "other-package",
+			Version: "version",
+			Arch:    "all",
+			Hash:    "hash",
+			Data:    testutil.PackageData["other-package"],
+		})
+	}
+
+	for _, test := range upgradeTests {
+		c.Logf("Summary: %s", test.summary)
+		targetDir := c.MkDir()
+		err := slicer.Run(runOptions(targetDir, "version", testutil.PackageData["test-package"]))
+		c.Assert(err, IsNil)
+		if test.prepare != nil {
+			test.prepare(c, targetDir)
+		}
+
+		upgrades, err := slicer.Upgrade(runOptions(targetDir, test.version, test.data))
+		if test.error != "" {
+			c.Assert(err, ErrorMatches, test.error)
+			if test.filesystem != nil {
+				filesystem := testutil.TreeDump(targetDir)
+				delete(filesystem, "/chisel-data/")
+				delete(filesystem, "/chisel-data/manifest.wall")
+				c.Assert(filesystem, DeepEquals, test.filesystem)
+			}
+			continue
+		}
+		c.Assert(err, IsNil)
+		c.Assert(upgrades, DeepEquals, test.upgrades)
+
+		manifestPath := "/chisel-data/manifest.wall"
+		filesystem := testutil.TreeDump(targetDir)
+		delete(filesystem, "/chisel-data/")
+		delete(filesystem, manifestPath)
+		c.Assert(filesystem, DeepEquals, test.filesystem)
+		if test.upgrades == nil {
+			continue
+		}
+
+		mfest := readManifest(c, targetDir, manifestPath)
+		pathsDump, err := treeDumpManifestPaths(mfest)
+		c.Assert(err, IsNil)
+		delete(pathsDump, manifestPath)
+		c.Assert(pathsDump, DeepEquals, test.paths)
+		pkgsDump, err := dumpManifestPkgs(mfest)
+		c.Assert(err, IsNil)
+		c.Assert(pkgsDump, DeepEquals, test.pkgs)
+	}
+}
+
+func (s *S) TestUpgradeForeignArchs(c *C) {
+	release := readTestRelease(c, map[string]string{
+		"chisel.yaml": testutil.DefaultChiselYaml,
+		"slices/mydir/test-package.yaml": `
+			package: test-package
+			slices:
+				myslice:
+					contents:
+						/dir/file:
+		`,
+		"slices/mydir/other-package.yaml": `
+			package: other-package
+			slices:
+				myslice:
+					contents:
+						/file:
+				manifest:
+					contents:
+						/chisel-data/**: {generate: manifest}
+		`,
+	})
+	testPackage := func(arch, version string) *testutil.TestPackage {
+		return &testutil.TestPackage{
+			Name:    "test-package",
+			Version: version,
+			Arch:    arch,
+			Hash:    "hash",
+			Data:    testutil.PackageData["test-package"],
+		}
+	}
+	otherPackage := &testutil.TestPackage{
+		Name:    "other-package",
+		Version: "version",
+		Arch:    "all",
+		Hash:    "hash",
+		Data:    testutil.PackageData["other-package"],
+	}
+	keys := []setup.SliceKey{{"other-package", "myslice"}, {"other-package", "manifest"}}
+	foreignKeys := []setup.SliceKey{{"test-package", "myslice"}}
+	foreignSelection, err := setup.Select(release, foreignKeys, "i386")
+	c.Assert(err, IsNil)
+	foreignArchs := []*slicer.ArchOptions{{
+		Selection: foreignSelection,
+		Archives:  testArchives(release, "i386", testPackage("i386", "version")),
+	}}
+
+	// Only the foreign architecture has test-package installed.
+	targetDir := c.MkDir()
+	options := testRunOptions(c, release, targetDir, keys, "amd64", otherPackage)
+	options.ForeignArchs = foreignArchs
+	err = slicer.Run(options)
+	c.Assert(err, IsNil)
+
+	// A different version of the package for the native architecture is
+	// not an upgrade of the one installed for the foreign architecture.
+	options = testRunOptions(c, release, targetDir, append(keys, foreignKeys...), "amd64", otherPackage, testPackage("amd64", "version2"))
+	options.ForeignArchs = foreignArchs
+	upgrades, err := slicer.Upgrade(options)
+	c.Assert(err, IsNil)
+	c.Assert(upgrades, IsNil)
+}
@@ -11,6 +11,7 @@ import (
 type TestArchive struct {
 	Opts     archive.Options
 	Packages map[string]*TestPackage
+	Verified []*archive.Verification
 }
 
 type TestPackage struct {
@@ -26,11 +27,14 @@ func (a *TestArchive) Options() *archive.Options {
 	return &a.Opts
 }
 
-func (a *TestArchive) Fetch(pkgName string) (io.ReadSeekCloser, *archive.PackageInfo, error) {
+func (a *TestArchive) Fetch(pkgName, version string) (io.ReadSeekCloser, *archive.PackageInfo, error) {
 	pkg, ok := a.Packages[pkgName]
 	if !ok {
 		return nil, nil, fmt.Errorf("cannot find package %q in archive", pkgName)
 	}
+	if version != "" && pkg.Version != version {
+		return nil, nil, fmt.Errorf("cannot find package %q version %s in archive", pkgName, version)
+	}
 	info := &archive.PackageInfo{
 		Name:    pkg.Name,
 		Version: pkg.Version,
@@ -40,16 +44,23 @@ func (a *TestArchive) Fetch(pkgName string) (io.ReadSeekCloser, *archive.Package
 	return ReadSeekNopCloser(bytes.NewReader(pkg.Data)), info, nil
 }
 
+func (a *TestArchive) Verifications() []*archive.Verification {
+	return a.Verified
+}
+
 func (a *TestArchive) Exists(pkg string) bool {
 	_, ok := a.Packages[pkg]
 	return ok
 }
 
-func (a *TestArchive) Info(pkgName string) (*archive.PackageInfo, error) {
+func (a *TestArchive) Info(pkgName, version string) (*archive.PackageInfo, error) {
 	pkg, ok := a.Packages[pkgName]
 	if !ok {
 		return nil, fmt.Errorf("cannot find package %q in archive", pkgName)
 	}
+	if version != "" && pkg.Version != version {
+		return nil, fmt.Errorf("cannot find package %q version %s in archive", pkgName, version)
+	}
 	return &archive.PackageInfo{
 		Name:    pkg.Name,
 		Version: pkg.Version,
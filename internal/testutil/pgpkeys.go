@@ -12,7 +12,7 @@ type PGPKeyData struct {
 	ID           string
 	PubKeyArmor  string
 	PrivKeyArmor string
-	PubKey       *packet.PublicKey
+	PubKey       *pgputil.PublicKey
 	PrivKey      *packet.PrivateKey
 }
 
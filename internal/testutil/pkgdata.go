@@ -123,33 +123,48 @@ func compressBytesZstd(input []byte) ([]byte, error) {
 }
 
 func MakeDeb(entries []TarEntry) ([]byte, error) {
+	return MakeDebWithControl(nil, entries)
+}
+
+// MakeDebWithControl is like MakeDeb but also adds a control.tar.zst member
+// with the given entries before the data, unless controlEntries is nil.
+func MakeDebWithControl(controlEntries, entries []TarEntry) ([]byte, error) {
 	var buf bytes.Buffer
 
-	tarData, err := makeTar(entries)
-	if err != nil {
+	writer := ar.NewWriter(&buf)
+	if err := writer.WriteGlobalHeader(); err != nil {
 		return nil, err
 	}
-	compTarData, err := compressBytesZstd(tarData)
-	if err != nil {
+	if controlEntries != nil {
+		if err := writeTarMember(writer, "control.tar.zst", controlEntries); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeTarMember(writer, "data.tar.zst", entries); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	writer := ar.NewWriter(&buf)
-	if err := writer.WriteGlobalHeader(); err != nil {
-		return nil, err
+func writeTarMember(writer *ar.Writer, name string, entries []TarEntry) error {
+	tarData, err := makeTar(entries)
+	if err != nil {
+		return err
+	}
+	compTarData, err := compressBytesZstd(tarData)
+	if err != nil {
+		return err
 	}
-	dataHeader := ar.Header{
-		Name: "data.tar.zst",
+	header := ar.Header{
+		Name: name,
 		Mode: 0644,
 		Size: int64(len(compTarData)),
 	}
-	if err := writer.WriteHeader(&dataHeader); err != nil {
-		return nil, err
-	}
-	if _, err = writer.Write(compTarData); err != nil {
-		return nil, err
+	if err := writer.WriteHeader(&header); err != nil {
+		return err
 	}
-	return buf.Bytes(), nil
+	_, err = writer.Write(compTarData)
+	return err
 }
 
 func MustMakeDeb(entries []TarEntry) []byte {
@@ -160,6 +175,14 @@ func MustMakeDeb(entries []TarEntry) []byte {
 	return data
 }
 
+func MustMakeDebWithControl(controlEntries, entries []TarEntry) []byte {
+	data, err := MakeDebWithControl(controlEntries, entries)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
 // Reg is a shortcut for creating a regular file TarEntry structure (with
 // tar.Typeflag set tar.TypeReg). Reg stands for "REGular file".
 func Reg(mode int64, path, content string) TarEntry {
@@ -437,3 +437,25 @@ func (s *S) TestTarEntryShortHands(c *C) {
 		c.Assert(test.shorthand, DeepEquals, test.result)
 	}
 }
+
+func (s *pkgdataSuite) TestMakeDebWithControl(c *C) {
+	debBytes, err := testutil.MakeDebWithControl([]testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+		testutil.Reg(0644, "./control", "Package: foo\n"),
+	}, []testutil.TarEntry{
+		testutil.Dir(0755, "./"),
+	})
+	c.Assert(err, IsNil)
+
+	arReader := ar.NewReader(bytes.NewBuffer(debBytes))
+	var names []string
+	for {
+		arHeader, err := arReader.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		names = append(names, arHeader.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"control.tar.zst", "data.tar.zst"})
+}
@@ -17,6 +17,12 @@ type Package struct {
 	Version string `json:"version,omitempty"`
 	Digest  string `json:"sha256,omitempty"`
 	Arch    string `json:"arch,omitempty"`
+	// The following fields are taken from the package control data. The
+	// installed size is given in KiB.
+	Source        string `json:"source,omitempty"`
+	InstalledSize uint64 `json:"installed_size,omitempty"`
+	Depends       string `json:"depends,omitempty"`
+	Homepage      string `json:"homepage,omitempty"`
 }
 
 type Slice struct {